@@ -0,0 +1,41 @@
+package awesometest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// UpdateEnv is the environment variable that, set to 1, makes AssertGolden
+// rewrite golden files with the actual output. An environment variable rather
+// than a flag leaves -update free for the tests importing this package.
+const UpdateEnv = "AWESOMETEST_UPDATE"
+
+// AssertGolden compares got with testdata/<name>.golden and fails the test on
+// a mismatch. Run the tests with AWESOMETEST_UPDATE=1 to record new golden
+// files.
+func AssertGolden(t testing.TB, name, got string) {
+	t.Helper()
+	assertGolden(t, filepath.Join("testdata", name+".golden"), got)
+}
+
+func assertGolden(t testing.TB, path, got string) {
+	t.Helper()
+	if os.Getenv(UpdateEnv) == "1" {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("creating testdata: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatalf("updating golden file: %v", err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading golden file (run with %s=1 to create it): %v", UpdateEnv, err)
+	}
+	if got != string(want) {
+		t.Errorf("output does not match %s (run with %s=1 to accept it)\n--- want\n%s\n--- got\n%s", path, UpdateEnv, want, got)
+	}
+}
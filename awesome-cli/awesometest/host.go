@@ -0,0 +1,205 @@
+// Package awesometest runs an isolated awesome-cli host in-process so the host
+// and its plugins can be integration tested the same way.
+//
+// A Host gets its own environment, HOME, plugin directory and PATH. The CLI
+// runs against an in-memory filesystem holding only the files a test creates
+// through the Host, which also writes them to a temporary directory so
+// plugins can be executed. The host's PATH holds only its BinDir; tests whose
+// plugins run programs such as cat or sleep opt in with UseHostBinaries.
+//
+// The package belongs to the awesome-cli module, whose module path is not a
+// fetchable import path. Plugins outside this repository can import it by
+// requiring awesome-cli with a replace directive pointing at a checkout.
+package awesometest
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"awesome-cli/cmd"
+
+	"github.com/spf13/afero"
+)
+
+// Host is an isolated awesome-cli installation for a single test. Hosts do
+// not touch process-wide state and can be used from parallel tests.
+type Host struct {
+	t testing.TB
+
+	// Fs is the in-memory filesystem the CLI runs against.
+	Fs afero.Fs
+	// Env is the environment the CLI and its plugins run with.
+	Env cmd.MapEnvironment
+	// Home is the HOME directory of the host.
+	Home string
+	// PluginDir is the default plugin directory, ~/.foo/plugins.
+	PluginDir string
+	// BinDir is a directory on the host's PATH for PATH plugins.
+	BinDir string
+
+	goTool   string   // Go tool found on the test process' PATH
+	buildEnv []string // Environment of the test process, keeps go caches usable
+}
+
+// Result is the outcome of running the CLI.
+type Result struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+}
+
+// NewHost creates a Host rooted in a temporary directory that is removed when
+// the test finishes.
+func NewHost(t testing.TB) *Host {
+	t.Helper()
+	home := t.TempDir()
+	host := &Host{
+		t:         t,
+		Fs:        afero.NewMemMapFs(),
+		Home:      home,
+		PluginDir: filepath.Join(home, ".foo", "plugins"),
+		BinDir:    filepath.Join(home, "bin"),
+	}
+	host.Mkdir(host.PluginDir)
+	host.Mkdir(host.BinDir)
+
+	host.goTool, _ = exec.LookPath("go")
+	host.buildEnv = append(os.Environ(), "CGO_ENABLED=0")
+	host.Env = cmd.MapEnvironment{
+		"HOME":               home,
+		"PATH":               host.BinDir,
+		"AWESOME_CLI_CONFIG": host.ConfigPath(),
+	}
+	return host
+}
+
+// UseHostBinaries appends the test process' PATH to the host's PATH, so
+// plugins can run the programs installed on the machine. The CLI itself still
+// only sees the files in Fs.
+func (h *Host) UseHostBinaries() {
+	h.Env["PATH"] = strings.Join([]string{h.BinDir, os.Getenv("PATH")}, string(os.PathListSeparator))
+}
+
+// Mkdir creates the directory path, along with any missing parents, on disk
+// and in Fs.
+func (h *Host) Mkdir(path string) {
+	h.t.Helper()
+	if err := os.MkdirAll(path, 0755); err != nil {
+		h.t.Fatalf("creating %s: %v", path, err)
+	}
+	if err := h.Fs.MkdirAll(path, 0755); err != nil {
+		h.t.Fatalf("creating %s: %v", path, err)
+	}
+}
+
+// WriteFile writes contents to path on disk and in Fs, so the CLI finds the
+// file and can execute it.
+func (h *Host) WriteFile(path string, contents []byte, perm os.FileMode) {
+	h.t.Helper()
+	h.Mkdir(filepath.Dir(path))
+	if err := os.WriteFile(path, contents, perm); err != nil {
+		h.t.Fatalf("writing %s: %v", path, err)
+	}
+	if err := afero.WriteFile(h.Fs, path, contents, perm); err != nil {
+		h.t.Fatalf("writing %s: %v", path, err)
+	}
+}
+
+// Remove removes the file at path from disk and from Fs.
+func (h *Host) Remove(path string) {
+	h.t.Helper()
+	if err := os.Remove(path); err != nil {
+		h.t.Fatalf("removing %s: %v", path, err)
+	}
+	if err := h.Fs.Remove(path); err != nil {
+		h.t.Fatalf("removing %s: %v", path, err)
+	}
+}
+
+// ConfigPath returns the location of the host's config file.
+func (h *Host) ConfigPath() string {
+	return filepath.Join(h.Home, ".foo", "config.yaml")
+}
+
+// WriteConfig replaces the host's config file with contents.
+func (h *Host) WriteConfig(contents string) {
+	h.t.Helper()
+	if err := afero.WriteFile(h.Fs, h.ConfigPath(), []byte(contents), 0644); err != nil {
+		h.t.Fatalf("writing config: %v", err)
+	}
+}
+
+// StubPlugin installs a shell script plugin named awesome-<name> in the plugin
+// directory and returns its path. script is the body run by /bin/sh.
+func (h *Host) StubPlugin(name, script string) string {
+	h.t.Helper()
+	return h.writeScript(h.PluginDir, name, script)
+}
+
+// StubPathPlugin installs a shell script plugin named awesome-<name> in a
+// directory on PATH and returns its path.
+func (h *Host) StubPathPlugin(name, script string) string {
+	h.t.Helper()
+	return h.writeScript(h.BinDir, name, script)
+}
+
+func (h *Host) writeScript(dir, name, script string) string {
+	h.t.Helper()
+	path := filepath.Join(dir, "awesome-"+name)
+	h.WriteFile(path, []byte("#!/bin/sh\n"+script+"\n"), 0755)
+	return path
+}
+
+// BuildPlugin compiles the Go main package in pkgDir into the plugin
+// directory as awesome-<name> and returns its path.
+func (h *Host) BuildPlugin(name, pkgDir string) string {
+	h.t.Helper()
+	if h.goTool == "" {
+		h.t.Fatalf("building plugin %s: go tool not found on PATH", name)
+	}
+	path := filepath.Join(h.PluginDir, "awesome-"+name)
+	build := exec.Command(h.goTool, "build", "-o", path, ".")
+	build.Dir = pkgDir
+	build.Env = h.buildEnv
+	if output, err := build.CombinedOutput(); err != nil {
+		h.t.Fatalf("building plugin %s: %v\n%s", name, err, output)
+	}
+	binary, err := os.ReadFile(path)
+	if err != nil {
+		h.t.Fatalf("building plugin %s: %v", name, err)
+	}
+	if err := afero.WriteFile(h.Fs, path, binary, 0755); err != nil {
+		h.t.Fatalf("building plugin %s: %v", name, err)
+	}
+	return path
+}
+
+// Scrub replaces the host's temporary home directory in s with $HOME so
+// output can be compared against golden files.
+func (h *Host) Scrub(s string) string {
+	return strings.ReplaceAll(s, h.Home, "$HOME")
+}
+
+// Run executes awesome-cli with args and captures its output and exit code.
+func (h *Host) Run(args ...string) Result {
+	return h.RunWithInput("", args...)
+}
+
+// RunWithInput executes awesome-cli with args, feeding input to its stdin.
+func (h *Host) RunWithInput(input string, args ...string) Result {
+	h.t.Helper()
+	var stdout, stderr bytes.Buffer
+	app := &cmd.App{
+		Fs:     h.Fs,
+		Env:    h.Env,
+		Stdin:  strings.NewReader(input),
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	code := app.Run(args)
+	return Result{Stdout: stdout.String(), Stderr: stderr.String(), ExitCode: code}
+}
@@ -0,0 +1,360 @@
+package awesometest
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListShowsStubbedPlugins(t *testing.T) {
+	t.Parallel()
+	host := NewHost(t)
+	host.StubPlugin("reporter", "echo report")
+	host.StubPlugin("test", "echo test")
+
+	result := host.Run("list")
+
+	assert.Equal(t, 0, result.ExitCode)
+	AssertGolden(t, "list", result.Stdout)
+}
+
+func TestVersionWithPlugins(t *testing.T) {
+	t.Parallel()
+	host := NewHost(t)
+	host.StubPlugin("reporter", `[ "$1" = "--version" ] && echo "awesome-reporter version 0.3.1"`)
+	host.StubPlugin("legacy", "echo no version support")
+
+	result := host.Run("version", "--plugins", "--output", "json")
+
+	assert.Equal(t, 0, result.ExitCode)
+	var report struct {
+		Version string `json:"version"`
+		Plugins []struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		} `json:"plugins"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(result.Stdout), &report))
+	assert.NotEmpty(t, report.Version)
+	assert.Len(t, report.Plugins, 2)
+	assert.Equal(t, "legacy", report.Plugins[0].Name)
+	assert.Equal(t, "unknown", report.Plugins[0].Version)
+	assert.Equal(t, "reporter", report.Plugins[1].Name)
+	assert.Equal(t, "0.3.1", report.Plugins[1].Version)
+}
+
+func TestPluginReceivesArgsAndHostContext(t *testing.T) {
+	t.Parallel()
+	host := NewHost(t)
+	host.StubPlugin("echo", `echo "$AWESOME_CLI_PLUGIN $*"; echo "to stderr" >&2`)
+
+	result := host.Run("echo", "--team", "abc")
+
+	assert.Equal(t, 0, result.ExitCode)
+	assert.Equal(t, "awesome-echo --team abc\n", result.Stdout)
+	assert.Equal(t, "to stderr\n", result.Stderr)
+}
+
+func TestPluginExitCodeIsPropagated(t *testing.T) {
+	t.Parallel()
+	host := NewHost(t)
+	host.StubPlugin("fail", "exit 3")
+
+	result := host.Run("fail")
+
+	assert.Equal(t, 3, result.ExitCode)
+	assert.Empty(t, result.Stdout)
+	assert.Empty(t, result.Stderr)
+}
+
+func TestPluginReadsStdin(t *testing.T) {
+	t.Parallel()
+	host := NewHost(t)
+	host.UseHostBinaries()
+	host.StubPlugin("cat", "cat")
+
+	result := host.RunWithInput("piped input\n", "cat")
+
+	assert.Equal(t, "piped input\n", result.Stdout)
+}
+
+func TestPathPlugin(t *testing.T) {
+	t.Parallel()
+	host := NewHost(t)
+	host.StubPathPlugin("onpath", "echo from path")
+
+	result := host.Run("onpath")
+
+	assert.Equal(t, 0, result.ExitCode)
+	assert.Equal(t, "from path\n", result.Stdout)
+}
+
+func TestBuildPlugin(t *testing.T) {
+	t.Parallel()
+	if testing.Short() {
+		t.Skip("builds a Go binary")
+	}
+	host := NewHost(t)
+	host.BuildPlugin("hello", filepath.Join("testdata", "hello"))
+
+	result := host.Run("hello", "world")
+
+	assert.Equal(t, 0, result.ExitCode)
+	assert.Equal(t, "hello world from awesome-hello\n", result.Stdout)
+}
+
+func TestRunsAreIsolated(t *testing.T) {
+	t.Parallel()
+	host := NewHost(t)
+	host.StubPlugin("first", "echo first")
+
+	assert.Equal(t, 0, host.Run("first").ExitCode)
+	assert.Equal(t, 0, host.Run("--verbose", "version").ExitCode)
+
+	host.Remove(filepath.Join(host.PluginDir, "awesome-first"))
+	result := host.Run("first")
+	assert.Equal(t, 1, result.ExitCode)
+	assert.Contains(t, result.Stderr, `unknown command "first"`)
+}
+
+func TestWritesStayInMemory(t *testing.T) {
+	t.Parallel()
+	host := NewHost(t)
+	project := filepath.Join(host.Home, "awesome-demo")
+
+	result := host.Run("plugin", "new", "demo", "--template", "shell", "--dir", project)
+
+	assert.Equal(t, 0, result.ExitCode, result.Stderr)
+	exists, _ := afero.Exists(host.Fs, filepath.Join(project, "plugin.yaml"))
+	assert.True(t, exists)
+	_, err := os.Stat(project)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestHostIsHermetic(t *testing.T) {
+	t.Parallel()
+	host := NewHost(t)
+	onDisk := filepath.Join(t.TempDir(), "awesome-outside")
+	assert.NoError(t, os.WriteFile(onDisk, []byte("#!/bin/sh\necho outside\n"), 0755))
+	host.WriteConfig("pluginDirs: [" + filepath.Dir(onDisk) + "]\n")
+	host.StubPlugin("cat", `command -v cat || echo "cat not found"`)
+
+	assert.Equal(t, 1, host.Run("outside").ExitCode, "files written around the host are not visible")
+	assert.Equal(t, "cat not found\n", host.Run("cat").Stdout)
+	host.UseHostBinaries()
+	assert.NotEqual(t, "cat not found\n", host.Run("cat").Stdout)
+}
+
+func TestDoctorFailsOnInvalidConfig(t *testing.T) {
+	t.Parallel()
+	host := NewHost(t)
+	host.WriteConfig("pluginDirs: [relative]\n")
+
+	result := host.Run("doctor")
+
+	assert.Equal(t, 1, result.ExitCode)
+	assert.Contains(t, host.Scrub(result.Stdout), "[FAIL] Config: invalid config $HOME/.foo/config.yaml")
+	assert.Equal(t, "Error: 1 check(s) failed\n", result.Stderr)
+}
+
+func TestPluginTimeoutFlag(t *testing.T) {
+	t.Parallel()
+	host := NewHost(t)
+	host.UseHostBinaries()
+	host.StubPlugin("slow", "exec sleep 5")
+
+	result := host.Run("--timeout", "100ms", "slow")
+
+	assert.Equal(t, 124, result.ExitCode)
+	assert.Contains(t, result.Stderr, "awesome-slow timed out after 100ms")
+}
+
+func TestPluginTimeoutFromConfig(t *testing.T) {
+	t.Parallel()
+	host := NewHost(t)
+	host.UseHostBinaries()
+	host.StubPlugin("slow", "exec sleep 5")
+	host.StubPlugin("quick", "echo done")
+	host.WriteConfig("pluginTimeout: 1h\nplugins:\n  slow:\n    timeout: 100ms\n")
+
+	assert.Equal(t, 124, host.Run("slow").ExitCode)
+	assert.Equal(t, "done\n", host.Run("quick").Stdout)
+}
+
+func TestHostFlagsBeforePluginName(t *testing.T) {
+	t.Parallel()
+	host := NewHost(t)
+	host.StubPlugin("echo", `echo "$AWESOME_CLI_VERBOSE $*"`)
+
+	result := host.Run("--timeout=1m", "echo", "-v", "--timeout", "5s")
+
+	assert.Equal(t, 0, result.ExitCode)
+	assert.Equal(t, "false -v --timeout 5s\n", result.Stdout)
+	assert.Equal(t, "true x\n", host.Run("-v", "echo", "x").Stdout)
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	t.Parallel()
+	host := NewHost(t)
+	host.StubPlugin("flaky", `echo "checking $1"; echo "it broke" >&2; exit 3`)
+	session := filepath.Join(host.Home, "session.json.gz")
+
+	recorded := host.Run("--record", session, "flaky", "abc")
+	replayed := host.Run("replay", "--speed", "0", session)
+
+	assert.Equal(t, 3, recorded.ExitCode)
+	assert.Equal(t, 0, replayed.ExitCode)
+	assert.Equal(t, recorded.Stdout, replayed.Stdout)
+	assert.Equal(t, "checking abc\n", replayed.Stdout)
+	assert.Contains(t, replayed.Stderr, "Replaying awesome-cli flaky abc\n")
+	assert.Contains(t, replayed.Stderr, "it broke\nExited with 3 after ")
+}
+
+func TestSecretsAreInjectedButNotRecorded(t *testing.T) {
+	t.Parallel()
+	host := NewHost(t)
+	host.Env["AWESOME_CLI_SECRETS_PASSPHRASE"] = "passphrase"
+	host.StubPlugin("test", `[ "$GITHUB_TOKEN" = ghp_s3cr3t ] && [ -z "$AWESOME_CLI_SECRETS_PASSPHRASE" ] && echo "token injected"`)
+	host.WriteConfig("plugins:\n  test:\n    secrets:\n      GITHUB_TOKEN: github-token\n")
+	session := filepath.Join(host.Home, "session.json.gz")
+
+	assert.Equal(t, 0, host.Run("secret", "set", "github-token", "ghp_s3cr3t").ExitCode)
+	result := host.Run("--record", session, "test")
+
+	assert.Equal(t, 0, result.ExitCode)
+	assert.Equal(t, "token injected\n", result.Stdout)
+	replayed := host.Run("replay", "--speed", "0", "--env", session)
+	assert.Contains(t, replayed.Stderr, "GITHUB_TOKEN=[REDACTED]")
+	assert.NotContains(t, replayed.Stdout+replayed.Stderr, "ghp_s3cr3t")
+	vault, err := afero.ReadFile(host.Fs, filepath.Join(host.Home, ".foo", "secrets.vault"))
+	assert.NoError(t, err)
+	assert.NotContains(t, string(vault), "ghp_s3cr3t")
+	history, err := afero.ReadFile(host.Fs, filepath.Join(host.Home, ".foo", "history.json"))
+	assert.NoError(t, err)
+	assert.NotContains(t, string(history), "ghp_s3cr3t")
+}
+
+func TestMissingSecretStopsPlugin(t *testing.T) {
+	t.Parallel()
+	host := NewHost(t)
+	host.Env["AWESOME_CLI_SECRETS_PASSPHRASE"] = "passphrase"
+	host.StubPlugin("test", "echo should not run")
+	host.WriteConfig("plugins:\n  test:\n    secrets:\n      GITHUB_TOKEN: github-token\n")
+
+	result := host.Run("test")
+
+	assert.Equal(t, 1, result.ExitCode)
+	assert.Empty(t, result.Stdout)
+	assert.Contains(t, result.Stderr, "github-token: secret not found")
+}
+
+func TestProfiles(t *testing.T) {
+	t.Parallel()
+	host := NewHost(t)
+	host.StubPlugin("deploy", `echo "$AWESOME_CLI_PROFILE $DEPLOY_ENV $*"`)
+	stagingDir := filepath.Join(host.Home, "staging-plugins")
+	host.Mkdir(stagingDir)
+	host.writeScript(stagingDir, "smoke", "echo smoke")
+	host.WriteConfig(`profiles:
+  staging:
+    env:
+      DEPLOY_ENV: staging
+    pluginDirs: [` + stagingDir + `]
+    plugins:
+      deploy:
+        args: [--region, eu]
+  prod:
+    env:
+      DEPLOY_ENV: prod
+`)
+
+	assert.Equal(t, "  --dry-run\n", host.Run("deploy", "--dry-run").Stdout)
+	assert.Equal(t, 0, host.Run("profile", "use", "staging").ExitCode)
+	assert.Equal(t, "staging staging --region eu --dry-run\n", host.Run("deploy", "--dry-run").Stdout)
+	assert.Equal(t, "smoke\n", host.Run("smoke").Stdout)
+	assert.Equal(t, "prod prod x\n", host.Run("--profile", "prod", "deploy", "x").Stdout)
+	assert.Equal(t, 1, host.Run("--profile", "prod", "smoke").ExitCode)
+
+	unknown := host.Run("--profile", "qa", "deploy")
+	assert.Equal(t, 1, unknown.ExitCode)
+	assert.Contains(t, unknown.Stderr, `profile "qa" is not defined`)
+}
+
+func TestDiagnosticsGoToStderr(t *testing.T) {
+	t.Parallel()
+	host := NewHost(t)
+	host.StubPlugin("echo", `echo "$AWESOME_CLI_VERBOSE $*"`)
+
+	result := host.Run("-vv", "echo", "--log-level", "debug")
+
+	assert.Equal(t, 0, result.ExitCode)
+	assert.Equal(t, "true --log-level debug\n", result.Stdout)
+	assert.Contains(t, result.Stderr, `level=DEBUG msg="Executing plugin"`)
+	assert.Equal(t, "Available plugins:\n  - echo\n", host.Run("-vv", "list").Stdout)
+}
+
+func TestOutputFormatIsPassedToPlugins(t *testing.T) {
+	t.Parallel()
+	host := NewHost(t)
+	host.StubPlugin("report", `echo "$AWESOME_CLI_OUTPUT $*"`)
+
+	assert.Equal(t, "text x\n", host.Run("report", "x").Stdout)
+	assert.Equal(t, "json -o yaml\n", host.Run("-o", "json", "report", "-o", "yaml").Stdout)
+	assert.Equal(t, "report\n", host.Run("list", "--template", "{{range .plugins}}{{.name}}{{end}}").Stdout)
+}
+
+func TestScriptPlugins(t *testing.T) {
+	t.Parallel()
+	host := NewHost(t)
+	write := func(dir, fileName, contents string) {
+		t.Helper()
+		host.WriteFile(filepath.Join(dir, fileName), []byte(contents), 0644)
+	}
+	acmeDir := filepath.Join(host.Home, "acme")
+	// Interpreters are looked up on the host's PATH like any other program
+	host.WriteFile(filepath.Join(host.BinDir, "sh"), []byte("#!/bin/sh\nexec /bin/sh \"$@\"\n"), 0755)
+	write(host.PluginDir, "awesome-hello.sh", "echo \"hello $*\"\n")
+	write(host.PluginDir, "awesome-shebang.sh", "#!/bin/sh -u\necho \"unset ${MISSING}\"\n")
+	write(acmeDir, "acme-report.sh", "echo \"report $AWESOME_CLI_PLUGIN\"\n")
+	write(host.BinDir, "team-greet.sh", "echo \"greet $0\"\n")
+	host.WriteConfig(`pluginDirs: [` + acmeDir + `]
+pluginPrefixes: [awesome-, team-]
+pluginDirPrefixes:
+  ` + acmeDir + `: [acme-]
+interpreters:
+  .sh: sh -c 'echo configured; . "$0"'
+`)
+
+	assert.Equal(t, "configured\nhello a b\n", host.Run("hello", "a", "b").Stdout)
+	assert.Equal(t, "configured\nreport acme-report.sh\n", host.Run("report").Stdout)
+	assert.Equal(t, "configured\ngreet "+filepath.Join(host.BinDir, "team-greet.sh")+"\n", host.Run("greet").Stdout)
+
+	host.WriteConfig("")
+	assert.Equal(t, "hello a\n", host.Run("hello", "a").Stdout)
+	shebang := host.Run("shebang")
+	assert.NotEqual(t, 0, shebang.ExitCode, "the shebang's -u makes the unset variable fail")
+	assert.Contains(t, shebang.Stderr, "MISSING")
+	assert.Equal(t, 1, host.Run("greet").ExitCode, "team- is not a prefix by default")
+
+	host.Remove(filepath.Join(host.BinDir, "sh"))
+	missing := host.Run("hello")
+	assert.Equal(t, 1, missing.ExitCode)
+	assert.Contains(t, missing.Stderr, "interpreter sh for "+filepath.Join(host.PluginDir, "awesome-hello.sh")+" not found on PATH")
+}
+
+func TestUpdateGoldenFromEnvironment(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "testdata", "update.golden")
+
+	t.Setenv(UpdateEnv, "1")
+	assertGolden(t, path, "recorded\n")
+	contents, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "recorded\n", string(contents))
+
+	t.Setenv(UpdateEnv, "")
+	assertGolden(t, path, "recorded\n")
+}
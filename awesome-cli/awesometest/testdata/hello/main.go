@@ -0,0 +1,11 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+func main() {
+	fmt.Printf("hello %s from %s\n", strings.Join(os.Args[1:], " "), os.Getenv("AWESOME_CLI_PLUGIN"))
+}
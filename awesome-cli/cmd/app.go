@@ -0,0 +1,272 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/afero"
+	"golang.org/x/term"
+)
+
+// Environment provides access to environment variables.
+type Environment interface {
+	Getenv(key string) string
+	Environ() []string
+}
+
+// OSEnvironment implements Environment using the os package.
+type OSEnvironment struct{}
+
+func (OSEnvironment) Getenv(key string) string { return os.Getenv(key) }
+func (OSEnvironment) Environ() []string        { return os.Environ() }
+
+// MapEnvironment implements Environment on top of a map, for tests and for
+// embedding awesome-cli with a controlled environment.
+type MapEnvironment map[string]string
+
+func (m MapEnvironment) Getenv(key string) string { return m[key] }
+
+func (m MapEnvironment) Environ() []string {
+	environ := make([]string, 0, len(m))
+	for key, value := range m {
+		environ = append(environ, key+"="+value)
+	}
+	return environ
+}
+
+// App is a single awesome-cli instance. It owns everything the commands need
+// from the outside world, so independent instances can run side by side and
+// awesome-cli can be embedded in other Go tools.
+type App struct {
+	Fs     afero.Fs
+	Env    Environment
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// Config is used as-is when set, otherwise it is read from the config file.
+	Config *Config
+	// Plugins holds the plugins discovered by the last NewRootCommand call.
+	Plugins *PluginRegistry
+	// Secrets is used as-is when set, otherwise secrets are kept in the
+	// encrypted vault file.
+	Secrets SecretProvider
+
+	// verbosity is the number of times -v was given.
+	verbosity int
+	// logLevel, logFormat and logFile are the --log-* flags.
+	logLevel, logFormat, logFile string
+	// logger receives the diagnostics, see configureLogging.
+	logger *slog.Logger
+	// timeout is the --timeout flag, used when it was given.
+	timeout time.Duration
+	// record is the --record flag, the file plugin sessions are recorded to.
+	record string
+	// output and outputTemplate are the --output and --template flags.
+	output, outputTemplate string
+	// profile is the --profile flag, the profile used instead of the active one.
+	profile string
+	// pluginProfileArgs are the indices in args of the --profile flag and
+	// value given after the name of a plugin, see profileArg.
+	pluginProfileArgs []int
+	// args are the arguments of the current Run.
+	args []string
+
+	// terminateGrace is how long a plugin has to exit after SIGTERM, or
+	// defaultTerminateGrace when zero.
+	terminateGrace time.Duration
+
+	// runCommand runs an external program with extra environment variables
+	// and returns its combined output.
+	runCommand func(env []string, name string, args ...string) ([]byte, error)
+	// isTerminal reports whether stream, one of the App's standard streams,
+	// is an interactive terminal.
+	isTerminal func(stream any) bool
+	// httpClient fetches release feeds and artifacts.
+	httpClient *http.Client
+	// now returns the current time.
+	now func() time.Time
+	// executable returns the path of the running awesome-cli binary.
+	executable func() (string, error)
+	// sleep pauses, e.g. between the writes of a replayed session.
+	sleep func(d time.Duration)
+
+	stdinLines *bufio.Reader
+}
+
+// NewApp returns an App wired to the real filesystem, environment and
+// standard streams of the process.
+func NewApp() *App {
+	return &App{
+		Fs:     afero.NewOsFs(),
+		Env:    OSEnvironment{},
+		Stdin:  os.Stdin,
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+	}
+}
+
+// exitError makes the CLI exit with code without printing anything, e.g.
+// because a plugin already reported its own failure.
+type exitError struct {
+	code int
+}
+
+func (e *exitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.code)
+}
+
+// Run executes the CLI with args and returns its exit code.
+func (a *App) Run(args []string) int {
+	a.args = args
+	root := a.NewRootCommand()
+	root.SetArgs(args)
+
+	cmd, err := root.ExecuteContextC(context.Background())
+	code := 0
+	if err != nil {
+		var exitErr *exitError
+		if errors.As(err, &exitErr) {
+			code = exitErr.code
+		} else {
+			fmt.Fprintf(a.stderr(), "Error: %v\n", err)
+			code = 1
+		}
+	}
+	if recordsHistory(root, cmd) {
+		if err := a.recordHistory(args, code); err != nil {
+			a.log().Info("Failed to record history", "error", err)
+		}
+	}
+	return code
+}
+
+// Execute runs awesome-cli as the current process and exits.
+func Execute() {
+	os.Exit(NewApp().Run(os.Args[1:]))
+}
+
+func (a *App) stderr() io.Writer {
+	if a.Stderr == nil {
+		return os.Stderr
+	}
+	return a.Stderr
+}
+
+// config returns the App's Config, reading the config file the first time.
+func (a *App) config() (*Config, error) {
+	if a.Config != nil {
+		return a.Config, nil
+	}
+	config, err := loadConfig(a.Fs, a.configPath())
+	if err != nil {
+		return nil, err
+	}
+	a.Config = config
+	return config, nil
+}
+
+// configPath returns the location of the user config file. AWESOME_CLI_CONFIG
+// overrides the default of ~/.foo/config.yaml.
+func (a *App) configPath() string {
+	if path := a.Env.Getenv("AWESOME_CLI_CONFIG"); path != "" {
+		return path
+	}
+	return filepath.Join(a.Env.Getenv("HOME"), ".foo", "config.yaml")
+}
+
+// lookPath searches the App's PATH for an executable named file.
+func (a *App) lookPath(file string) (string, error) {
+	for _, dir := range filepath.SplitList(a.Env.Getenv("PATH")) {
+		path := filepath.Join(dir, file)
+		if info, err := a.Fs.Stat(path); err == nil && !info.IsDir() && info.Mode().Perm()&0111 != 0 {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("%s: %w", file, exec.ErrNotFound)
+}
+
+// commandOutput runs the program name, looked up on the App's PATH unless it
+// is an absolute path, and returns its combined output.
+func (a *App) commandOutput(name string, args ...string) ([]byte, error) {
+	return a.commandOutputWithEnv(nil, name, args...)
+}
+
+// commandOutputWithEnv is commandOutput adding env to the App's environment.
+func (a *App) commandOutputWithEnv(env []string, name string, args ...string) ([]byte, error) {
+	if a.runCommand != nil {
+		return a.runCommand(env, name, args...)
+	}
+	path := name
+	if !filepath.IsAbs(path) {
+		var err error
+		if path, err = a.lookPath(name); err != nil {
+			return nil, err
+		}
+	}
+	cmd := exec.Command(path, args...)
+	cmd.Env = append(a.Env.Environ(), env...)
+	return cmd.CombinedOutput()
+}
+
+func (a *App) currentTime() time.Time {
+	if a.now != nil {
+		return a.now()
+	}
+	return time.Now()
+}
+
+func (a *App) pause(d time.Duration) {
+	if a.sleep != nil {
+		a.sleep(d)
+		return
+	}
+	time.Sleep(d)
+}
+
+func (a *App) client() *http.Client {
+	if a.httpClient != nil {
+		return a.httpClient
+	}
+	return &http.Client{Timeout: 5 * time.Minute}
+}
+
+// executablePath returns the resolved path of the running binary.
+func (a *App) executablePath() (string, error) {
+	if a.executable != nil {
+		return a.executable()
+	}
+	path, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(path)
+}
+
+// stdinIsTerminal reports whether prompts can be shown on the App's stdin.
+func (a *App) stdinIsTerminal() bool {
+	return a.streamIsTerminal(a.Stdin)
+}
+
+// stdoutIsTerminal reports whether the App's stdout can draw the interactive UI.
+func (a *App) stdoutIsTerminal() bool {
+	return a.streamIsTerminal(a.Stdout)
+}
+
+func (a *App) streamIsTerminal(stream any) bool {
+	if a.isTerminal != nil {
+		return a.isTerminal(stream)
+	}
+	// Character devices such as /dev/null aren't all terminals
+	file, ok := stream.(*os.File)
+	return ok && term.IsTerminal(int(file.Fd()))
+}
@@ -0,0 +1,338 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/spf13/afero"
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds the user settings read from the awesome-cli config file.
+type Config struct {
+	// PluginDirs lists additional directories searched for plugins.
+	PluginDirs []string `yaml:"pluginDirs,omitempty"`
+	// PluginPrefixes are the prefixes of plugin file names, by default
+	// awesome-. The prefix is not part of the plugin's command name.
+	PluginPrefixes []string `yaml:"pluginPrefixes,omitempty"`
+	// PluginDirPrefixes replaces PluginPrefixes for individual directories,
+	// keyed by absolute path, e.g. to load acme- plugins from /opt/acme/bin.
+	PluginDirPrefixes map[string][]string `yaml:"pluginDirPrefixes,omitempty"`
+	// Interpreters maps script extensions such as .py to the command line
+	// running them, taking precedence over the script's shebang line.
+	Interpreters map[string]string `yaml:"interpreters,omitempty"`
+	// DisabledPlugins lists plugins, by command name, that are not loaded.
+	DisabledPlugins []string `yaml:"disabledPlugins,omitempty"`
+	// MinVersion is the oldest awesome-cli version the team supports.
+	MinVersion string `yaml:"minVersion,omitempty"`
+	// Update configures self-update and the new version notice.
+	Update UpdateConfig `yaml:"update,omitempty"`
+	// PluginTimeout stops plugins running longer than this, e.g. "10m".
+	PluginTimeout time.Duration `yaml:"pluginTimeout,omitempty"`
+	// PluginLimits are the resource limits applied to every plugin.
+	PluginLimits ResourceLimits `yaml:"pluginLimits,omitempty"`
+	// Plugins holds the settings of individual plugins by command name. They
+	// take precedence over the settings for all plugins.
+	Plugins map[string]PluginConfig `yaml:"plugins,omitempty"`
+	// SecretsFile is the encrypted vault secrets are stored in, by default
+	// ~/.foo/secrets.vault.
+	SecretsFile string `yaml:"secretsFile,omitempty"`
+	// Profile is the profile used unless another one is selected with
+	// --profile or AWESOME_CLI_PROFILE.
+	Profile string `yaml:"profile,omitempty"`
+	// Profiles holds named bundles of settings, e.g. per team or environment.
+	Profiles map[string]Profile `yaml:"profiles,omitempty"`
+	// Log configures the diagnostics awesome-cli writes.
+	Log LogConfig `yaml:"log,omitempty"`
+}
+
+// LogConfig configures logging. The --log-* flags and -v take precedence.
+type LogConfig struct {
+	// Level is the minimum level logged: debug, info, warn or error.
+	Level string `yaml:"level,omitempty"`
+	// Format is text or json.
+	Format string `yaml:"format,omitempty"`
+	// File also writes the log to this file, rotated when it grows too large.
+	File string `yaml:"file,omitempty"`
+	// MaxSize is the size a log file is rotated at, e.g. "10Mi".
+	MaxSize string `yaml:"maxSize,omitempty"`
+	// MaxBackups is how many rotated log files are kept.
+	MaxBackups int `yaml:"maxBackups,omitempty"`
+}
+
+// Profile holds settings applied on top of the rest of the config while the
+// profile is active.
+type Profile struct {
+	// Env is added to the environment of every plugin.
+	Env map[string]string `yaml:"env,omitempty"`
+	// PluginDirs are searched for plugins before the other directories.
+	PluginDirs []string `yaml:"pluginDirs,omitempty"`
+	// Secrets maps environment variables of every plugin to secret names.
+	Secrets map[string]string `yaml:"secrets,omitempty"`
+	// Plugins holds settings for individual plugins, taking precedence over
+	// the plugins settings outside the profile.
+	Plugins map[string]PluginConfig `yaml:"plugins,omitempty"`
+}
+
+// PluginConfig holds the settings of a single plugin.
+type PluginConfig struct {
+	Timeout time.Duration  `yaml:"timeout,omitempty"`
+	Limits  ResourceLimits `yaml:"limits,omitempty"`
+	// Secrets maps environment variables of the plugin to the names of the
+	// secrets they are set to.
+	Secrets map[string]string `yaml:"secrets,omitempty"`
+	// Args are passed to the plugin before the arguments it is run with.
+	Args []string `yaml:"args,omitempty"`
+}
+
+// UpdateConfig describes where new awesome-cli releases are published.
+type UpdateConfig struct {
+	// Feed is the URL or local path of the release feed, a releases.json
+	// file or a directory mirror containing one.
+	Feed string `yaml:"feed,omitempty"`
+	// Channel is the release channel to follow, stable or beta.
+	Channel string `yaml:"channel,omitempty"`
+	// PublicKey is the base64 encoded ed25519 key releases are signed with.
+	PublicKey string `yaml:"publicKey,omitempty"`
+}
+
+// loadConfig reads and validates the config file at path. A missing file is
+// not an error and yields an empty Config.
+func loadConfig(fs afero.Fs, path string) (*Config, error) {
+	config := &Config{}
+	data, err := afero.ReadFile(fs, path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return config, nil
+		}
+		return nil, err
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true) // Catch typos instead of silently ignoring them
+	if err := decoder.Decode(config); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if err := config.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	config.cleanPluginDirPrefixes()
+	return config, nil
+}
+
+func (c *Config) validate() error {
+	if err := validatePluginDirs(c.PluginDirs); err != nil {
+		return err
+	}
+	if err := c.validatePluginFiles(); err != nil {
+		return err
+	}
+	for _, name := range c.DisabledPlugins {
+		if err := validatePluginName(name); err != nil {
+			return fmt.Errorf("disabledPlugins: %w", err)
+		}
+	}
+	if c.PluginTimeout < 0 {
+		return fmt.Errorf("pluginTimeout must not be negative")
+	}
+	if err := c.PluginLimits.validate(); err != nil {
+		return fmt.Errorf("pluginLimits: %w", err)
+	}
+	if err := validatePluginConfigs("plugins", c.Plugins); err != nil {
+		return err
+	}
+	for name, profile := range c.Profiles {
+		if !pluginNamePattern.MatchString(name) {
+			return fmt.Errorf("invalid profile name %q: use lowercase letters, digits and dashes", name)
+		}
+		if err := profile.validate("profiles." + name); err != nil {
+			return err
+		}
+	}
+	if c.SecretsFile != "" && !filepath.IsAbs(c.SecretsFile) {
+		return fmt.Errorf("secretsFile %q must be an absolute path", c.SecretsFile)
+	}
+	if err := c.Log.validate(); err != nil {
+		return fmt.Errorf("log: %w", err)
+	}
+	if c.Update.Channel != "" && !isReleaseChannel(c.Update.Channel) {
+		return fmt.Errorf("update channel %q must be one of %s", c.Update.Channel, strings.Join(releaseChannels, ", "))
+	}
+	if c.Update.PublicKey != "" {
+		if _, err := decodePublicKey(c.Update.PublicKey); err != nil {
+			return fmt.Errorf("update publicKey: %w", err)
+		}
+	}
+	if c.MinVersion != "" {
+		if _, err := semver.NewVersion(c.MinVersion); err != nil {
+			return fmt.Errorf("minVersion %q is not a valid version: %w", c.MinVersion, err)
+		}
+	}
+	return nil
+}
+
+func (p Profile) validate(path string) error {
+	if err := validatePluginDirs(p.PluginDirs); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	for envName := range p.Env {
+		if !envNamePattern.MatchString(envName) {
+			return fmt.Errorf("%s.env: %q is not a valid environment variable name", path, envName)
+		}
+	}
+	if err := validateSecretRefs(path+".secrets", p.Secrets); err != nil {
+		return err
+	}
+	return validatePluginConfigs(path+".plugins", p.Plugins)
+}
+
+func validatePluginDirs(dirs []string) error {
+	for _, dir := range dirs {
+		if !filepath.IsAbs(dir) {
+			return fmt.Errorf("plugin directory %q must be an absolute path", dir)
+		}
+	}
+	return nil
+}
+
+func validatePluginConfigs(path string, plugins map[string]PluginConfig) error {
+	for name, plugin := range plugins {
+		if err := validatePluginName(name); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if plugin.Timeout < 0 {
+			return fmt.Errorf("%s.%s.timeout must not be negative", path, name)
+		}
+		if err := plugin.Limits.validate(); err != nil {
+			return fmt.Errorf("%s.%s.limits: %w", path, name, err)
+		}
+		if err := validateSecretRefs(path+"."+name+".secrets", plugin.Secrets); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateSecretRefs checks a mapping of environment variables to secrets.
+func validateSecretRefs(path string, secrets map[string]string) error {
+	for envName, secret := range secrets {
+		if !envNamePattern.MatchString(envName) {
+			return fmt.Errorf("%s: %q is not a valid environment variable name", path, envName)
+		}
+		if err := validateSecretName(secret); err != nil {
+			return fmt.Errorf("%s.%s: %w", path, envName, err)
+		}
+	}
+	return nil
+}
+
+// pluginDisabled reports whether the plugin with the given command or file
+// name is disabled.
+func (c *Config) pluginDisabled(name string) bool {
+	name = c.commandName(name)
+	for _, disabled := range c.DisabledPlugins {
+		if disabled == name {
+			return true
+		}
+	}
+	return false
+}
+
+// pluginConfig returns the effective settings of the plugin called name,
+// with profile, which may be nil, applied.
+func (c *Config) pluginConfig(name string, profile *Profile) PluginConfig {
+	effective := PluginConfig{Timeout: c.PluginTimeout, Limits: c.PluginLimits}
+	effective = effective.merge(c.Plugins[name])
+	if profile != nil {
+		effective = effective.merge(PluginConfig{Secrets: profile.Secrets})
+		effective = effective.merge(profile.Plugins[name])
+	}
+	return effective
+}
+
+// merge returns c with the settings made in override replacing its own.
+// Secrets are merged by environment variable.
+func (c PluginConfig) merge(override PluginConfig) PluginConfig {
+	if override.Timeout != 0 {
+		c.Timeout = override.Timeout
+	}
+	c.Limits = c.Limits.merge(override.Limits)
+	if len(override.Args) > 0 {
+		c.Args = override.Args
+	}
+	if len(override.Secrets) > 0 {
+		secrets := make(map[string]string, len(c.Secrets)+len(override.Secrets))
+		for envName, secret := range c.Secrets {
+			secrets[envName] = secret
+		}
+		for envName, secret := range override.Secrets {
+			secrets[envName] = secret
+		}
+		c.Secrets = secrets
+	}
+	return c
+}
+
+// setConfigValue sets the top-level key of the config file at path to value,
+// or removes the key when value is nil. The rest of the file, including its
+// comments, is kept as it is. The file is created when it does not exist.
+func setConfigValue(fs afero.Fs, path, key string, value any) error {
+	data, err := afero.ReadFile(fs, path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if len(doc.Content) == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+	mapping := doc.Content[0]
+	if mapping.Kind != yaml.MappingNode {
+		return fmt.Errorf("%s: expected a mapping at the top level", path)
+	}
+
+	index := -1
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			index = i
+			break
+		}
+	}
+	switch {
+	case value == nil && index >= 0:
+		mapping.Content = append(mapping.Content[:index], mapping.Content[index+2:]...)
+	case value != nil:
+		var node yaml.Node
+		if err := node.Encode(value); err != nil {
+			return err
+		}
+		if index >= 0 {
+			mapping.Content[index+1] = &node
+		} else {
+			mapping.Content = append(mapping.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, &node)
+		}
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return err
+	}
+	if err := encoder.Close(); err != nil {
+		return err
+	}
+	if err := fs.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return afero.WriteFile(fs, path, buf.Bytes(), 0644)
+}
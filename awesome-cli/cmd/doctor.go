@@ -0,0 +1,386 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/spf13/afero"
+	"github.com/spf13/cobra"
+)
+
+// Severity describes how serious a failed doctor check is.
+type Severity int
+
+const (
+	SeverityOK Severity = iota
+	SeverityWarning
+	SeverityError
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	default:
+		return "ok"
+	}
+}
+
+func (s Severity) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// CheckResult is the outcome of a single Check.
+type CheckResult struct {
+	Name        string   `json:"name"`
+	Severity    Severity `json:"severity"`
+	Message     string   `json:"message"`
+	Remediation string   `json:"remediation,omitempty"`
+}
+
+// Check is a single environment diagnostic run by the doctor command.
+type Check interface {
+	Name() string
+	Run() CheckResult
+}
+
+// doctorChecks returns the checks run by `awesome-cli doctor`, in report order.
+func (a *App) doctorChecks() []Check {
+	return []Check{
+		&pluginDirsCheck{app: a},
+		&pathPluginsCheck{app: a},
+		&duplicatePluginsCheck{app: a},
+		&configCheck{app: a},
+		&minimumVersionCheck{app: a},
+		&pythonCheck{app: a, minimum: "3.10"},
+		&containerRuntimeCheck{app: a, runtimes: []string{"podman", "docker"}},
+		&kubeconfigCheck{app: a},
+	}
+}
+
+// doctorReport is the structured output of the doctor command.
+type doctorReport struct {
+	schemaHeader
+	Checks []CheckResult `json:"checks"`
+	Failed int           `json:"failed"`
+}
+
+func (a *App) newDoctorCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:          "doctor",
+		Short:        "Checks the environment for common problems",
+		Long:         `This command checks plugin directories, config and the tools plugins depend on, and suggests fixes for anything that is wrong.`,
+		SilenceUsage: true,
+		Annotations:  map[string]string{structuredOutputAnnotation: "true"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			r, err := a.renderer()
+			if err != nil {
+				return err
+			}
+			return runDoctor(cmd.OutOrStdout(), a.doctorChecks(), r)
+		},
+	}
+}
+
+// runDoctor runs every check, reports the results with r and returns an
+// error if any error-level check failed.
+func runDoctor(w io.Writer, checks []Check, r *renderer) error {
+	results := make([]CheckResult, 0, len(checks))
+	failed := 0
+	for _, check := range checks {
+		result := check.Run()
+		result.Name = check.Name()
+		if result.Severity == SeverityError {
+			failed++
+		}
+		results = append(results, result)
+	}
+
+	report := doctorReport{schemaHeader{Kind: "DoctorReport", SchemaVersion: 1}, results, failed}
+	if err := r.render(w, report, func() { displayCheckResults(w, results) }); err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d check(s) failed", failed)
+	}
+	return nil
+}
+
+func displayCheckResults(w io.Writer, results []CheckResult) {
+	labels := map[Severity]string{
+		SeverityOK:      "[ OK ]",
+		SeverityWarning: "[WARN]",
+		SeverityError:   "[FAIL]",
+	}
+	for _, result := range results {
+		fmt.Fprintf(w, "%s %s: %s\n", labels[result.Severity], result.Name, result.Message)
+		if result.Severity != SeverityOK && result.Remediation != "" {
+			fmt.Fprintf(w, "       hint: %s\n", result.Remediation)
+		}
+	}
+}
+
+// pluginDirsCheck verifies the plugin directories can be read.
+type pluginDirsCheck struct {
+	app *App
+}
+
+func (c *pluginDirsCheck) Name() string { return "Plugin directories" }
+
+func (c *pluginDirsCheck) Run() CheckResult {
+	config, err := c.app.config()
+	if err != nil {
+		config = &Config{}
+	}
+	_, profile, _ := c.app.activeProfile()
+	dirs := c.app.pluginDirs(config, profile)
+
+	for _, dir := range dirs {
+		if _, err := afero.ReadDir(c.app.Fs, dir); err != nil {
+			if os.IsNotExist(err) && dir == c.app.defaultPluginDir() {
+				return CheckResult{
+					Severity:    SeverityWarning,
+					Message:     dir + " does not exist",
+					Remediation: "run build_and_deploy.sh from a plugin project or create the directory with mkdir -p " + dir,
+				}
+			}
+			return CheckResult{
+				Severity:    SeverityError,
+				Message:     fmt.Sprintf("cannot read %s: %v", dir, err),
+				Remediation: "check that the directory exists and is readable by the current user",
+			}
+		}
+	}
+	return CheckResult{Message: strings.Join(dirs, ", ") + " readable"}
+}
+
+// pathPluginsCheck verifies that the enabled plugins found on PATH can be executed.
+type pathPluginsCheck struct {
+	app *App
+}
+
+func (c *pathPluginsCheck) Name() string { return "PATH plugins" }
+
+func (c *pathPluginsCheck) Run() CheckResult {
+	config, err := c.app.config()
+	if err != nil {
+		config = &Config{}
+	}
+
+	var notExecutable []string
+	found := 0
+	for _, dir := range filepath.SplitList(c.app.Env.Getenv("PATH")) {
+		files, _ := afero.ReadDir(c.app.Fs, dir) // Ignore errors, some dirs might be inaccessible
+		prefixes := config.pluginPrefixes(dir)
+		for _, file := range files {
+			if file.IsDir() {
+				continue
+			}
+			name, ok := config.pluginName(file.Name(), prefixes)
+			if !ok || config.pluginDisabled(name) {
+				continue
+			}
+			found++
+			// Scripts with a known extension are run by their interpreter
+			_, isScript := config.interpreter(filepath.Ext(file.Name()))
+			if !isScript && file.Mode().Perm()&0111 == 0 {
+				notExecutable = append(notExecutable, filepath.Join(dir, file.Name()))
+			}
+		}
+	}
+
+	if len(notExecutable) > 0 {
+		return CheckResult{
+			Severity:    SeverityError,
+			Message:     "not executable: " + strings.Join(notExecutable, ", "),
+			Remediation: "run chmod +x on the listed files",
+		}
+	}
+	return CheckResult{Message: fmt.Sprintf("%d plugin(s) found on PATH", found)}
+}
+
+// duplicatePluginsCheck reports plugins that are shadowed by a plugin with the
+// same name in a directory searched earlier.
+type duplicatePluginsCheck struct {
+	app *App
+}
+
+func (c *duplicatePluginsCheck) Name() string { return "Duplicate plugins" }
+
+func (c *duplicatePluginsCheck) Run() CheckResult {
+	config, err := c.app.config()
+	if err != nil {
+		config = &Config{}
+	}
+	_, profile, _ := c.app.activeProfile()
+
+	seen := make(map[string]string)
+	var shadowed []string
+	for _, dir := range c.app.pluginSearchDirs(config, profile) {
+		files, _ := afero.ReadDir(c.app.Fs, dir)
+		prefixes := config.pluginPrefixes(dir)
+		for _, file := range files {
+			if file.IsDir() {
+				continue
+			}
+			name, ok := config.pluginName(file.Name(), prefixes)
+			if !ok {
+				continue
+			}
+			path := filepath.Join(dir, file.Name())
+			if first, exists := seen[name]; exists {
+				if first != path {
+					shadowed = append(shadowed, fmt.Sprintf("%s (shadowed by %s)", path, first))
+				}
+				continue
+			}
+			seen[name] = path
+		}
+	}
+
+	if len(shadowed) > 0 {
+		return CheckResult{
+			Severity:    SeverityWarning,
+			Message:     strings.Join(shadowed, ", "),
+			Remediation: "remove or rename the shadowed copies so the intended version runs",
+		}
+	}
+	return CheckResult{Message: "no duplicate plugins"}
+}
+
+// configCheck verifies the config file parses and is valid.
+type configCheck struct {
+	app *App
+}
+
+func (c *configCheck) Name() string { return "Config" }
+
+func (c *configCheck) Run() CheckResult {
+	path := c.app.configPath()
+	if _, err := c.app.Fs.Stat(path); os.IsNotExist(err) {
+		return CheckResult{Message: "no config file at " + path + ", using defaults"}
+	}
+	if _, err := loadConfig(c.app.Fs, path); err != nil {
+		return CheckResult{
+			Severity:    SeverityError,
+			Message:     err.Error(),
+			Remediation: "fix or remove " + path,
+		}
+	}
+	return CheckResult{Message: path + " is valid"}
+}
+
+// minimumVersionCheck verifies the running binary is not older than the
+// minimum version configured for the team.
+type minimumVersionCheck struct {
+	app *App
+}
+
+func (c *minimumVersionCheck) Name() string { return "Minimum version" }
+
+func (c *minimumVersionCheck) Run() CheckResult {
+	current := currentBuildInfo().Version
+	config, err := c.app.config()
+	if err != nil || config.MinVersion == "" {
+		return CheckResult{Message: "no minimum version configured"}
+	}
+	if warning := minimumVersionWarning(current, config.MinVersion); warning != "" {
+		return CheckResult{
+			Severity:    SeverityWarning,
+			Message:     warning,
+			Remediation: "install awesome-cli " + config.MinVersion + " or newer",
+		}
+	}
+	return CheckResult{Message: current + " meets the minimum version " + config.MinVersion}
+}
+
+// pythonCheck verifies an installed Python meets the version plugins expect.
+type pythonCheck struct {
+	app     *App
+	minimum string
+}
+
+func (c *pythonCheck) Name() string { return "Python" }
+
+func (c *pythonCheck) Run() CheckResult {
+	output, err := c.app.commandOutput("python", "--version")
+	if err != nil {
+		return CheckResult{
+			Severity:    SeverityWarning,
+			Message:     "python not found",
+			Remediation: "install Python " + c.minimum + " or newer and make sure it is on PATH",
+		}
+	}
+
+	fields := strings.Fields(string(output))
+	if len(fields) < 2 || fields[0] != "Python" {
+		return CheckResult{Severity: SeverityWarning, Message: "failed to detect Python version"}
+	}
+	current, err := semver.NewVersion(fields[1])
+	if err != nil {
+		return CheckResult{Severity: SeverityWarning, Message: "failed to parse Python version " + fields[1]}
+	}
+	if current.LessThan(semver.MustParse(c.minimum)) {
+		return CheckResult{
+			Severity:    SeverityWarning,
+			Message:     "Python " + current.String() + " is below " + c.minimum,
+			Remediation: "install Python " + c.minimum + " or newer",
+		}
+	}
+	return CheckResult{Message: "Python " + current.String()}
+}
+
+// containerRuntimeCheck verifies a container runtime is available for
+// plugins such as awesome-test.
+type containerRuntimeCheck struct {
+	app      *App
+	runtimes []string
+}
+
+func (c *containerRuntimeCheck) Name() string { return "Container runtime" }
+
+func (c *containerRuntimeCheck) Run() CheckResult {
+	for _, runtime := range c.runtimes {
+		if path, err := c.app.lookPath(runtime); err == nil {
+			return CheckResult{Message: runtime + " found at " + path}
+		}
+	}
+	return CheckResult{
+		Severity:    SeverityWarning,
+		Message:     "none of " + strings.Join(c.runtimes, ", ") + " found on PATH",
+		Remediation: "install podman (or docker) to run container based plugins such as awesome-test",
+	}
+}
+
+// kubeconfigCheck verifies a kubeconfig is present for plugins such as
+// awesome-uatu.
+type kubeconfigCheck struct {
+	app *App
+}
+
+func (c *kubeconfigCheck) Name() string { return "Kubeconfig" }
+
+func (c *kubeconfigCheck) Run() CheckResult {
+	paths := filepath.SplitList(c.app.Env.Getenv("KUBECONFIG"))
+	if len(paths) == 0 {
+		paths = []string{filepath.Join(c.app.Env.Getenv("HOME"), ".kube", "config")}
+	}
+	for _, path := range paths {
+		if _, err := c.app.Fs.Stat(path); err == nil {
+			return CheckResult{Message: path + " found"}
+		}
+	}
+	return CheckResult{
+		Severity:    SeverityWarning,
+		Message:     "no kubeconfig at " + strings.Join(paths, ", "),
+		Remediation: "set KUBECONFIG or copy your cluster credentials to ~/.kube/config",
+	}
+}
@@ -0,0 +1,242 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+type stubCheck struct {
+	name   string
+	result CheckResult
+}
+
+func (s *stubCheck) Name() string     { return s.name }
+func (s *stubCheck) Run() CheckResult { return s.result }
+
+func TestRunDoctorText(t *testing.T) {
+	t.Parallel()
+	checks := []Check{
+		&stubCheck{name: "First", result: CheckResult{Message: "fine"}},
+		&stubCheck{name: "Second", result: CheckResult{Severity: SeverityWarning, Message: "meh", Remediation: "do something"}},
+	}
+
+	var out bytes.Buffer
+	err := runDoctor(&out, checks, &renderer{format: "text"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "[ OK ] First: fine\n[WARN] Second: meh\n       hint: do something\n", out.String())
+}
+
+func TestRunDoctorFailsOnError(t *testing.T) {
+	t.Parallel()
+	checks := []Check{
+		&stubCheck{name: "Broken", result: CheckResult{Severity: SeverityError, Message: "bad"}},
+	}
+
+	var out bytes.Buffer
+	err := runDoctor(&out, checks, &renderer{format: "json"})
+
+	assert.EqualError(t, err, "1 check(s) failed")
+	var report struct {
+		Checks []map[string]string `json:"checks"`
+		Failed int                 `json:"failed"`
+	}
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &report))
+	assert.Equal(t, 1, report.Failed)
+	assert.Equal(t, "Broken", report.Checks[0]["name"])
+	assert.Equal(t, "error", report.Checks[0]["severity"])
+}
+
+func TestDoctorUnknownFormat(t *testing.T) {
+	t.Parallel()
+	app, _ := newTestApp()
+	var stderr bytes.Buffer
+	app.Stderr = &stderr
+
+	assert.Equal(t, 1, app.Run([]string{"doctor", "--output", "xml"}))
+	assert.Equal(t, "Error: unknown output format \"xml\", use text, json, yaml or template\n", stderr.String())
+}
+
+func TestPluginDirsCheck(t *testing.T) {
+	t.Parallel()
+	app, _ := newTestApp()
+
+	result := (&pluginDirsCheck{app: app}).Run()
+	assert.Equal(t, SeverityWarning, result.Severity)
+
+	app.Fs.MkdirAll("/home/test/.foo/plugins", 0755)
+	result = (&pluginDirsCheck{app: app}).Run()
+	assert.Equal(t, SeverityOK, result.Severity)
+
+	afero.WriteFile(app.Fs, "/home/test/.foo/config.yaml", []byte("pluginDirs: [/opt/missing]\n"), 0644)
+	app.Config = nil // The config is loaded once per run
+	result = (&pluginDirsCheck{app: app}).Run()
+	assert.Equal(t, SeverityError, result.Severity)
+	assert.Contains(t, result.Message, "/opt/missing")
+}
+
+func TestPluginDirsCheckProfileAndInjectedConfig(t *testing.T) {
+	t.Parallel()
+	app, _ := newTestApp()
+	app.Fs.MkdirAll("/home/test/.foo/plugins", 0755)
+	app.Fs.MkdirAll("/opt/shared", 0755)
+	// The config file is ignored when the embedding program passes one
+	afero.WriteFile(app.Fs, "/home/test/.foo/config.yaml", []byte("pluginDirs: [/opt/missing]\n"), 0644)
+	app.Config = &Config{
+		PluginDirs: []string{"/opt/shared"},
+		Profile:    "staging",
+		Profiles:   map[string]Profile{"staging": {PluginDirs: []string{"/opt/staging"}}},
+	}
+
+	result := (&pluginDirsCheck{app: app}).Run()
+	assert.Equal(t, SeverityError, result.Severity)
+	assert.Contains(t, result.Message, "/opt/staging")
+
+	app.Fs.MkdirAll("/opt/staging", 0755)
+	result = (&pluginDirsCheck{app: app}).Run()
+	assert.Equal(t, SeverityOK, result.Severity)
+	assert.Equal(t, "/opt/staging, /home/test/.foo/plugins, /opt/shared readable", result.Message)
+}
+
+func TestPathPluginsCheck(t *testing.T) {
+	t.Parallel()
+	app, _ := newTestApp()
+	app.Env = MapEnvironment{"PATH": "/bin1:/bin2"}
+	afero.WriteFile(app.Fs, "/bin1/awesome-good", []byte("#!/bin/sh\n"), 0755)
+	afero.WriteFile(app.Fs, "/bin1/unrelated", []byte("#!/bin/sh\n"), 0644)
+
+	result := (&pathPluginsCheck{app: app}).Run()
+	assert.Equal(t, SeverityOK, result.Severity)
+	assert.Equal(t, "1 plugin(s) found on PATH", result.Message)
+
+	afero.WriteFile(app.Fs, "/bin2/awesome-bad", []byte("#!/bin/sh\n"), 0644)
+	result = (&pathPluginsCheck{app: app}).Run()
+	assert.Equal(t, SeverityError, result.Severity)
+	assert.Contains(t, result.Message, "/bin2/awesome-bad")
+
+	afero.WriteFile(app.Fs, "/home/test/.foo/config.yaml", []byte("disabledPlugins: [bad]\n"), 0644)
+	app.Env = MapEnvironment{"HOME": "/home/test", "PATH": "/bin1:/bin2"}
+	app.Config = nil
+	result = (&pathPluginsCheck{app: app}).Run()
+	assert.Equal(t, SeverityOK, result.Severity, "disabled plugins are not checked")
+}
+
+func TestPathPluginsCheckScripts(t *testing.T) {
+	t.Parallel()
+	app, _ := newTestApp()
+	app.Env = MapEnvironment{"HOME": "/home/test", "PATH": "/bin1"}
+	afero.WriteFile(app.Fs, "/bin1/awesome-deploy.py", []byte("print('hi')\n"), 0644)
+	afero.WriteFile(app.Fs, "/bin1/acme-lint", []byte("#!/bin/sh\n"), 0644)
+
+	result := (&pathPluginsCheck{app: app}).Run()
+	assert.Equal(t, SeverityOK, result.Severity, "scripts are run by their interpreter")
+	assert.Equal(t, "1 plugin(s) found on PATH", result.Message)
+
+	afero.WriteFile(app.Fs, "/home/test/.foo/config.yaml", []byte("pluginDirPrefixes:\n  /bin1: [acme-]\n"), 0644)
+	app.Config = nil
+	result = (&pathPluginsCheck{app: app}).Run()
+	assert.Equal(t, SeverityError, result.Severity)
+	assert.Equal(t, "not executable: /bin1/acme-lint", result.Message)
+}
+
+func TestDuplicatePluginsCheck(t *testing.T) {
+	t.Parallel()
+	app, _ := newTestApp()
+	app.Env = MapEnvironment{"HOME": "/home/test", "PATH": "/usr/bin"}
+	afero.WriteFile(app.Fs, "/home/test/.foo/plugins/awesome-test", []byte{}, 0755)
+	afero.WriteFile(app.Fs, "/usr/bin/awesome-reporter", []byte{}, 0755)
+
+	result := (&duplicatePluginsCheck{app: app}).Run()
+	assert.Equal(t, SeverityOK, result.Severity)
+
+	afero.WriteFile(app.Fs, "/usr/bin/awesome-test", []byte{}, 0755)
+	result = (&duplicatePluginsCheck{app: app}).Run()
+	assert.Equal(t, SeverityWarning, result.Severity)
+	assert.Equal(t, "/usr/bin/awesome-test (shadowed by /home/test/.foo/plugins/awesome-test)", result.Message)
+}
+
+func TestDuplicatePluginsCheckAcrossPrefixes(t *testing.T) {
+	t.Parallel()
+	app, _ := newTestApp()
+	app.Env = MapEnvironment{"HOME": "/home/test", "PATH": "/usr/bin"}
+	afero.WriteFile(app.Fs, "/home/test/.foo/plugins/awesome-test.sh", []byte{}, 0644)
+	afero.WriteFile(app.Fs, "/usr/bin/acme-test", []byte{}, 0755)
+	afero.WriteFile(app.Fs, "/home/test/.foo/config.yaml", []byte("pluginPrefixes: [awesome-, acme-]\n"), 0644)
+
+	result := (&duplicatePluginsCheck{app: app}).Run()
+	assert.Equal(t, SeverityWarning, result.Severity)
+	assert.Equal(t, "/usr/bin/acme-test (shadowed by /home/test/.foo/plugins/awesome-test.sh)", result.Message)
+}
+
+func TestConfigCheck(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		contents string
+		severity Severity
+	}{
+		{"valid", "pluginDirs:\n  - /opt/plugins\n", SeverityOK},
+		{"empty", "", SeverityOK},
+		{"unknown field", "pluginDir: /opt/plugins\n", SeverityError},
+		{"relative dir", "pluginDirs: [plugins]\n", SeverityError},
+		{"malformed", "pluginDirs: [\n", SeverityError},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app, _ := newTestApp()
+			app.Env = MapEnvironment{"AWESOME_CLI_CONFIG": "/etc/awesome.yaml"}
+			afero.WriteFile(app.Fs, "/etc/awesome.yaml", []byte(test.contents), 0644)
+			assert.Equal(t, test.severity, (&configCheck{app: app}).Run().Severity)
+		})
+	}
+}
+
+func TestPythonCheck(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		output   string
+		err      error
+		severity Severity
+	}{
+		{"Python 3.10.1\n", nil, SeverityOK},
+		{"Python 3.12.0\n", nil, SeverityOK},
+		{"Python 2.7.16\n", nil, SeverityWarning},
+		{"", errors.New("executable file not found"), SeverityWarning},
+		{"Invalid output", nil, SeverityWarning},
+	}
+	for _, test := range tests {
+		app, _ := newTestApp()
+		app.runCommand = func(env []string, name string, args ...string) ([]byte, error) {
+			return []byte(test.output), test.err
+		}
+		assert.Equal(t, test.severity, (&pythonCheck{app: app, minimum: "3.10"}).Run().Severity, test.output)
+	}
+}
+
+func TestContainerRuntimeCheck(t *testing.T) {
+	t.Parallel()
+	app, _ := newTestApp()
+
+	result := (&containerRuntimeCheck{app: app, runtimes: []string{"podman", "docker"}}).Run()
+	assert.Equal(t, SeverityWarning, result.Severity)
+
+	afero.WriteFile(app.Fs, "/usr/bin/docker", []byte{}, 0755)
+	result = (&containerRuntimeCheck{app: app, runtimes: []string{"podman", "docker"}}).Run()
+	assert.Equal(t, SeverityOK, result.Severity)
+	assert.Equal(t, "docker found at /usr/bin/docker", result.Message)
+}
+
+func TestKubeconfigCheck(t *testing.T) {
+	t.Parallel()
+	app, _ := newTestApp()
+
+	assert.Equal(t, SeverityWarning, (&kubeconfigCheck{app: app}).Run().Severity)
+
+	afero.WriteFile(app.Fs, "/home/test/.kube/config", []byte("apiVersion: v1\n"), 0600)
+	assert.Equal(t, SeverityOK, (&kubeconfigCheck{app: app}).Run().Severity)
+}
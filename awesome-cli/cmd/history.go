@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/spf13/cobra"
+)
+
+// maxHistoryEntries is how many commands the history file keeps.
+const maxHistoryEntries = 100
+
+// skipHistoryAnnotation marks commands that are not recorded in the history.
+const skipHistoryAnnotation = "awesome-cli/skip-history"
+
+// historyEntry is a command line run through awesome-cli.
+type historyEntry struct {
+	Args     []string  `json:"args"`
+	Time     time.Time `json:"time"`
+	ExitCode int       `json:"exitCode"`
+}
+
+func (e historyEntry) commandLine() string {
+	return strings.Join(e.Args, " ")
+}
+
+// historyReport is the structured output of the history command.
+type historyReport struct {
+	schemaHeader
+	Entries []historyEntry `json:"entries"`
+}
+
+func (a *App) newHistoryCommand() *cobra.Command {
+	var limit int
+	var clear bool
+	historyCmd := &cobra.Command{
+		Use:          "history",
+		Short:        "Shows the commands run recently",
+		Long:         `This command shows the most recent commands run through awesome-cli, newest first.`,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		Annotations:  map[string]string{skipHistoryAnnotation: "true", structuredOutputAnnotation: "true"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if clear {
+				if err := a.Fs.Remove(a.historyPath()); err != nil && !os.IsNotExist(err) {
+					return err
+				}
+				return nil
+			}
+			entries, err := a.recentHistory(limit)
+			if err != nil {
+				return err
+			}
+			if entries == nil {
+				entries = []historyEntry{}
+			}
+			out := cmd.OutOrStdout()
+			report := historyReport{schemaHeader{Kind: "History", SchemaVersion: 1}, entries}
+			return a.render(out, report, func() { displayHistory(out, entries) })
+		},
+	}
+	historyCmd.Flags().IntVarP(&limit, "limit", "n", 20, "Number of commands to show")
+	historyCmd.Flags().BoolVar(&clear, "clear", false, "Forget all recorded commands")
+	return historyCmd
+}
+
+func displayHistory(w io.Writer, entries []historyEntry) {
+	if len(entries) == 0 {
+		fmt.Fprintln(w, "No commands recorded yet.")
+		return
+	}
+	for _, entry := range entries {
+		line := fmt.Sprintf("%s  %s", entry.Time.Local().Format("2006-01-02 15:04"), entry.commandLine())
+		if entry.ExitCode != 0 {
+			line += fmt.Sprintf("  (exit %d)", entry.ExitCode)
+		}
+		fmt.Fprintln(w, line)
+	}
+}
+
+// historyPath returns the file commands are recorded in.
+func (a *App) historyPath() string {
+	return filepath.Join(a.Env.Getenv("HOME"), ".foo", "history.json")
+}
+
+// recordsHistory reports whether running cmd should be recorded. The root
+// command, help, shell completion and commands annotated with
+// skipHistoryAnnotation are not.
+func recordsHistory(root, cmd *cobra.Command) bool {
+	if cmd == nil || cmd == root {
+		return false
+	}
+	for c := cmd; c != root && c != nil; c = c.Parent() {
+		switch c.Name() {
+		case "help", "completion", cobra.ShellCompRequestCmd, cobra.ShellCompNoDescRequestCmd:
+			return false
+		}
+		if c.Annotations[skipHistoryAnnotation] != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// loadHistory returns the recorded commands, oldest first.
+func (a *App) loadHistory() ([]historyEntry, error) {
+	data, err := afero.ReadFile(a.Fs, a.historyPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var entries []historyEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", a.historyPath(), err)
+	}
+	return entries, nil
+}
+
+// recordHistory appends args to the history, dropping the oldest entries
+// beyond maxHistoryEntries.
+func (a *App) recordHistory(args []string, exitCode int) error {
+	entries, err := a.loadHistory()
+	if err != nil {
+		return err
+	}
+	entries = append(entries, historyEntry{Args: args, Time: a.currentTime().UTC(), ExitCode: exitCode})
+	if len(entries) > maxHistoryEntries {
+		entries = entries[len(entries)-maxHistoryEntries:]
+	}
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := a.Fs.MkdirAll(filepath.Dir(a.historyPath()), 0755); err != nil {
+		return err
+	}
+	// Command lines may hold sensitive arguments, keep them private
+	return afero.WriteFile(a.Fs, a.historyPath(), data, 0600)
+}
+
+// recentHistory returns up to limit distinct command lines, newest first.
+func (a *App) recentHistory(limit int) ([]historyEntry, error) {
+	entries, err := a.loadHistory()
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var recent []historyEntry
+	for i := len(entries) - 1; i >= 0 && len(recent) < limit; i-- {
+		if line := entries[i].commandLine(); !seen[line] {
+			seen[line] = true
+			recent = append(recent, entries[i])
+		}
+	}
+	return recent, nil
+}
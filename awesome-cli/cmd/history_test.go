@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunRecordsHistory(t *testing.T) {
+	t.Parallel()
+	app, stdout := newTestApp()
+	app.now = func() time.Time { return time.Date(2024, 8, 1, 9, 30, 0, 0, time.UTC) }
+
+	app.Run([]string{"version", "--output", "json"})
+	app.Run([]string{"version", "--output", "xml"})
+	app.Run([]string{"help"})
+	app.Run([]string{"ui"})
+	app.Run([]string{"history"})
+
+	entries, err := app.loadHistory()
+	assert.NoError(t, err)
+	assert.Equal(t, []historyEntry{
+		{Args: []string{"version", "--output", "json"}, Time: app.now(), ExitCode: 0},
+		{Args: []string{"version", "--output", "xml"}, Time: app.now(), ExitCode: 1},
+	}, entries)
+	assert.Contains(t, stdout.String(), "version --output xml  (exit 1)\n")
+}
+
+func TestRecentHistory(t *testing.T) {
+	t.Parallel()
+	app, _ := newTestApp()
+	for i := 0; i < maxHistoryEntries+10; i++ {
+		assert.NoError(t, app.recordHistory([]string{"list", strconv.Itoa(i % 20)}, 0))
+	}
+
+	entries, _ := app.loadHistory()
+	assert.Len(t, entries, maxHistoryEntries)
+
+	recent, err := app.recentHistory(3)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"list 9", "list 8", "list 7"}, []string{recent[0].commandLine(), recent[1].commandLine(), recent[2].commandLine()})
+
+	recent, _ = app.recentHistory(50)
+	assert.Len(t, recent, 20, "repeated command lines are listed once")
+}
+
+func TestHistoryClear(t *testing.T) {
+	t.Parallel()
+	app, stdout := newTestApp()
+
+	assert.Equal(t, 0, app.Run([]string{"history", "--clear"}))
+	app.recordHistory([]string{"list"}, 0)
+	assert.Equal(t, 0, app.Run([]string{"history", "--clear"}))
+	assert.Equal(t, 0, app.Run([]string{"history"}))
+	assert.Equal(t, "No commands recorded yet.\n", stdout.String())
+}
+
+func TestHistoryIsPrivate(t *testing.T) {
+	t.Parallel()
+	app, _ := newTestApp()
+
+	assert.NoError(t, app.recordHistory([]string{"list"}, 0))
+
+	info, err := app.Fs.Stat(app.historyPath())
+	assert.NoError(t, err)
+	assert.Equal(t, "-rw-------", info.Mode().String())
+}
@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ResourceLimits bounds the resources a plugin may use. They are applied as
+// rlimits on Linux and ignored, with a warning, elsewhere.
+type ResourceLimits struct {
+	// CPUTime is the CPU time the plugin may consume, e.g. "5m".
+	CPUTime time.Duration `yaml:"cpuTime,omitempty"`
+	// Memory is the address space the plugin may map, e.g. "512Mi" or "2G".
+	Memory string `yaml:"memory,omitempty"`
+	// OpenFiles is the number of file descriptors the plugin may open.
+	OpenFiles uint64 `yaml:"openFiles,omitempty"`
+}
+
+// errResourceLimitsUnsupported is returned where rlimits cannot be applied.
+var errResourceLimitsUnsupported = errors.New("resource limits are only supported on Linux")
+
+func (l ResourceLimits) isZero() bool {
+	return l == ResourceLimits{}
+}
+
+// merge returns l with the limits set in override replacing its own.
+func (l ResourceLimits) merge(override ResourceLimits) ResourceLimits {
+	if override.CPUTime != 0 {
+		l.CPUTime = override.CPUTime
+	}
+	if override.Memory != "" {
+		l.Memory = override.Memory
+	}
+	if override.OpenFiles != 0 {
+		l.OpenFiles = override.OpenFiles
+	}
+	return l
+}
+
+func (l ResourceLimits) validate() error {
+	if l.CPUTime < 0 {
+		return fmt.Errorf("cpuTime must not be negative")
+	}
+	if l.CPUTime != 0 && l.CPUTime < time.Second {
+		return fmt.Errorf("cpuTime %s must be at least 1s", l.CPUTime)
+	}
+	if l.Memory != "" {
+		if _, err := parseByteSize(l.Memory); err != nil {
+			return fmt.Errorf("memory: %w", err)
+		}
+	}
+	return nil
+}
+
+// byteSizeUnits are the suffixes accepted by parseByteSize.
+var byteSizeUnits = []struct {
+	suffix     string
+	multiplier uint64
+}{
+	{"Ki", 1 << 10}, {"Mi", 1 << 20}, {"Gi", 1 << 30}, {"Ti", 1 << 40},
+	{"K", 1e3}, {"M", 1e6}, {"G", 1e9}, {"T", 1e12},
+}
+
+// parseByteSize parses sizes like "1024", "512Mi" or "2G".
+func parseByteSize(size string) (uint64, error) {
+	number, multiplier := strings.TrimSpace(size), uint64(1)
+	for _, unit := range byteSizeUnits {
+		if strings.HasSuffix(number, unit.suffix) {
+			number, multiplier = strings.TrimSuffix(number, unit.suffix), unit.multiplier
+			break
+		}
+	}
+	value, err := strconv.ParseUint(strings.TrimSpace(number), 10, 64)
+	if err != nil || value == 0 {
+		return 0, fmt.Errorf("invalid size %q, use a positive number of bytes with an optional K, M, G, Ki, Mi or Gi suffix", size)
+	}
+	if value > (1<<64-1)/multiplier {
+		return 0, fmt.Errorf("size %q is too large", size)
+	}
+	return value * multiplier, nil
+}
@@ -0,0 +1,28 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+)
+
+// limitCommand returns the command line that runs path with args under
+// limits. The shell sets the rlimits and then replaces itself with the
+// plugin, so they are in place before the plugin's first instruction.
+func limitCommand(path string, args []string, limits ResourceLimits) (string, []string, error) {
+	var script []string
+	if limits.CPUTime > 0 {
+		script = append(script, fmt.Sprintf("ulimit -t %d", int64(limits.CPUTime.Seconds())))
+	}
+	if limits.Memory != "" {
+		bytes, err := parseByteSize(limits.Memory)
+		if err != nil {
+			return "", nil, err
+		}
+		script = append(script, fmt.Sprintf("ulimit -v %d", max(bytes/1024, 1)))
+	}
+	if limits.OpenFiles > 0 {
+		script = append(script, fmt.Sprintf("ulimit -n %d", limits.OpenFiles))
+	}
+	script = append(script, `exec "$0" "$@"`)
+	return "/bin/sh", append([]string{"-c", strings.Join(script, " && "), path}, args...), nil
+}
@@ -0,0 +1,26 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecutePluginAppliesResourceLimits(t *testing.T) {
+	t.Parallel()
+	app, _ := newTestApp()
+	plugin := filepath.Join(t.TempDir(), "awesome-limits")
+	os.WriteFile(plugin, []byte("#!/bin/sh\nulimit -n\nulimit -t\nulimit -v\necho \"$0 $*\"\n"), 0755)
+
+	var stdout bytes.Buffer
+	limits := ResourceLimits{OpenFiles: 64, CPUTime: 2 * time.Minute, Memory: "512Mi"}
+	err := app.executePlugin(context.Background(), plugin, []string{"a b", "c"}, PluginConfig{Limits: limits}, nil, &stdout, &bytes.Buffer{})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "64\n120\n524288\n"+plugin+" a b c\n", stdout.String())
+}
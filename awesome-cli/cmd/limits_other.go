@@ -0,0 +1,7 @@
+//go:build !linux
+
+package cmd
+
+func limitCommand(path string, args []string, limits ResourceLimits) (string, []string, error) {
+	return "", nil, errResourceLimitsUnsupported
+}
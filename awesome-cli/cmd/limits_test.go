@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseByteSize(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		size    string
+		want    uint64
+		wantErr bool
+	}{
+		{"1024", 1024, false},
+		{"512Mi", 512 << 20, false},
+		{"2G", 2e9, false},
+		{" 1 Ki ", 1024, false},
+		{"0", 0, true},
+		{"-1M", 0, true},
+		{"12MB", 0, true},
+		{"99999999999Ti", 0, true},
+	}
+	for _, test := range tests {
+		got, err := parseByteSize(test.size)
+		if test.wantErr {
+			assert.Error(t, err, test.size)
+			continue
+		}
+		assert.NoError(t, err, test.size)
+		assert.Equal(t, test.want, got, test.size)
+	}
+}
+
+func TestPluginConfigOverridesDefaults(t *testing.T) {
+	t.Parallel()
+	config := &Config{
+		PluginTimeout: 10 * time.Minute,
+		PluginLimits:  ResourceLimits{Memory: "1Gi", OpenFiles: 256},
+		Plugins: map[string]PluginConfig{
+			"test": {Timeout: 30 * time.Minute, Limits: ResourceLimits{OpenFiles: 1024}},
+		},
+	}
+
+	assert.Equal(t, PluginConfig{Timeout: 30 * time.Minute, Limits: ResourceLimits{Memory: "1Gi", OpenFiles: 1024}}, config.pluginConfig("test", nil))
+	assert.Equal(t, PluginConfig{Timeout: 10 * time.Minute, Limits: ResourceLimits{Memory: "1Gi", OpenFiles: 256}}, config.pluginConfig("reporter", nil))
+}
+
+func TestPluginSettingsConfig(t *testing.T) {
+	t.Parallel()
+	app, _ := newTestApp()
+	app.Env = MapEnvironment{"AWESOME_CLI_CONFIG": "/etc/awesome.yaml"}
+	load := func(contents string) error {
+		afero.WriteFile(app.Fs, "/etc/awesome.yaml", []byte(contents), 0644)
+		_, err := loadConfig(app.Fs, "/etc/awesome.yaml")
+		return err
+	}
+
+	assert.NoError(t, load("pluginTimeout: 90s\npluginLimits:\n  cpuTime: 5m\n  memory: 512Mi\nplugins:\n  test:\n    timeout: 1h\n"))
+	assert.Equal(t, PluginConfig{Timeout: time.Hour, Limits: ResourceLimits{CPUTime: 5 * time.Minute, Memory: "512Mi"}}, app.pluginSettings("test"))
+	assert.Equal(t, PluginConfig{Timeout: 90 * time.Second, Limits: ResourceLimits{CPUTime: 5 * time.Minute, Memory: "512Mi"}}, app.pluginSettings("reporter"))
+
+	assert.ErrorContains(t, load("pluginLimits:\n  memory: lots\n"), `pluginLimits: memory: invalid size "lots"`)
+	assert.ErrorContains(t, load("pluginLimits:\n  cpuTime: 10ms\n"), "cpuTime 10ms must be at least 1s")
+	assert.ErrorContains(t, load("plugins:\n  test:\n    timeout: -1s\n"), "plugins.test.timeout must not be negative")
+	assert.ErrorContains(t, load("pluginTimeout: soon\n"), "parsing /etc/awesome.yaml")
+}
@@ -2,62 +2,88 @@ package cmd
 
 import (
 	"fmt"
-	"github.com/spf13/cobra"
-	"io/fs"
+	"io"
 	"os"
-)
-
-// FileSystem defines the interface for file system operations needed by listPlugins.
-type FileSystem interface {
-	ReadDir(dirname string) ([]fs.DirEntry, error) // Correct return type
-}
+	"sort"
 
-// OSFileSystem implements FileSystem using the os package.
-type OSFileSystem struct{}
+	"github.com/spf13/afero"
+	"github.com/spf13/cobra"
+)
 
-func (osfs *OSFileSystem) ReadDir(dirname string) ([]fs.DirEntry, error) {
-	return os.ReadDir(dirname) // Correctly returns []fs.DirEntry
+// pluginList is the structured output of the list command.
+type pluginList struct {
+	schemaHeader
+	Plugins []listedPlugin `json:"plugins"`
 }
 
-// fileSystem is the FileSystem to use for reading directories.
-var fileSystem FileSystem = &OSFileSystem{}
-
-// listCmd represents the command to list all plugins.
-var listCmd = &cobra.Command{
-	Use:   "list",
-	Short: "Lists all the available plugins",
-	Long:  `This command lists all the available plugins in the /.foo/plugins directory.`,
-	Run: func(cmd *cobra.Command, args []string) {
-		listPlugins()
-	},
+// listedPlugin is a discovered plugin. Name is the command it is run as.
+type listedPlugin struct {
+	Name     string `json:"name"`
+	FileName string `json:"fileName"`
+	Path     string `json:"path"`
+	Disabled bool   `json:"disabled"`
 }
 
-func init() {
-	rootCmd.AddCommand(listCmd)
+// newListCommand returns the command to list all plugins.
+func (a *App) newListCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "Lists all the available plugins",
+		Long: `This command lists the plugins found in the plugin directories, ~/.foo/plugins
+and those configured with pluginDirs or by the active profile, and on PATH.
+Plugins are listed by the command they are run as.`,
+		Annotations:  map[string]string{structuredOutputAnnotation: "true"},
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return a.listPlugins(cmd.OutOrStdout(), cmd.ErrOrStderr())
+		},
+	}
 }
 
-func listPlugins() {
-	pluginDir := os.Getenv("HOME") + "/.foo/plugins"
-	files, err := fileSystem.ReadDir(pluginDir)
+// listPlugins prints the plugins of the App's registry. A missing plugin
+// directory is only warned about on errW; unlike PATH entries, the plugin
+// directories that exist must be readable.
+func (a *App) listPlugins(w, errW io.Writer) error {
+	config, err := a.config()
 	if err != nil {
-		fmt.Println("Failed to read plugin directory:", err)
-		return
+		config = &Config{}
+	}
+	_, profile, _ := a.activeProfile()
+	for _, dir := range a.pluginDirs(config, profile) {
+		if _, err := afero.ReadDir(a.Fs, dir); os.IsNotExist(err) {
+			fmt.Fprintln(errW, "Warning: plugin directory", dir, "does not exist")
+		} else if err != nil {
+			return fmt.Errorf("failed to read plugin directory: %w", err)
+		}
 	}
 
-	displayPlugins(files)
+	list := pluginList{schemaHeader: schemaHeader{Kind: "PluginList", SchemaVersion: 1}, Plugins: []listedPlugin{}}
+	for _, plugin := range a.Plugins.All() {
+		list.Plugins = append(list.Plugins, listedPlugin{Name: plugin.Name, FileName: plugin.FileName, Path: plugin.Path})
+	}
+	for _, plugin := range a.Plugins.Disabled() {
+		list.Plugins = append(list.Plugins, listedPlugin{Name: plugin.Name, FileName: plugin.FileName, Path: plugin.Path, Disabled: true})
+	}
+	sort.Slice(list.Plugins, func(i, j int) bool { return list.Plugins[i].Name < list.Plugins[j].Name })
+	return a.render(w, list, func() {
+		displayPlugins(w, list.Plugins)
+	})
 }
 
-// displayPlugins prints the names of the files in the plugins directory if any are found.
-func displayPlugins(files []fs.DirEntry) {
-	if len(files) == 0 {
-		fmt.Println("No plugins found.")
+// displayPlugins prints the names of the plugins if any are found, marking
+// the disabled ones.
+func displayPlugins(w io.Writer, plugins []listedPlugin) {
+	if len(plugins) == 0 {
+		fmt.Fprintln(w, "No plugins found.")
 		return
 	}
 
-	fmt.Println("Available plugins:")
-	for _, entry := range files {
-		if !entry.IsDir() { // Check if the entry is a file
-			fmt.Println("  -", entry.Name())
+	fmt.Fprintln(w, "Available plugins:")
+	for _, plugin := range plugins {
+		if plugin.Disabled {
+			fmt.Fprintln(w, "  -", plugin.Name, "(disabled)")
+		} else {
+			fmt.Fprintln(w, "  -", plugin.Name)
 		}
 	}
 }
@@ -1,98 +1,116 @@
 package cmd
 
 import (
-	"github.com/stretchr/testify/assert"
-	"github.com/stretchr/testify/mock"
-	"io"
-	"io/fs"
-	"os"
+	"bytes"
+	"encoding/json"
 	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
 )
 
-// MockFileSystem is a mock type for the FileSystem interface.
-type MockFileSystem struct {
-	mock.Mock
-}
+func TestListPlugins(t *testing.T) {
+	t.Parallel()
+	app, stdout := newTestApp()
+	app.Env = MapEnvironment{"HOME": "/Users/testuser"}
+	afero.WriteFile(app.Fs, "/Users/testuser/.foo/plugins/plugin1.so", []byte{}, 0755)
+	afero.WriteFile(app.Fs, "/Users/testuser/.foo/plugins/awesome-plugin2.sh", []byte{}, 0755)
 
-func (m *MockFileSystem) ReadDir(dirname string) ([]fs.DirEntry, error) {
-	args := m.Called(dirname)
-	return args.Get(0).([]fs.DirEntry), args.Error(1)
-}
+	code := app.Run([]string{"list"})
 
-type mockDirEntry struct {
-	name  string
-	isDir bool
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "Available plugins:\n  - plugin2\n", stdout.String())
 }
 
-func (mde *mockDirEntry) Name() string               { return mde.name }
-func (mde *mockDirEntry) IsDir() bool                { return mde.isDir }
-func (mde *mockDirEntry) Type() fs.FileMode          { return 0 }
-func (mde *mockDirEntry) Info() (fs.FileInfo, error) { return nil, nil }
-
-// captureOutput captures and returns standard output during the call of a provided function.
-func captureOutput(f func()) string {
-	old := os.Stdout // keep backup of the real stdout
-	r, w, _ := os.Pipe()
-	os.Stdout = w
+func TestListPluginsNoPluginsFound(t *testing.T) {
+	t.Parallel()
+	app, stdout := newTestApp()
+	app.Env = MapEnvironment{"HOME": "/Users/testuser"}
+	app.Fs.MkdirAll("/Users/testuser/.foo/plugins", 0755)
 
-	f()
+	code := app.Run([]string{"list"})
 
-	w.Close()
-	out, _ := io.ReadAll(r)
-	os.Stdout = old
-	return string(out)
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "No plugins found.\n", stdout.String())
 }
 
-func TestListPlugins(t *testing.T) {
-	os.Setenv("HOME", "/Users/testuser")
-	fileSystem = new(MockFileSystem)
-	defer func() {
-		fileSystem = &OSFileSystem{}
-		os.Unsetenv("HOME") // Clean up the environment variable after the test
-	}()
-
-	entries := []fs.DirEntry{
-		&mockDirEntry{name: "plugin1.so", isDir: false},
-		&mockDirEntry{name: "plugin2.so", isDir: false},
-	}
+func TestListPluginsMissingDir(t *testing.T) {
+	t.Parallel()
+	app, stdout := newTestApp()
+	app.Env = MapEnvironment{"HOME": "/Users/testuser", "PATH": "/usr/bin"}
+	afero.WriteFile(app.Fs, "/usr/bin/awesome-onpath", []byte{}, 0755)
+	var stderr bytes.Buffer
+	app.Stderr = &stderr
+
+	code := app.Run([]string{"list"})
 
-	fileSystem.(*MockFileSystem).On("ReadDir", "/Users/testuser/.foo/plugins").Return(entries, nil)
-	output := captureOutput(listPlugins)
-	assert.Contains(t, output, "Available plugins:")
-	assert.Contains(t, output, "plugin1.so")
-	assert.Contains(t, output, "plugin2.so")
-	fileSystem.(*MockFileSystem).AssertExpectations(t)
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "Available plugins:\n  - onpath\n", stdout.String())
+	assert.Contains(t, stderr.String(), "Warning: plugin directory /Users/testuser/.foo/plugins does not exist")
 }
 
-func TestListPluginsNoPluginsFound(t *testing.T) {
-	// Set the HOME environment variable to a consistent test value
-	os.Setenv("HOME", "/Users/testuser")
-	defer os.Unsetenv("HOME") // Clean up after the test
+func TestListPluginsReadDirError(t *testing.T) {
+	t.Parallel()
+	for _, output := range []string{"text", "json"} {
+		app, stdout := newTestApp()
+		app.Env = MapEnvironment{"HOME": "/Users/testuser"}
+		afero.WriteFile(app.Fs, "/Users/testuser/.foo/plugins", []byte{}, 0644)
+		var stderr bytes.Buffer
+		app.Stderr = &stderr
+
+		code := app.Run([]string{"list", "--output", output})
+
+		assert.Equal(t, 1, code, output)
+		assert.Empty(t, stdout.String(), output)
+		assert.Contains(t, stderr.String(), "failed to read plugin directory", output)
+	}
+}
 
-	fileSystem = new(MockFileSystem)
-	defer func() { fileSystem = &OSFileSystem{} }() // Reset to original after test
+func TestListCommand(t *testing.T) {
+	t.Parallel()
+	app, stdout := newTestApp()
+	afero.WriteFile(app.Fs, "/home/test/.foo/plugins/awesome-test", []byte{}, 0755)
 
-	fileSystem.(*MockFileSystem).On("ReadDir", "/Users/testuser/.foo/plugins").Return([]fs.DirEntry{}, nil)
+	code := app.Run([]string{"list"})
 
-	output := captureOutput(listPlugins)
-	expectedOutput := "No plugins found.\n"
-	assert.Equal(t, expectedOutput, output)
-	fileSystem.(*MockFileSystem).AssertExpectations(t)
+	assert.Equal(t, 0, code)
+	assert.Contains(t, stdout.String(), "Available plugins:\n  - test\n")
 }
 
-func TestListPluginsReadDirError(t *testing.T) {
-	os.Setenv("HOME", "/Users/testuser")
-	defer os.Unsetenv("HOME")
+func TestListMarksDisabledPlugins(t *testing.T) {
+	t.Parallel()
+	app, stdout := newTestApp()
+	afero.WriteFile(app.Fs, "/home/test/.foo/plugins/awesome-test", []byte{}, 0755)
+	afero.WriteFile(app.Fs, "/home/test/.foo/plugins/awesome-broken", []byte{}, 0755)
+	app.Config = &Config{DisabledPlugins: []string{"broken"}}
 
-	fileSystem = new(MockFileSystem)
-	defer func() { fileSystem = &OSFileSystem{} }()
+	code := app.Run([]string{"list"})
 
-	var nilEntries []fs.DirEntry = nil
-	fileSystem.(*MockFileSystem).On("ReadDir", "/Users/testuser/.foo/plugins").Return(nilEntries, os.ErrNotExist)
+	assert.Equal(t, 0, code)
+	assert.Contains(t, stdout.String(), "Available plugins:\n  - broken (disabled)\n  - test\n")
+}
 
-	output := captureOutput(listPlugins)
+func TestListTextAndJSONAgree(t *testing.T) {
+	t.Parallel()
+	app, stdout := newTestApp()
+	afero.WriteFile(app.Fs, "/home/test/.foo/plugins/awesome-test", []byte{}, 0755)
+	afero.WriteFile(app.Fs, "/opt/team/plugins/team-deploy", []byte{}, 0755)
+	afero.WriteFile(app.Fs, "/usr/bin/awesome-lint", []byte{}, 0755)
+	app.Config = &Config{
+		PluginDirs:        []string{"/opt/team/plugins"},
+		PluginDirPrefixes: map[string][]string{"/opt/team/plugins": {"team-"}},
+	}
 
-	expectedOutput := "Failed to read plugin directory: file does not exist\n"
-	assert.Contains(t, output, expectedOutput)
-	fileSystem.(*MockFileSystem).AssertExpectations(t)
+	assert.Equal(t, 0, app.Run([]string{"list"}))
+	assert.Equal(t, "Available plugins:\n  - deploy\n  - lint\n  - test\n", stdout.String())
+
+	stdout.Reset()
+	assert.Equal(t, 0, app.Run([]string{"list", "--output", "json"}))
+	var list pluginList
+	assert.NoError(t, json.Unmarshal(stdout.Bytes(), &list))
+	assert.Equal(t, []listedPlugin{
+		{Name: "deploy", FileName: "team-deploy", Path: "/opt/team/plugins/team-deploy"},
+		{Name: "lint", FileName: "awesome-lint", Path: "/usr/bin/awesome-lint"},
+		{Name: "test", FileName: "awesome-test", Path: "/home/test/.foo/plugins/awesome-test"},
+	}, list.Plugins)
 }
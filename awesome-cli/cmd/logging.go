@@ -0,0 +1,265 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/spf13/afero"
+)
+
+// Log files are rotated at defaultLogMaxSize unless configured otherwise,
+// keeping defaultLogMaxBackups old files.
+const (
+	defaultLogMaxSize    = 10 << 20
+	defaultLogMaxBackups = 3
+)
+
+// logFormats are the values accepted by --log-format.
+var logFormats = []string{"text", "json"}
+
+func (c LogConfig) validate() error {
+	if c.Level != "" {
+		if _, err := parseLogLevel(c.Level); err != nil {
+			return err
+		}
+	}
+	if err := validateLogFormat(c.Format); err != nil {
+		return err
+	}
+	if c.File != "" && !filepath.IsAbs(c.File) {
+		return fmt.Errorf("file %q must be an absolute path", c.File)
+	}
+	if c.MaxSize != "" {
+		if _, err := parseByteSize(c.MaxSize); err != nil {
+			return fmt.Errorf("maxSize: %w", err)
+		}
+	}
+	if c.MaxBackups < 0 {
+		return errors.New("maxBackups must not be negative")
+	}
+	return nil
+}
+
+func parseLogLevel(level string) (slog.Level, error) {
+	var parsed slog.Level
+	if err := parsed.UnmarshalText([]byte(level)); err != nil {
+		return 0, fmt.Errorf("invalid log level %q, use debug, info, warn or error", level)
+	}
+	return parsed, nil
+}
+
+func validateLogFormat(format string) error {
+	if format != "" && format != "text" && format != "json" {
+		return fmt.Errorf("invalid log format %q, use %s", format, strings.Join(logFormats, " or "))
+	}
+	return nil
+}
+
+// logSettings are the logging flags of an invocation.
+type logSettings struct {
+	// verbosity is the number of times -v was given.
+	verbosity int
+	level     string
+	format    string
+	file      string
+}
+
+// logSettings returns the logging flags of the invocation as parsed.
+func (a *App) logSettings() logSettings {
+	return logSettings{verbosity: a.verbosity, level: a.logLevel, format: a.logFormat, file: a.logFile}
+}
+
+// earlyLogSettings returns the logging flags among the flags found by
+// leadingFlags.
+func earlyLogSettings(flags map[string][]string) logSettings {
+	var settings logSettings
+	for _, value := range flags["verbose"] {
+		if value == "+1" { // The NoOptDefVal of count flags
+			settings.verbosity++
+		} else if count, err := strconv.Atoi(value); err == nil {
+			settings.verbosity = count
+		}
+	}
+	last := func(name string) string {
+		if values := flags[name]; len(values) > 0 {
+			return values[len(values)-1]
+		}
+		return ""
+	}
+	settings.level, settings.format, settings.file = last("log-level"), last("log-format"), last("log-file")
+	return settings
+}
+
+// configureLogging replaces the App's logger with one following settings and
+// the config file. Diagnostics go to stderr, never stdout, and to the log
+// file when one is configured. Without flags or config only warnings and
+// errors are logged; -v adds info and -vv debug messages.
+func (a *App) configureLogging(settings logSettings) error {
+	config, err := a.config()
+	if err != nil {
+		config = &Config{} // Reported by the commands that need the config
+	}
+
+	level := slog.LevelWarn
+	switch {
+	case settings.level != "":
+		if level, err = parseLogLevel(settings.level); err != nil {
+			return err
+		}
+	case settings.verbosity >= 2:
+		level = slog.LevelDebug
+	case settings.verbosity == 1:
+		level = slog.LevelInfo
+	case config.Log.Level != "":
+		level, _ = parseLogLevel(config.Log.Level)
+	}
+	format := settings.format
+	if format == "" {
+		format = config.Log.Format
+	}
+	if err := validateLogFormat(format); err != nil {
+		return err
+	}
+	file := settings.file
+	if file == "" {
+		file = config.Log.File
+	}
+
+	handlers := []slog.Handler{newLogHandler(a.stderr(), format, level, false)}
+	if file != "" {
+		maxSize := uint64(defaultLogMaxSize)
+		if config.Log.MaxSize != "" {
+			maxSize, _ = parseByteSize(config.Log.MaxSize)
+		}
+		maxBackups := config.Log.MaxBackups
+		if maxBackups == 0 {
+			maxBackups = defaultLogMaxBackups
+		}
+		writer := &rotatingFile{fs: a.Fs, path: file, maxSize: int64(maxSize), maxBackups: maxBackups}
+		handlers = append(handlers, newLogHandler(writer, format, level, true))
+	}
+	a.logger = slog.New(fanoutHandler(handlers))
+	return nil
+}
+
+// newLogHandler returns a handler writing records of at least level to w.
+// Text without withTime leaves out the timestamps, which are noise on stderr.
+func newLogHandler(w io.Writer, format string, level slog.Level, withTime bool) slog.Handler {
+	options := &slog.HandlerOptions{Level: level}
+	if format == "json" {
+		return slog.NewJSONHandler(w, options)
+	}
+	if !withTime {
+		options.ReplaceAttr = func(groups []string, attr slog.Attr) slog.Attr {
+			if attr.Key == slog.TimeKey && len(groups) == 0 {
+				return slog.Attr{}
+			}
+			return attr
+		}
+	}
+	return slog.NewTextHandler(w, options)
+}
+
+// log returns the App's logger, logging warnings and errors to stderr until
+// configureLogging has run.
+func (a *App) log() *slog.Logger {
+	if a.logger == nil {
+		a.logger = slog.New(newLogHandler(a.stderr(), "text", slog.LevelWarn, false))
+	}
+	return a.logger
+}
+
+// fanoutHandler sends every record to each of its handlers that accepts it.
+type fanoutHandler []slog.Handler
+
+func (h fanoutHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, handler := range h {
+		if handler.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h fanoutHandler) Handle(ctx context.Context, record slog.Record) error {
+	var errs []error
+	for _, handler := range h {
+		if handler.Enabled(ctx, record.Level) {
+			errs = append(errs, handler.Handle(ctx, record.Clone()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (h fanoutHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make(fanoutHandler, len(h))
+	for i, handler := range h {
+		handlers[i] = handler.WithAttrs(attrs)
+	}
+	return handlers
+}
+
+func (h fanoutHandler) WithGroup(name string) slog.Handler {
+	handlers := make(fanoutHandler, len(h))
+	for i, handler := range h {
+		handlers[i] = handler.WithGroup(name)
+	}
+	return handlers
+}
+
+// rotatingFile appends to the log file at path, first moving it to path.1,
+// path.1 to path.2 and so on when the write would make it larger than
+// maxSize. The file is opened for every write, so nothing needs closing and
+// several awesome-cli processes can share it.
+type rotatingFile struct {
+	fs         afero.Fs
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu sync.Mutex
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if info, err := f.fs.Stat(f.path); err == nil && info.Size() > 0 && info.Size()+int64(len(p)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	if err := f.fs.MkdirAll(filepath.Dir(f.path), 0700); err != nil {
+		return 0, err
+	}
+	file, err := f.fs.OpenFile(f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return 0, err
+	}
+	n, err := file.Write(p)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return n, err
+}
+
+func (f *rotatingFile) rotate() error {
+	backup := func(n int) string { return fmt.Sprintf("%s.%d", f.path, n) }
+	if err := f.fs.Remove(backup(f.maxBackups)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for n := f.maxBackups - 1; n >= 1; n-- {
+		if err := f.fs.Rename(backup(n), backup(n+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return f.fs.Rename(f.path, backup(1))
+}
@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogLevels(t *testing.T) {
+	t.Parallel()
+	for _, tt := range []struct {
+		args     []string
+		config   *Config
+		contains []string
+		excludes []string
+	}{
+		{args: []string{"list"}, excludes: []string{"Skipped disabled plugin", "Loaded plugin"}},
+		{args: []string{"-v", "list"}, contains: []string{"level=INFO msg=\"Skipped disabled plugin\" path=/usr/bin/awesome-broken"}, excludes: []string{"Loaded plugin"}},
+		{args: []string{"-vv", "list"}, contains: []string{"Skipped disabled plugin", "level=DEBUG msg=\"Loaded plugin\" path=/home/test/.foo/plugins/awesome-test"}},
+		{args: []string{"--verbose", "--verbose", "list"}, contains: []string{"Skipped disabled plugin", "Loaded plugin"}},
+		{args: []string{"--log-level", "debug", "list"}, contains: []string{"Loaded plugin"}},
+		{args: []string{"-v=2", "list"}, contains: []string{"Loaded plugin"}},
+		{args: []string{"-vv", "--log-level", "error", "list"}, excludes: []string{"Skipped disabled plugin", "Loaded plugin"}},
+		{args: []string{"list"}, config: &Config{Log: LogConfig{Level: "info"}}, contains: []string{"Skipped disabled plugin"}, excludes: []string{"Loaded plugin"}},
+	} {
+		app, stdout := newTestApp()
+		var stderr bytes.Buffer
+		app.Stderr = &stderr
+		afero.WriteFile(app.Fs, "/home/test/.foo/plugins/awesome-test", []byte{}, 0755)
+		afero.WriteFile(app.Fs, "/usr/bin/awesome-broken", []byte{}, 0755)
+		app.Config = &Config{DisabledPlugins: []string{"broken"}}
+		if tt.config != nil {
+			app.Config = tt.config
+			app.Config.DisabledPlugins = []string{"broken"}
+		}
+
+		assert.Equal(t, 0, app.Run(tt.args), tt.args)
+		assert.Equal(t, "Available plugins:\n  - broken (disabled)\n  - test\n", stdout.String(), tt.args)
+		for _, s := range tt.contains {
+			assert.Contains(t, stderr.String(), s, tt.args)
+		}
+		for _, s := range tt.excludes {
+			assert.NotContains(t, stderr.String(), s, tt.args)
+		}
+		assert.NotContains(t, stderr.String(), "time=", tt.args)
+	}
+}
+
+func TestLogJSONFormat(t *testing.T) {
+	t.Parallel()
+	app, _ := newTestApp()
+	var stderr bytes.Buffer
+	app.Stderr = &stderr
+	afero.WriteFile(app.Fs, "/home/test/.foo/plugins/awesome-test", []byte{}, 0755)
+
+	assert.Equal(t, 0, app.Run([]string{"-vv", "--log-format", "json", "list"}))
+
+	var loaded map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(stderr.String()), "\n") {
+		var record map[string]any
+		assert.NoError(t, json.Unmarshal([]byte(line), &record), line)
+		if record["msg"] == "Loaded plugin" {
+			loaded = record
+		}
+	}
+	assert.Equal(t, "DEBUG", loaded["level"])
+	assert.Equal(t, "/home/test/.foo/plugins/awesome-test", loaded["path"])
+	assert.NotEmpty(t, loaded["time"])
+}
+
+func TestInvalidLogFlags(t *testing.T) {
+	t.Parallel()
+	app, _ := newTestApp()
+	var stderr bytes.Buffer
+	app.Stderr = &stderr
+
+	assert.Equal(t, 1, app.Run([]string{"list", "--log-level", "loud"}))
+	assert.Equal(t, 1, app.Run([]string{"--log-format", "xml", "list"}))
+	assert.Equal(t, "Error: invalid log level \"loud\", use debug, info, warn or error\nError: invalid log format \"xml\", use text or json\n", stderr.String())
+}
+
+func TestLogFile(t *testing.T) {
+	t.Parallel()
+	app, _ := newTestApp()
+	var stderr bytes.Buffer
+	app.Stderr = &stderr
+	afero.WriteFile(app.Fs, "/home/test/.foo/plugins/awesome-test", []byte{}, 0755)
+	app.Config = &Config{Log: LogConfig{File: "/var/log/awesome-cli/awesome-cli.log"}}
+
+	assert.Equal(t, 0, app.Run([]string{"-vv", "list"}))
+
+	log, err := afero.ReadFile(app.Fs, "/var/log/awesome-cli/awesome-cli.log")
+	assert.NoError(t, err)
+	assert.Contains(t, string(log), "time=")
+	assert.Contains(t, string(log), "level=DEBUG msg=\"Loaded plugin\" path=/home/test/.foo/plugins/awesome-test\n")
+	assert.Contains(t, stderr.String(), "level=DEBUG msg=\"Loaded plugin\" path=/home/test/.foo/plugins/awesome-test\n")
+}
+
+func TestRotatingFile(t *testing.T) {
+	t.Parallel()
+	fs := afero.NewMemMapFs()
+	file := &rotatingFile{fs: fs, path: "/logs/cli.log", maxSize: 10, maxBackups: 2}
+
+	for _, line := range []string{"one\n", "two\n", "three\n", "four\n", "five\n", "six\n"} {
+		_, err := file.Write([]byte(line))
+		assert.NoError(t, err)
+	}
+
+	for path, want := range map[string]string{
+		"/logs/cli.log":   "six\n",
+		"/logs/cli.log.1": "four\nfive\n",
+		"/logs/cli.log.2": "three\n",
+	} {
+		got, err := afero.ReadFile(fs, path)
+		assert.NoError(t, err)
+		assert.Equal(t, want, string(got), path)
+	}
+	exists, _ := afero.Exists(fs, "/logs/cli.log.3")
+	assert.False(t, exists)
+}
+
+func TestLogConfigValidation(t *testing.T) {
+	t.Parallel()
+	assert.ErrorContains(t, (&Config{Log: LogConfig{Level: "loud"}}).validate(), `log: invalid log level "loud"`)
+	assert.ErrorContains(t, (&Config{Log: LogConfig{Format: "xml"}}).validate(), `log: invalid log format "xml"`)
+	assert.ErrorContains(t, (&Config{Log: LogConfig{File: "cli.log"}}).validate(), "must be an absolute path")
+	assert.ErrorContains(t, (&Config{Log: LogConfig{MaxSize: "big"}}).validate(), "log: maxSize: invalid size")
+	assert.ErrorContains(t, (&Config{Log: LogConfig{MaxBackups: -1}}).validate(), "maxBackups must not be negative")
+	assert.NoError(t, (&Config{Log: LogConfig{Level: "DEBUG", Format: "json", File: "/var/log/cli.log", MaxSize: "1Mi", MaxBackups: 5}}).validate())
+}
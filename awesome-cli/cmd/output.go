@@ -0,0 +1,183 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// outputFormats are the values accepted by --output.
+var outputFormats = []string{"text", "json", "yaml", "template"}
+
+// outputFormatList describes outputFormats for flag usage and errors.
+func outputFormatList() string {
+	last := len(outputFormats) - 1
+	return strings.Join(outputFormats[:last], ", ") + " or " + outputFormats[last]
+}
+
+// structuredOutputAnnotation marks commands that render their output with
+// App.render and so support every --output format, not just text.
+const structuredOutputAnnotation = "awesome-cli/structured-output"
+
+// schemaHeader starts every json and yaml document. A document's fields are
+// only ever added to within a schema version; renaming or removing one bumps
+// SchemaVersion.
+type schemaHeader struct {
+	Kind          string `json:"kind"`
+	SchemaVersion int    `json:"schemaVersion"`
+}
+
+// renderer writes the output of a command in the format chosen with --output.
+type renderer struct {
+	format   string
+	template *template.Template
+}
+
+// newRenderer validates format and, for the template format, parses text as
+// a Go template. A template given with the default text format selects the
+// template format.
+func newRenderer(format, text string) (*renderer, error) {
+	if format == "" {
+		format = "text"
+	}
+	if text != "" && format == "text" {
+		format = "template"
+	}
+	switch format {
+	case "text", "json", "yaml":
+		if text != "" {
+			return nil, fmt.Errorf("--template cannot be used with --output %s", format)
+		}
+		return &renderer{format: format}, nil
+	case "template":
+		if text == "" {
+			return nil, fmt.Errorf("--output template needs a template, set it with --template")
+		}
+		tmpl, err := template.New("output").Funcs(template.FuncMap{
+			"json": func(v any) (string, error) {
+				data, err := json.Marshal(v)
+				return string(data), err
+			},
+			"join": func(sep string, values []any) string {
+				parts := make([]string, len(values))
+				for i, value := range values {
+					parts[i] = fmt.Sprint(value)
+				}
+				return strings.Join(parts, sep)
+			},
+		}).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("parsing --template: %w", err)
+		}
+		return &renderer{format: format, template: tmpl}, nil
+	default:
+		return nil, fmt.Errorf("unknown output format %q, use %s", format, outputFormatList())
+	}
+}
+
+// render writes doc, a struct starting with a schemaHeader, in the
+// renderer's format, or calls text for the human readable format. yaml and
+// templates see doc as it is encoded to json, so every format shares the
+// same field names.
+func (r *renderer) render(w io.Writer, doc any, text func()) error {
+	if r.format == "text" {
+		text()
+		return nil
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	switch r.format {
+	case "json":
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, data, "", "  "); err != nil {
+			return err
+		}
+		indented.WriteByte('\n')
+		_, err = indented.WriteTo(w)
+		return err
+	case "yaml":
+		// json is yaml, decoding it into a node keeps the field order
+		var node yaml.Node
+		if err := yaml.Unmarshal(data, &node); err != nil {
+			return err
+		}
+		blockStyle(&node)
+		encoder := yaml.NewEncoder(w)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(&node); err != nil {
+			return err
+		}
+		return encoder.Close()
+	default:
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		var value any
+		if err := decoder.Decode(&value); err != nil {
+			return err
+		}
+		var out bytes.Buffer
+		if err := r.template.Execute(&out, value); err != nil {
+			return fmt.Errorf("executing --template: %w", err)
+		}
+		if out.Len() > 0 && !bytes.HasSuffix(out.Bytes(), []byte("\n")) {
+			out.WriteByte('\n')
+		}
+		_, err = out.WriteTo(w)
+		return err
+	}
+}
+
+// blockStyle clears the flow and quoting styles json was parsed with, so the
+// document is written as regular yaml. Strings that need quotes keep them.
+func blockStyle(node *yaml.Node) {
+	node.Style &^= yaml.FlowStyle | yaml.DoubleQuotedStyle
+	for _, child := range node.Content {
+		blockStyle(child)
+	}
+}
+
+// renderer returns the renderer for the --output and --template flags.
+func (a *App) renderer() (*renderer, error) {
+	return newRenderer(a.output, a.outputTemplate)
+}
+
+// outputFormat returns the format chosen with --output, or text when the
+// flags are invalid.
+func (a *App) outputFormat() string {
+	r, err := a.renderer()
+	if err != nil {
+		return "text"
+	}
+	return r.format
+}
+
+// render writes doc in the format chosen with --output, calling text for the
+// text format.
+func (a *App) render(w io.Writer, doc any, text func()) error {
+	r, err := a.renderer()
+	if err != nil {
+		return err
+	}
+	return r.render(w, doc, text)
+}
+
+// checkOutputSupported fails when a format other than text is requested
+// for cmd, which does not render structured output.
+func (a *App) checkOutputSupported(cmd *cobra.Command) error {
+	r, err := a.renderer()
+	if err != nil {
+		return err
+	}
+	if _, ok := cmd.Annotations[structuredOutputAnnotation]; !ok && r.format != "text" {
+		return fmt.Errorf("%s does not support --output %s", cmd.CommandPath(), r.format)
+	}
+	return nil
+}
@@ -0,0 +1,264 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+// schemaOf describes the json document data as sorted "path: type" lines,
+// merging the elements of arrays. kind and schemaVersion are shown with
+// their values, as they identify the schema.
+func schemaOf(t *testing.T, data []byte) []string {
+	t.Helper()
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("output is not json: %v\n%s", err, data)
+	}
+	seen := make(map[string]bool)
+	var walk func(path string, value any)
+	walk = func(path string, value any) {
+		switch value := value.(type) {
+		case map[string]any:
+			for key, child := range value {
+				childPath := key
+				if path != "" {
+					childPath = path + "." + key
+				}
+				walk(childPath, child)
+			}
+			return
+		case []any:
+			seen[path+": array"] = true
+			for _, child := range value {
+				walk(path+"[]", child)
+			}
+			return
+		case string:
+			if path == "kind" {
+				seen[fmt.Sprintf("kind: %q", value)] = true
+				return
+			}
+			seen[path+": string"] = true
+		case float64:
+			if path == "schemaVersion" {
+				seen[fmt.Sprintf("schemaVersion: %v", value)] = true
+				return
+			}
+			seen[path+": number"] = true
+		case bool:
+			seen[path+": bool"] = true
+		default:
+			seen[path+": null"] = true
+		}
+	}
+	walk("", doc)
+	lines := make([]string, 0, len(seen))
+	for line := range seen {
+		lines = append(lines, line)
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+// The schemas below are a contract with scripts parsing awesome-cli's output.
+// Fields may be added to a schema version; any other change needs a new
+// schemaVersion.
+func TestOutputSchemas(t *testing.T) {
+	t.Parallel()
+	app, stdout := newTestApp()
+	afero.WriteFile(app.Fs, "/home/test/.foo/plugins/awesome-test", []byte{}, 0755)
+	afero.WriteFile(app.Fs, "/usr/bin/awesome-broken", []byte{}, 0755)
+	app.Config = &Config{DisabledPlugins: []string{"broken", "gone"}}
+	app.recordHistory([]string{"list"}, 0)
+
+	for _, tt := range []struct {
+		args   []string
+		schema []string
+	}{
+		{[]string{"list"}, []string{
+			`kind: "PluginList"`,
+			"plugins: array",
+			"plugins[].disabled: bool",
+			"plugins[].fileName: string",
+			"plugins[].name: string",
+			"plugins[].path: string",
+			"schemaVersion: 1",
+		}},
+		{[]string{"version", "--plugins"}, []string{
+			"commit: string",
+			"date: string",
+			"goVersion: string",
+			`kind: "Version"`,
+			"platform: string",
+			"plugins: array",
+			"plugins[].name: string",
+			"plugins[].path: string",
+			"plugins[].version: string",
+			"schemaVersion: 1",
+			"version: string",
+		}},
+		{[]string{"history"}, []string{
+			"entries: array",
+			"entries[].args: array",
+			"entries[].args[]: string",
+			"entries[].exitCode: number",
+			"entries[].time: string",
+			`kind: "History"`,
+			"schemaVersion: 1",
+		}},
+		{[]string{"plugin", "status"}, []string{
+			`kind: "PluginStatus"`,
+			"plugins: array",
+			"plugins[].enabled: bool",
+			"plugins[].name: string",
+			"plugins[].path: string",
+			"schemaVersion: 1",
+		}},
+	} {
+		stdout.Reset()
+		assert.Equal(t, 0, app.Run(append(tt.args, "--output", "json")), tt.args)
+		assert.Equal(t, tt.schema, schemaOf(t, stdout.Bytes()), tt.args)
+	}
+}
+
+func TestDoctorOutputSchema(t *testing.T) {
+	t.Parallel()
+	checks := []Check{
+		&stubCheck{name: "First", result: CheckResult{Message: "fine"}},
+		&stubCheck{name: "Second", result: CheckResult{Severity: SeverityWarning, Message: "meh", Remediation: "do something"}},
+	}
+	var out bytes.Buffer
+
+	assert.NoError(t, runDoctor(&out, checks, &renderer{format: "json"}))
+
+	assert.Equal(t, []string{
+		"checks: array",
+		"checks[].message: string",
+		"checks[].name: string",
+		"checks[].remediation: string",
+		"checks[].severity: string",
+		"failed: number",
+		`kind: "DoctorReport"`,
+		"schemaVersion: 1",
+	}, schemaOf(t, out.Bytes()))
+}
+
+func TestEmptyListsAreArrays(t *testing.T) {
+	t.Parallel()
+	app, stdout := newTestApp()
+	app.Fs.MkdirAll("/home/test/.foo/plugins", 0755)
+
+	for _, args := range [][]string{{"list"}, {"history"}, {"plugin", "status"}} {
+		stdout.Reset()
+		assert.Equal(t, 0, app.Run(append(args, "-o", "json")), args)
+		assert.NotContains(t, stdout.String(), "null", args)
+	}
+}
+
+func TestRenderFormats(t *testing.T) {
+	t.Parallel()
+	doc := historyReport{schemaHeader{Kind: "History", SchemaVersion: 1}, []historyEntry{
+		{Args: []string{"version", "--output", "json"}, Time: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), ExitCode: 0},
+		{Args: []string{"doctor"}, Time: time.Date(2024, 5, 1, 12, 5, 0, 0, time.UTC), ExitCode: 1},
+	}}
+
+	for _, tt := range []struct {
+		format, template string
+		want             string
+	}{
+		{"text", "", "human\n"},
+		{"json", "", `{
+  "kind": "History",
+  "schemaVersion": 1,
+  "entries": [
+    {
+      "args": [
+        "version",
+        "--output",
+        "json"
+      ],
+      "time": "2024-05-01T12:00:00Z",
+      "exitCode": 0
+    },
+    {
+      "args": [
+        "doctor"
+      ],
+      "time": "2024-05-01T12:05:00Z",
+      "exitCode": 1
+    }
+  ]
+}
+`},
+		{"yaml", "", `kind: History
+schemaVersion: 1
+entries:
+  - args:
+      - version
+      - --output
+      - json
+    time: "2024-05-01T12:00:00Z"
+    exitCode: 0
+  - args:
+      - doctor
+    time: "2024-05-01T12:05:00Z"
+    exitCode: 1
+`},
+		{"template", `{{range .entries}}{{join " " .args}} {{.exitCode}}{{"\n"}}{{end}}`, "version --output json 0\ndoctor 1\n"},
+		{"", `{{.kind}} v{{.schemaVersion}}`, "History v1\n"},
+		{"template", `{{json (index .entries 1)}}`, `{"args":["doctor"],"exitCode":1,"time":"2024-05-01T12:05:00Z"}` + "\n"},
+	} {
+		r, err := newRenderer(tt.format, tt.template)
+		assert.NoError(t, err, tt.format)
+		var out bytes.Buffer
+		assert.NoError(t, r.render(&out, doc, func() { out.WriteString("human\n") }), tt.format)
+		assert.Equal(t, tt.want, out.String(), tt.format)
+	}
+}
+
+func TestYAMLMatchesJSON(t *testing.T) {
+	t.Parallel()
+	app, stdout := newTestApp()
+
+	assert.Equal(t, 0, app.Run([]string{"version", "-o", "json"}))
+	var fromJSON map[string]any
+	assert.NoError(t, json.Unmarshal(stdout.Bytes(), &fromJSON))
+	stdout.Reset()
+	assert.Equal(t, 0, app.Run([]string{"version", "-o", "yaml"}))
+	var fromYAML map[string]any
+	assert.NoError(t, yaml.Unmarshal(stdout.Bytes(), &fromYAML))
+
+	fromYAML["schemaVersion"] = float64(fromYAML["schemaVersion"].(int))
+	assert.Equal(t, fromJSON, fromYAML)
+}
+
+func TestOutputErrors(t *testing.T) {
+	t.Parallel()
+	for _, tt := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"list", "-o", "xml"}, `Error: unknown output format "xml", use text, json, yaml or template`},
+		{[]string{"list", "-o", "template"}, "Error: --output template needs a template, set it with --template"},
+		{[]string{"list", "-o", "json", "--template", "{{.kind}}"}, "Error: --template cannot be used with --output json"},
+		{[]string{"list", "--template", "{{.kind"}, "Error: parsing --template: template: output:1: unclosed action"},
+		{[]string{"list", "--template", "{{.kind.name}}"}, "Error: executing --template: "},
+		{[]string{"secret", "list", "-o", "json"}, "Error: awesome-cli secret list does not support --output json"},
+	} {
+		app, _ := newTestApp()
+		app.Fs.MkdirAll("/home/test/.foo/plugins", 0755)
+		var stderr bytes.Buffer
+		app.Stderr = &stderr
+
+		assert.Equal(t, 1, app.Run(tt.args), tt.args)
+		assert.Contains(t, stderr.String(), tt.want, tt.args)
+	}
+}
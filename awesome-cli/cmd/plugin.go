@@ -0,0 +1,21 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// newPluginCommand returns the command grouping the plugin management subcommands.
+func (a *App) newPluginCommand() *cobra.Command {
+	pluginCmd := &cobra.Command{
+		Use:   "plugin",
+		Short: "Manages awesome-cli plugins",
+		Long:  `This command groups the subcommands for creating and managing plugins.`,
+	}
+	pluginCmd.AddCommand(
+		a.newPluginNewCommand(),
+		a.newPluginDisableCommand(),
+		a.newPluginEnableCommand(),
+		a.newPluginStatusCommand(),
+	)
+	return pluginCmd
+}
@@ -0,0 +1,209 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// defaultPluginPrefix is the prefix of plugin file names unless other
+// prefixes are configured.
+const defaultPluginPrefix = "awesome-"
+
+// defaultInterpreters run plugin scripts by file extension when the script
+// has no shebang line and no interpreter is configured for the extension.
+var defaultInterpreters = map[string]string{
+	".sh":   "sh",
+	".bash": "bash",
+	".py":   "python3",
+	".rb":   "ruby",
+	".pl":   "perl",
+	".js":   "node",
+}
+
+var scriptExtensionPattern = regexp.MustCompile(`^\.[A-Za-z0-9]+$`)
+
+// cleanPluginDirPrefixes cleans the directories PluginDirPrefixes is keyed
+// by, so /opt/tools/ matches /opt/tools.
+func (c *Config) cleanPluginDirPrefixes() {
+	if len(c.PluginDirPrefixes) == 0 {
+		return
+	}
+	cleaned := make(map[string][]string, len(c.PluginDirPrefixes))
+	for dir, prefixes := range c.PluginDirPrefixes {
+		cleaned[filepath.Clean(dir)] = prefixes
+	}
+	c.PluginDirPrefixes = cleaned
+}
+
+// pluginPrefixes returns the prefixes of plugin file names in dir.
+func (c *Config) pluginPrefixes(dir string) []string {
+	if prefixes, ok := c.PluginDirPrefixes[filepath.Clean(dir)]; ok {
+		return prefixes
+	}
+	if len(c.PluginPrefixes) > 0 {
+		return c.PluginPrefixes
+	}
+	return []string{defaultPluginPrefix}
+}
+
+// allPluginPrefixes returns every prefix plugins may be named with in any
+// directory, sorted.
+func (c *Config) allPluginPrefixes() []string {
+	seen := map[string]bool{defaultPluginPrefix: true}
+	for _, prefix := range c.PluginPrefixes {
+		seen[prefix] = true
+	}
+	for _, prefixes := range c.PluginDirPrefixes {
+		for _, prefix := range prefixes {
+			seen[prefix] = true
+		}
+	}
+	prefixes := make([]string, 0, len(seen))
+	for prefix := range seen {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+	return prefixes
+}
+
+// interpreter returns the configured or default interpreter command line for
+// scripts with extension ext, and whether ext is a script extension at all.
+func (c *Config) interpreter(ext string) (string, bool) {
+	if interpreter, ok := c.Interpreters[ext]; ok {
+		return interpreter, true
+	}
+	interpreter, ok := defaultInterpreters[ext]
+	return interpreter, ok
+}
+
+// pluginName returns the command name of the plugin file called fileName:
+// the file name without the longest of prefixes it starts with and without
+// a script extension. ok is false when fileName has none of the prefixes.
+func (c *Config) pluginName(fileName string, prefixes []string) (name string, ok bool) {
+	matched := ""
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(fileName, prefix) && len(prefix) > len(matched) {
+			matched = prefix
+		}
+	}
+	if matched == "" {
+		return "", false
+	}
+	name = fileName[len(matched):]
+	if ext := filepath.Ext(name); ext != "" {
+		if _, isScript := c.interpreter(ext); isScript {
+			name = strings.TrimSuffix(name, ext)
+		}
+	}
+	return name, name != ""
+}
+
+// commandName turns what a user typed to refer to a plugin, its command or
+// file name, into its command name.
+func (c *Config) commandName(arg string) string {
+	if name, ok := c.pluginName(arg, c.allPluginPrefixes()); ok {
+		return name
+	}
+	return arg
+}
+
+func (c *Config) validatePluginFiles() error {
+	for _, prefix := range c.PluginPrefixes {
+		if err := validatePluginPrefix(prefix); err != nil {
+			return fmt.Errorf("pluginPrefixes: %w", err)
+		}
+	}
+	cleaned := make(map[string]string)
+	for dir, prefixes := range c.PluginDirPrefixes {
+		if !filepath.IsAbs(dir) {
+			return fmt.Errorf("pluginDirPrefixes: directory %q must be an absolute path", dir)
+		}
+		if other, ok := cleaned[filepath.Clean(dir)]; ok {
+			return fmt.Errorf("pluginDirPrefixes: %q and %q are the same directory", min(dir, other), max(dir, other))
+		}
+		cleaned[filepath.Clean(dir)] = dir
+		if len(prefixes) == 0 {
+			return fmt.Errorf("pluginDirPrefixes: %s must list at least one prefix", dir)
+		}
+		for _, prefix := range prefixes {
+			if err := validatePluginPrefix(prefix); err != nil {
+				return fmt.Errorf("pluginDirPrefixes: %s: %w", dir, err)
+			}
+		}
+	}
+	for ext, interpreter := range c.Interpreters {
+		if !scriptExtensionPattern.MatchString(ext) {
+			return fmt.Errorf("interpreters: %q is not a file extension like .py", ext)
+		}
+		if args, err := splitArgs(interpreter); err != nil || len(args) == 0 {
+			return fmt.Errorf("interpreters: %s: %q is not a command line", ext, interpreter)
+		}
+	}
+	return nil
+}
+
+func validatePluginPrefix(prefix string) error {
+	if prefix == "" || strings.ContainsAny(prefix, "/\\ \t") {
+		return fmt.Errorf("invalid prefix %q: it must be part of a file name", prefix)
+	}
+	return nil
+}
+
+// pluginCommand returns the program and arguments that run the plugin at
+// pluginPath with args. Scripts with a known extension are run by the
+// interpreter configured for the extension, the one named in their shebang
+// line or the default for the extension, in that order, so they work without
+// being executable. A bare interpreter name is looked up on the App's PATH.
+// Anything else is executed directly.
+func (a *App) pluginCommand(pluginPath string, args []string) (string, []string, error) {
+	config, err := a.config()
+	if err != nil {
+		config = &Config{}
+	}
+	ext := filepath.Ext(filepath.Base(pluginPath))
+	interpreter, isScript := config.interpreter(ext)
+	if !isScript || ext == "" {
+		return pluginPath, args, nil
+	}
+
+	var argv []string
+	if _, configured := config.Interpreters[ext]; configured {
+		argv, _ = splitArgs(interpreter)
+	} else if shebang := a.readShebang(pluginPath); len(shebang) > 0 {
+		argv = shebang
+	} else {
+		argv = strings.Fields(interpreter)
+	}
+	if len(argv) == 0 {
+		return "", nil, fmt.Errorf("no interpreter for %s", pluginPath)
+	}
+	name := argv[0]
+	if !strings.ContainsRune(name, filepath.Separator) {
+		if name, err = a.lookPath(name); err != nil {
+			return "", nil, fmt.Errorf("interpreter %s for %s not found on PATH", argv[0], pluginPath)
+		}
+	}
+	return name, append(append(argv[1:len(argv):len(argv)], pluginPath), args...), nil
+}
+
+// readShebang returns the interpreter and its arguments from the #! line of
+// the script at path, or nil if it has none.
+func (a *App) readShebang(path string) []string {
+	file, err := a.Fs.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+	line, err := bufio.NewReader(file).ReadString('\n')
+	if err != nil && line == "" {
+		return nil
+	}
+	if !strings.HasPrefix(line, "#!") {
+		return nil
+	}
+	return strings.Fields(line[2:])
+}
@@ -0,0 +1,166 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPluginName(t *testing.T) {
+	t.Parallel()
+	config := &Config{Interpreters: map[string]string{".lua": "lua5.4"}}
+	for _, tt := range []struct {
+		fileName string
+		prefixes []string
+		want     string
+		ok       bool
+	}{
+		{"awesome-deploy", []string{"awesome-"}, "deploy", true},
+		{"acme-deploy", []string{"awesome-", "acme-"}, "deploy", true},
+		{"acme-deploy", []string{"awesome-"}, "", false},
+		{"awesome-acme-deploy", []string{"awesome-", "awesome-acme-"}, "deploy", true},
+		{"awesome-deploy.sh", []string{"awesome-"}, "deploy", true},
+		{"awesome-deploy.py", []string{"awesome-"}, "deploy", true},
+		{"awesome-deploy.lua", []string{"awesome-"}, "deploy", true},
+		{"awesome-deploy.txt", []string{"awesome-"}, "deploy.txt", true},
+		{"awesome-.sh", []string{"awesome-"}, "", false},
+		{"awesome-", []string{"awesome-"}, "", false},
+		{"deploy", []string{"awesome-"}, "", false},
+	} {
+		name, ok := config.pluginName(tt.fileName, tt.prefixes)
+		assert.Equal(t, tt.want, name, tt.fileName)
+		assert.Equal(t, tt.ok, ok, tt.fileName)
+	}
+}
+
+func TestPluginPrefixes(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, []string{"awesome-"}, (&Config{}).pluginPrefixes("/usr/bin"))
+
+	config := &Config{
+		PluginPrefixes:    []string{"awesome-", "team-"},
+		PluginDirPrefixes: map[string][]string{"/opt/acme/bin": {"acme-"}},
+	}
+	assert.Equal(t, []string{"awesome-", "team-"}, config.pluginPrefixes("/usr/bin"))
+	assert.Equal(t, []string{"acme-"}, config.pluginPrefixes("/opt/acme/bin/"))
+	assert.Equal(t, []string{"acme-", "awesome-", "team-"}, config.allPluginPrefixes())
+}
+
+func TestPluginDirPrefixesWithTrailingSlash(t *testing.T) {
+	t.Parallel()
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "/etc/awesome.yaml", []byte("pluginDirPrefixes:\n  /opt/tools/: [tools-]\n"), 0644)
+
+	config, err := loadConfig(fs, "/etc/awesome.yaml")
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"tools-"}, config.pluginPrefixes("/opt/tools"))
+}
+
+func TestPluginDiscoveryWithPrefixes(t *testing.T) {
+	t.Parallel()
+	app, _ := newTestApp()
+	afero.WriteFile(app.Fs, "/home/test/.foo/plugins/awesome-deploy.sh", []byte{}, 0644)
+	afero.WriteFile(app.Fs, "/home/test/.foo/plugins/team-lint", []byte{}, 0755)
+	afero.WriteFile(app.Fs, "/opt/acme/bin/acme-report.py", []byte{}, 0644)
+	afero.WriteFile(app.Fs, "/opt/acme/bin/awesome-ignored", []byte{}, 0755)
+	afero.WriteFile(app.Fs, "/usr/bin/awesome-deploy", []byte{}, 0755)
+	afero.WriteFile(app.Fs, "/usr/bin/acme-ignored", []byte{}, 0755)
+	afero.WriteFile(app.Fs, "/home/test/.foo/config.yaml", []byte(`pluginDirs: [/opt/acme/bin]
+pluginPrefixes: [awesome-, team-]
+pluginDirPrefixes:
+  /opt/acme/bin: [acme-]
+`), 0644)
+
+	root := app.NewRootCommand()
+
+	assert.Equal(t, []string{"deploy", "lint", "report"}, pluginNames(app))
+	plugin, _ := app.Plugins.Get("deploy")
+	assert.Equal(t, "/home/test/.foo/plugins/awesome-deploy.sh", plugin.Path, "earlier directories shadow later ones")
+	assert.Equal(t, "awesome-deploy.sh", plugin.FileName)
+	for _, name := range []string{"deploy", "lint", "report"} {
+		cmd, _, err := root.Find([]string{name})
+		assert.NoError(t, err)
+		assert.Equal(t, name, cmd.Name())
+	}
+}
+
+func TestDisablePluginByFileName(t *testing.T) {
+	t.Parallel()
+	app, stdout := newTestApp()
+	afero.WriteFile(app.Fs, "/usr/bin/acme-report.py", []byte{}, 0644)
+	afero.WriteFile(app.Fs, "/home/test/.foo/config.yaml", []byte("pluginPrefixes: [acme-]\n"), 0644)
+
+	assert.Equal(t, 0, app.Run([]string{"plugin", "disable", "acme-report.py"}))
+	assert.Contains(t, stdout.String(), "Disabled plugin report (/usr/bin/acme-report.py).\n")
+
+	app.NewRootCommand()
+	assert.Empty(t, pluginNames(app))
+	assert.Equal(t, "report", app.Plugins.Disabled()[0].Name)
+}
+
+func TestPluginCommand(t *testing.T) {
+	t.Parallel()
+	for _, tt := range []struct {
+		name     string
+		path     string
+		script   string
+		config   *Config
+		wantName string
+		wantArgs []string
+	}{
+		{"executable", "/p/awesome-deploy", "#!/bin/sh\n", nil, "/p/awesome-deploy", []string{"-x"}},
+		{"unknown extension", "/p/awesome-deploy.txt", "", nil, "/p/awesome-deploy.txt", []string{"-x"}},
+		{"default interpreter", "/p/awesome-deploy.py", "print('hi')\n", nil, "/usr/bin/python3", []string{"/p/awesome-deploy.py", "-x"}},
+		{"shebang", "/p/awesome-deploy.sh", "#!/bin/bash -e\necho hi\n", nil, "/bin/bash", []string{"-e", "/p/awesome-deploy.sh", "-x"}},
+		{"env shebang", "/p/awesome-deploy.py", "#!/usr/bin/env python3.12\n", nil, "/usr/bin/env", []string{"python3.12", "/p/awesome-deploy.py", "-x"}},
+		{"configured", "/p/awesome-deploy.py", "#!/usr/bin/python2\n", &Config{Interpreters: map[string]string{".py": `uv run --python "3.12"`}},
+			"/usr/local/bin/uv", []string{"run", "--python", "3.12", "/p/awesome-deploy.py", "-x"}},
+		{"configured extension", "/p/awesome-deploy.lua", "", &Config{Interpreters: map[string]string{".lua": "lua5.4"}}, "/usr/bin/lua5.4", []string{"/p/awesome-deploy.lua", "-x"}},
+	} {
+		app, _ := newTestApp()
+		app.Config = tt.config
+		if app.Config == nil {
+			app.Config = &Config{}
+		}
+		afero.WriteFile(app.Fs, tt.path, []byte(tt.script), 0644)
+		for _, interpreter := range []string{"/usr/bin/python3", "/usr/local/bin/uv", "/usr/bin/lua5.4"} {
+			afero.WriteFile(app.Fs, interpreter, []byte{}, 0755)
+		}
+
+		name, args, err := app.pluginCommand(tt.path, []string{"-x"})
+
+		assert.NoError(t, err, tt.name)
+		assert.Equal(t, tt.wantName, name, tt.name)
+		assert.Equal(t, tt.wantArgs, args, tt.name)
+	}
+}
+
+func TestPluginCommandInterpreterNotFound(t *testing.T) {
+	t.Parallel()
+	app, _ := newTestApp()
+	app.Config = &Config{}
+	afero.WriteFile(app.Fs, "/p/awesome-deploy.py", []byte("print('hi')\n"), 0644)
+
+	_, _, err := app.pluginCommand("/p/awesome-deploy.py", nil)
+
+	assert.EqualError(t, err, "interpreter python3 for /p/awesome-deploy.py not found on PATH")
+}
+
+func TestPluginFilesConfigValidation(t *testing.T) {
+	t.Parallel()
+	assert.ErrorContains(t, (&Config{PluginPrefixes: []string{"bin/awesome-"}}).validate(), `pluginPrefixes: invalid prefix "bin/awesome-"`)
+	assert.ErrorContains(t, (&Config{PluginPrefixes: []string{""}}).validate(), "pluginPrefixes: invalid prefix")
+	assert.ErrorContains(t, (&Config{PluginDirPrefixes: map[string][]string{"bin": {"acme-"}}}).validate(), "must be an absolute path")
+	assert.ErrorContains(t, (&Config{PluginDirPrefixes: map[string][]string{"/opt/bin": nil}}).validate(), "must list at least one prefix")
+	assert.EqualError(t, (&Config{PluginDirPrefixes: map[string][]string{"/opt/bin": {"acme-"}, "/opt/bin/": {"tools-"}}}).validate(),
+		`pluginDirPrefixes: "/opt/bin" and "/opt/bin/" are the same directory`)
+	assert.ErrorContains(t, (&Config{Interpreters: map[string]string{"py": "python3"}}).validate(), `"py" is not a file extension`)
+	assert.ErrorContains(t, (&Config{Interpreters: map[string]string{".py": " "}}).validate(), "is not a command line")
+	assert.NoError(t, (&Config{
+		PluginPrefixes:    []string{"awesome-", "acme-"},
+		PluginDirPrefixes: map[string][]string{"/opt/bin": {"acme-"}},
+		Interpreters:      map[string]string{".py": "python3 -u"},
+	}).validate())
+}
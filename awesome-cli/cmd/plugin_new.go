@@ -0,0 +1,258 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"embed"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/spf13/afero"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed templates/plugin
+var pluginTemplates embed.FS
+
+// pluginTemplateLayers maps each template to the directories under
+// templates/plugin it is rendered from. Files in later layers win.
+var pluginTemplateLayers = map[string][]string{
+	"go-cobra": {"common", "go", "go-cobra"},
+	"go-flag":  {"common", "go", "go-flag"},
+	"shell":    {"common", "shell"},
+}
+
+// pluginProject is the data the plugin templates are rendered with.
+type pluginProject struct {
+	Name        string
+	Binary      string
+	Module      string
+	Description string
+	Template    string
+}
+
+type newPluginOptions struct {
+	name        string
+	template    string
+	dir         string
+	module      string
+	description string
+	force       bool
+}
+
+var pluginNamePattern = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+
+// modulePathPattern matches the characters Go allows in module paths.
+var modulePathPattern = regexp.MustCompile(`^[A-Za-z0-9._~+/-]+$`)
+
+func (a *App) newPluginNewCommand() *cobra.Command {
+	var opts newPluginOptions
+	newCmd := &cobra.Command{
+		Use:   "new [name]",
+		Short: "Creates a new plugin project from a template",
+		Long: `This command creates a new plugin project with a main, tests, a manifest and a
+build_and_deploy.sh script. Options not given as flags are prompted for when
+running in a terminal.`,
+		Args:         cobra.MaximumNArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) > 0 {
+				opts.name = args[0]
+			}
+			if a.stdinIsTerminal() {
+				if err := promptPluginOptions(cmd, &opts); err != nil {
+					return err
+				}
+			}
+
+			project, err := opts.project()
+			if err != nil {
+				return err
+			}
+			dir := opts.dir
+			if dir == "" {
+				dir = project.Binary
+			}
+			files, err := generatePlugin(a.Fs, dir, project, opts.force)
+			if err != nil {
+				return err
+			}
+
+			out := cmd.OutOrStdout()
+			fmt.Fprintf(out, "Created %s plugin in %s:\n", project.Template, dir)
+			for _, file := range files {
+				fmt.Fprintln(out, "  -", file)
+			}
+			fmt.Fprintf(out, "Run ./build_and_deploy.sh in %s to install it as `awesome-cli %s`.\n", dir, project.Name)
+			return nil
+		},
+	}
+
+	flags := newCmd.Flags()
+	flags.StringVar(&opts.template, "template", "go-cobra", "Project template: go-cobra, go-flag or shell")
+	flags.StringVar(&opts.dir, "dir", "", "Directory to create the project in (default ./awesome-<name>)")
+	flags.StringVar(&opts.module, "module", "", "Go module path (default awesome-<name>)")
+	flags.StringVar(&opts.description, "description", "", "One line description of the plugin")
+	flags.BoolVar(&opts.force, "force", false, "Write into the directory even if it is not empty")
+	return newCmd
+}
+
+// project validates the options and fills in defaults.
+func (o newPluginOptions) project() (pluginProject, error) {
+	name := strings.TrimPrefix(o.name, "awesome-")
+	if !pluginNamePattern.MatchString(name) {
+		return pluginProject{}, fmt.Errorf("invalid plugin name %q: use lowercase letters, digits and dashes", o.name)
+	}
+	if _, ok := pluginTemplateLayers[o.template]; !ok {
+		return pluginProject{}, fmt.Errorf("unknown template %q: choose one of %s", o.template, strings.Join(pluginTemplateNames(), ", "))
+	}
+
+	// The description ends up in Go, YAML and shell sources, where the
+	// templates quote it, except in the script's header comment
+	if strings.ContainsFunc(o.description, unicode.IsControl) {
+		return pluginProject{}, fmt.Errorf("invalid description %q: use a single line of text", o.description)
+	}
+	if o.module != "" && !modulePathPattern.MatchString(o.module) {
+		return pluginProject{}, fmt.Errorf("invalid module path %q", o.module)
+	}
+
+	project := pluginProject{
+		Name:        name,
+		Binary:      "awesome-" + name,
+		Module:      o.module,
+		Description: o.description,
+		Template:    o.template,
+	}
+	if project.Module == "" {
+		project.Module = project.Binary
+	}
+	if project.Description == "" {
+		project.Description = "Runs the " + name + " plugin"
+	}
+	return project, nil
+}
+
+func pluginTemplateNames() []string {
+	names := make([]string, 0, len(pluginTemplateLayers))
+	for name := range pluginTemplateLayers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// promptPluginOptions asks for every option that was not given on the command line.
+func promptPluginOptions(cmd *cobra.Command, opts *newPluginOptions) error {
+	reader := bufio.NewReader(cmd.InOrStdin())
+	out := cmd.OutOrStdout()
+
+	ask := func(question, current string) (string, error) {
+		if current != "" {
+			fmt.Fprintf(out, "%s [%s]: ", question, current)
+		} else {
+			fmt.Fprintf(out, "%s: ", question)
+		}
+		answer, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+		if answer = strings.TrimSpace(answer); answer == "" {
+			return current, nil
+		}
+		return answer, nil
+	}
+
+	var err error
+	if opts.name == "" {
+		if opts.name, err = ask("Plugin name", ""); err != nil {
+			return err
+		}
+	}
+	if !cmd.Flags().Changed("template") {
+		if opts.template, err = ask("Template ("+strings.Join(pluginTemplateNames(), ", ")+")", opts.template); err != nil {
+			return err
+		}
+	}
+	if !cmd.Flags().Changed("description") {
+		if opts.description, err = ask("Description", opts.description); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// generatePlugin renders the project's template into dir and returns the
+// names of the files written.
+func generatePlugin(afs afero.Fs, dir string, project pluginProject, force bool) ([]string, error) {
+	if existing, err := afero.ReadDir(afs, dir); err == nil && len(existing) > 0 && !force {
+		return nil, fmt.Errorf("%s already exists and is not empty, use --force to write into it", dir)
+	}
+
+	// Collect the templates of every layer, letting later layers override earlier ones
+	sources := make(map[string]string)
+	for _, layer := range pluginTemplateLayers[project.Template] {
+		root := path.Join("templates/plugin", layer)
+		err := fs.WalkDir(pluginTemplates, root, func(name string, entry fs.DirEntry, err error) error {
+			if err != nil || entry.IsDir() {
+				return err
+			}
+			sources[strings.TrimPrefix(name, root+"/")] = name
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := afs.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	var written []string
+	for relPath, source := range sources {
+		target := strings.TrimSuffix(relPath, ".tmpl")
+		if target == "binary" {
+			target = project.Binary
+		}
+		if err := renderPluginFile(afs, source, filepath.Join(dir, target), project); err != nil {
+			return nil, err
+		}
+		written = append(written, target)
+	}
+	sort.Strings(written)
+	return written, nil
+}
+
+// pluginTemplateFuncs quote values for the languages of the templates.
+var pluginTemplateFuncs = template.FuncMap{
+	"yaml": func(value string) (string, error) {
+		data, err := yaml.Marshal(value)
+		return strings.TrimSuffix(string(data), "\n"), err
+	},
+}
+
+func renderPluginFile(afs afero.Fs, source, target string, project pluginProject) error {
+	tmpl, err := template.New(path.Base(source)).Funcs(pluginTemplateFuncs).ParseFS(pluginTemplates, source)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, project); err != nil {
+		return fmt.Errorf("rendering %s: %w", source, err)
+	}
+
+	mode := os.FileMode(0644)
+	if strings.HasSuffix(target, ".sh") || filepath.Base(target) == project.Binary {
+		mode = 0755
+	}
+	return afero.WriteFile(afs, target, buf.Bytes(), mode)
+}
@@ -0,0 +1,207 @@
+package cmd
+
+import (
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func TestNewPluginOptionsProject(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    newPluginOptions
+		want    pluginProject
+		wantErr string
+	}{
+		{
+			name: "defaults",
+			opts: newPluginOptions{name: "hello", template: "go-cobra"},
+			want: pluginProject{Name: "hello", Binary: "awesome-hello", Module: "awesome-hello", Description: "Runs the hello plugin", Template: "go-cobra"},
+		},
+		{
+			name: "prefix is trimmed",
+			opts: newPluginOptions{name: "awesome-hello", template: "shell", module: "example.com/hello", description: "Says hello"},
+			want: pluginProject{Name: "hello", Binary: "awesome-hello", Module: "example.com/hello", Description: "Says hello", Template: "shell"},
+		},
+		{
+			name:    "invalid name",
+			opts:    newPluginOptions{name: "Hello World", template: "go-cobra"},
+			wantErr: `invalid plugin name "Hello World"`,
+		},
+		{
+			name:    "multiline description",
+			opts:    newPluginOptions{name: "hello", template: "shell", description: "Says\nhello"},
+			wantErr: `invalid description "Says\nhello"`,
+		},
+		{
+			name:    "invalid module",
+			opts:    newPluginOptions{name: "hello", template: "go-flag", module: "example.com/hello world"},
+			wantErr: `invalid module path "example.com/hello world"`,
+		},
+		{
+			name:    "unknown template",
+			opts:    newPluginOptions{name: "hello", template: "rust"},
+			wantErr: `unknown template "rust": choose one of go-cobra, go-flag, shell`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			project, err := test.opts.project()
+			if test.wantErr != "" {
+				assert.ErrorContains(t, err, test.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, project)
+		})
+	}
+}
+
+func TestGeneratePlugin(t *testing.T) {
+	tests := []struct {
+		template string
+		files    []string
+	}{
+		{"go-cobra", []string{"build_and_deploy.sh", "go.mod", "main.go", "main_test.go", "plugin.yaml"}},
+		{"go-flag", []string{"build_and_deploy.sh", "go.mod", "main.go", "main_test.go", "plugin.yaml"}},
+		{"shell", []string{"awesome-hello", "build_and_deploy.sh", "plugin.yaml"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.template, func(t *testing.T) {
+			fs := afero.NewMemMapFs()
+			project, _ := newPluginOptions{name: "hello", template: test.template}.project()
+
+			files, err := generatePlugin(fs, "/work/awesome-hello", project, false)
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.files, files)
+
+			manifest, _ := afero.ReadFile(fs, "/work/awesome-hello/plugin.yaml")
+			assert.Contains(t, string(manifest), "binary: awesome-hello")
+			assert.Contains(t, string(manifest), "template: "+test.template)
+
+			script, _ := fs.Stat("/work/awesome-hello/build_and_deploy.sh")
+			assert.Equal(t, "-rwxr-xr-x", script.Mode().String())
+		})
+	}
+}
+
+func TestGeneratePluginRendersModule(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	project, _ := newPluginOptions{name: "hello", template: "go-cobra", module: "example.com/hello"}.project()
+
+	_, err := generatePlugin(fs, "/work", project, false)
+
+	assert.NoError(t, err)
+	goMod, _ := afero.ReadFile(fs, "/work/go.mod")
+	assert.True(t, strings.HasPrefix(string(goMod), "module example.com/hello\n"))
+	main, _ := afero.ReadFile(fs, "/work/main.go")
+	assert.Contains(t, string(main), `Use:     "awesome-hello [dir]"`)
+}
+
+func TestGeneratePluginQuotesDescription(t *testing.T) {
+	description := `Say "hi": it's \done #1`
+
+	for _, template := range pluginTemplateNames() {
+		t.Run(template, func(t *testing.T) {
+			fs := afero.NewMemMapFs()
+			project, err := newPluginOptions{name: "hello", template: template, description: description}.project()
+			assert.NoError(t, err)
+
+			files, err := generatePlugin(fs, "/work", project, false)
+			assert.NoError(t, err)
+
+			for _, file := range files {
+				data, _ := afero.ReadFile(fs, "/work/"+file)
+				if strings.HasSuffix(file, ".go") {
+					_, err := parser.ParseFile(token.NewFileSet(), file, data, parser.ParseComments)
+					assert.NoError(t, err, file)
+					formatted, err := format.Source(data)
+					assert.NoError(t, err, file)
+					assert.Equal(t, string(formatted), string(data), "%s is not gofmt'ed", file)
+				}
+			}
+
+			var manifest struct {
+				Name        string `yaml:"name"`
+				Description string `yaml:"description"`
+			}
+			data, _ := afero.ReadFile(fs, "/work/plugin.yaml")
+			assert.NoError(t, yaml.Unmarshal(data, &manifest))
+			assert.Equal(t, "hello", manifest.Name)
+			assert.Equal(t, description, manifest.Description)
+
+			if template == "shell" {
+				script, _ := afero.ReadFile(fs, "/work/awesome-hello")
+				assert.Contains(t, string(script), "\n# "+description+"\n")
+			}
+		})
+	}
+}
+
+func TestGeneratePluginRefusesNonEmptyDir(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "/work/existing.txt", []byte("keep me"), 0644)
+	project, _ := newPluginOptions{name: "hello", template: "shell"}.project()
+
+	_, err := generatePlugin(fs, "/work", project, false)
+	assert.ErrorContains(t, err, "already exists and is not empty")
+
+	_, err = generatePlugin(fs, "/work", project, true)
+	assert.NoError(t, err)
+	kept, _ := afero.ReadFile(fs, "/work/existing.txt")
+	assert.Equal(t, "keep me", string(kept))
+}
+
+func TestPluginNewPrompts(t *testing.T) {
+	t.Parallel()
+	app, stdout := newTestApp()
+	app.Stdin = strings.NewReader("greeter\nshell\nSays hello\n")
+	app.isTerminal = func(any) bool { return true }
+
+	code := app.Run([]string{"plugin", "new", "--dir", "/work/greeter"})
+
+	assert.Equal(t, 0, code)
+	assert.Contains(t, stdout.String(), "Plugin name: ")
+	assert.Contains(t, stdout.String(), "Created shell plugin in /work/greeter")
+	script, _ := afero.ReadFile(app.Fs, "/work/greeter/awesome-greeter")
+	assert.Contains(t, string(script), "# Says hello")
+}
+
+func TestPluginNewDoesNotPromptOnDevNull(t *testing.T) {
+	t.Parallel()
+	devNull, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Skip(err)
+	}
+	defer devNull.Close()
+	app, stdout := newTestApp()
+	app.Stdin = devNull
+
+	assert.False(t, app.stdinIsTerminal(), "%s is a character device, not a terminal", os.DevNull)
+	code := app.Run([]string{"plugin", "new", "hello", "--dir", "/work/hello"})
+
+	assert.Equal(t, 0, code)
+	assert.NotContains(t, stdout.String(), "Template")
+	assert.NotContains(t, stdout.String(), "Description:")
+}
+
+func TestPluginNewWithoutTerminalUsesFlags(t *testing.T) {
+	t.Parallel()
+	app, _ := newTestApp()
+
+	code := app.Run([]string{"plugin", "new", "hello", "--template", "go-flag", "--dir", "/work/hello"})
+
+	assert.Equal(t, 0, code)
+	exists, _ := afero.Exists(app.Fs, "/work/hello/main.go")
+	assert.True(t, exists)
+}
@@ -0,0 +1,186 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+func (a *App) newPluginDisableCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "disable <name>",
+		Short: "Stops a plugin from being loaded without deleting it",
+		Long: `This command disables a plugin by adding it to disabledPlugins in the config
+file. Disabled plugins are not loaded from any directory, including PATH, until
+they are enabled again.`,
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			config, err := a.config()
+			if err != nil {
+				return err
+			}
+			name := config.commandName(args[0])
+			if err := validatePluginName(name); err != nil {
+				return err
+			}
+
+			out := cmd.OutOrStdout()
+			if config.pluginDisabled(name) {
+				fmt.Fprintf(out, "Plugin %s is already disabled.\n", name)
+				return nil
+			}
+			if err := a.setDisabledPlugins(append(config.DisabledPlugins, name)); err != nil {
+				return err
+			}
+			if plugin, found := a.Plugins.Get(name); found {
+				fmt.Fprintf(out, "Disabled plugin %s (%s).\n", name, plugin.Path)
+			} else {
+				fmt.Fprintf(out, "Disabled plugin %s, it is not currently installed.\n", name)
+			}
+			fmt.Fprintf(out, "Run `awesome-cli plugin enable %s` to turn it back on.\n", name)
+			return nil
+		},
+	}
+}
+
+func (a *App) newPluginEnableCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:          "enable <name>",
+		Short:        "Loads a previously disabled plugin again",
+		Long:         `This command removes a plugin from disabledPlugins in the config file.`,
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			config, err := a.config()
+			if err != nil {
+				return err
+			}
+			name := config.commandName(args[0])
+			if !config.pluginDisabled(name) {
+				return fmt.Errorf("plugin %s is not disabled", name)
+			}
+
+			var remaining []string
+			for _, disabled := range config.DisabledPlugins {
+				if disabled != name {
+					remaining = append(remaining, disabled)
+				}
+			}
+			if err := a.setDisabledPlugins(remaining); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Enabled plugin %s.\n", name)
+			return nil
+		},
+	}
+}
+
+func (a *App) newPluginStatusCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "status",
+		Short: "Shows every plugin found and whether it is enabled",
+		Long: `This command lists the plugins found in the plugin directories and on PATH,
+together with the plugins disabled in the config file.`,
+		Args:         cobra.NoArgs,
+		Annotations:  map[string]string{structuredOutputAnnotation: "true"},
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			config, err := a.config()
+			if err != nil {
+				config = &Config{}
+			}
+			out := cmd.OutOrStdout()
+			statuses := pluginStatuses(a.Plugins, config)
+			report := pluginStatusReport{schemaHeader{Kind: "PluginStatus", SchemaVersion: 1}, statuses}
+			return a.render(out, report, func() { displayPluginStatus(out, statuses) })
+		},
+	}
+}
+
+// pluginStatusReport is the structured output of the plugin status command.
+type pluginStatusReport struct {
+	schemaHeader
+	Plugins []pluginStatus `json:"plugins"`
+}
+
+// pluginStatus describes a plugin that was found or is disabled. Path is
+// empty for disabled plugins that are not installed.
+type pluginStatus struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+	Path    string `json:"path,omitempty"`
+}
+
+// pluginStatuses lists the enabled plugins followed by the disabled ones,
+// including disabled plugins that are not installed.
+func pluginStatuses(registry *PluginRegistry, config *Config) []pluginStatus {
+	statuses := []pluginStatus{}
+	for _, plugin := range registry.All() {
+		statuses = append(statuses, pluginStatus{Name: plugin.Name, Enabled: true, Path: plugin.Path})
+	}
+	found := make(map[string]bool)
+	for _, plugin := range registry.Disabled() {
+		found[plugin.Name] = true
+		statuses = append(statuses, pluginStatus{Name: plugin.Name, Path: plugin.Path})
+	}
+	missing := make([]string, 0, len(config.DisabledPlugins))
+	for _, name := range config.DisabledPlugins {
+		if !found[name] {
+			missing = append(missing, name)
+		}
+	}
+	sort.Strings(missing)
+	for _, name := range missing {
+		statuses = append(statuses, pluginStatus{Name: name})
+	}
+	return statuses
+}
+
+// displayPluginStatus prints statuses as a table.
+func displayPluginStatus(w io.Writer, statuses []pluginStatus) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tSTATUS\tPATH")
+	for _, status := range statuses {
+		state, path := "disabled", status.Path
+		if status.Enabled {
+			state = "enabled"
+		}
+		if path == "" {
+			path = "(not installed)"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", status.Name, state, path)
+	}
+	tw.Flush()
+}
+
+// setDisabledPlugins stores names as the disabled plugins in the config file.
+func (a *App) setDisabledPlugins(names []string) error {
+	var value any
+	if len(names) > 0 {
+		sorted := append([]string(nil), names...)
+		sort.Strings(sorted)
+		value = sorted
+	}
+	if err := setConfigValue(a.Fs, a.configPath(), "disabledPlugins", value); err != nil {
+		return err
+	}
+	config, err := loadConfig(a.Fs, a.configPath())
+	if err != nil {
+		return err
+	}
+	a.Config = config
+	return nil
+}
+
+// validatePluginName checks that name can be the command name of a plugin.
+func validatePluginName(name string) error {
+	if name == "" || strings.ContainsAny(name, `/\ `) {
+		return fmt.Errorf("invalid plugin name %q", name)
+	}
+	return nil
+}
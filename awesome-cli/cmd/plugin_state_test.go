@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPluginDisableAndEnable(t *testing.T) {
+	t.Parallel()
+	app, stdout := newTestApp()
+	afero.WriteFile(app.Fs, "/usr/bin/awesome-broken", []byte{}, 0755)
+	afero.WriteFile(app.Fs, "/home/test/.foo/config.yaml", []byte("# Team settings\nminVersion: v1.0.0 # keep in sync\n"), 0644)
+
+	code := app.Run([]string{"plugin", "disable", "awesome-broken"})
+
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "Disabled plugin broken (/usr/bin/awesome-broken).\nRun `awesome-cli plugin enable broken` to turn it back on.\n", stdout.String())
+	config, _ := afero.ReadFile(app.Fs, "/home/test/.foo/config.yaml")
+	assert.Equal(t, "# Team settings\nminVersion: v1.0.0 # keep in sync\ndisabledPlugins:\n  - broken\n", string(config))
+
+	app.NewRootCommand()
+	assert.Empty(t, pluginNames(app))
+	assert.Equal(t, []Plugin{{Name: "broken", FileName: "awesome-broken", Path: "/usr/bin/awesome-broken"}}, app.Plugins.Disabled())
+	assert.Equal(t, 1, app.Run([]string{"broken"}))
+
+	stdout.Reset()
+	assert.Equal(t, 0, app.Run([]string{"plugin", "enable", "broken"}))
+	assert.Equal(t, "Enabled plugin broken.\n", stdout.String())
+	config, _ = afero.ReadFile(app.Fs, "/home/test/.foo/config.yaml")
+	assert.Equal(t, "# Team settings\nminVersion: v1.0.0 # keep in sync\n", string(config))
+	app.NewRootCommand()
+	assert.Equal(t, []string{"broken"}, pluginNames(app))
+}
+
+func TestPluginEnableNotDisabled(t *testing.T) {
+	t.Parallel()
+	app, _ := newTestApp()
+	var stderr bytes.Buffer
+	app.Stderr = &stderr
+
+	assert.Equal(t, 1, app.Run([]string{"plugin", "enable", "hello"}))
+	assert.Equal(t, "Error: plugin hello is not disabled\n", stderr.String())
+}
+
+func TestPluginStatusWithName(t *testing.T) {
+	t.Parallel()
+	app, stdout := newTestApp()
+	var stderr bytes.Buffer
+	app.Stderr = &stderr
+
+	assert.Equal(t, 1, app.Run([]string{"plugin", "status", "hello"}))
+	assert.Empty(t, stdout.String(), "no usage text")
+	assert.Equal(t, "Error: unknown command \"hello\" for \"awesome-cli plugin status\"\n", stderr.String())
+}
+
+func TestDisabledPluginIsSkippedInEveryDirectory(t *testing.T) {
+	t.Parallel()
+	app, _ := newTestApp()
+	afero.WriteFile(app.Fs, "/home/test/.foo/plugins/awesome-test", []byte{}, 0755)
+	afero.WriteFile(app.Fs, "/usr/bin/awesome-test", []byte{}, 0755)
+	afero.WriteFile(app.Fs, "/usr/bin/awesome-reporter", []byte{}, 0755)
+	app.Config = &Config{DisabledPlugins: []string{"test", "gone"}}
+
+	app.NewRootCommand()
+
+	assert.Equal(t, []string{"reporter"}, pluginNames(app))
+	var out bytes.Buffer
+	displayPluginStatus(&out, pluginStatuses(app.Plugins, app.Config))
+	assert.Equal(t, ""+
+		"NAME      STATUS    PATH\n"+
+		"reporter  enabled   /usr/bin/awesome-reporter\n"+
+		"test      disabled  /home/test/.foo/plugins/awesome-test\n"+
+		"gone      disabled  (not installed)\n", out.String())
+}
+
+func TestSetConfigValue(t *testing.T) {
+	t.Parallel()
+	fs := afero.NewMemMapFs()
+
+	assert.NoError(t, setConfigValue(fs, "/etc/awesome/config.yaml", "disabledPlugins", []string{"a", "b"}))
+	data, _ := afero.ReadFile(fs, "/etc/awesome/config.yaml")
+	assert.Equal(t, "disabledPlugins:\n  - a\n  - b\n", string(data))
+
+	assert.NoError(t, setConfigValue(fs, "/etc/awesome/config.yaml", "minVersion", "v2.0.0"))
+	assert.NoError(t, setConfigValue(fs, "/etc/awesome/config.yaml", "disabledPlugins", nil))
+	data, _ = afero.ReadFile(fs, "/etc/awesome/config.yaml")
+	assert.Equal(t, "minVersion: v2.0.0\n", string(data))
+
+	afero.WriteFile(fs, "/etc/awesome/list.yaml", []byte("- a\n"), 0644)
+	assert.ErrorContains(t, setConfigValue(fs, "/etc/awesome/list.yaml", "minVersion", "v2.0.0"), "expected a mapping")
+}
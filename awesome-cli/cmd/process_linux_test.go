@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// processRunning reports whether pid is running, zombies waiting for a
+// parent to reap them not counting.
+func processRunning(pid int) bool {
+	stat, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return false
+	}
+	// The state follows the parenthesized command name
+	fields := strings.Fields(string(stat[bytes.LastIndexByte(stat, ')')+1:]))
+	return len(fields) > 0 && fields[0] != "Z"
+}
+
+func TestExecutePluginTimeoutStopsChildren(t *testing.T) {
+	t.Parallel()
+	app, _ := newTestApp()
+	app.terminateGrace = 200 * time.Millisecond
+	dir := t.TempDir()
+	pidFile := filepath.Join(dir, "sleep.pid")
+	plugin := filepath.Join(dir, "awesome-spawn")
+	// The sleep ignores SIGTERM and keeps the output pipe open
+	os.WriteFile(plugin, []byte("#!/bin/sh\nsh -c \"trap '' TERM; exec sleep 30\" &\necho $! > "+pidFile+"\nwait\n"), 0755)
+
+	var stdout, stderr bytes.Buffer
+	started := time.Now()
+	err := app.executePlugin(context.Background(), plugin, nil, PluginConfig{Timeout: 100 * time.Millisecond}, nil, &stdout, &stderr)
+
+	assert.Equal(t, &exitError{code: timeoutExitCode}, err)
+	assert.Less(t, time.Since(started), 3*time.Second)
+	data, _ := os.ReadFile(pidFile)
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	assert.NoError(t, err)
+	deadline := time.Now().Add(2 * time.Second)
+	for processRunning(pid) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.False(t, processRunning(pid), "sleep started by the plugin is still running")
+}
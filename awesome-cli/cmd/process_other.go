@@ -0,0 +1,13 @@
+//go:build !unix
+
+package cmd
+
+import "os/exec"
+
+// startProcessGroup makes cancelling cmd kill its process. Without process
+// groups to signal, the programs it started keep running.
+func startProcessGroup(cmd *exec.Cmd) {
+	cmd.Cancel = func() error { return cmd.Process.Kill() }
+}
+
+func killProcessGroup(cmd *exec.Cmd) {}
@@ -0,0 +1,210 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// anyProfileAnnotation marks commands that run even when the selected profile
+// is not defined, so it can be fixed with them.
+const anyProfileAnnotation = "awesome-cli/any-profile"
+
+// newProfileCommand returns the command grouping the profile subcommands.
+func (a *App) newProfileCommand() *cobra.Command {
+	profileCmd := &cobra.Command{
+		Use:   "profile",
+		Short: "Switches between named sets of settings",
+		Long: `This command groups the subcommands managing profiles. A profile bundles
+environment variables, plugin directories, secrets and per-plugin settings,
+for example for a team or an environment:
+
+  profiles:
+    staging:
+      env:
+        DEPLOY_ENV: staging
+      pluginDirs:
+        - /opt/staging/plugins
+      secrets:
+        GITHUB_TOKEN: staging-github-token
+      plugins:
+        deploy:
+          args: [--region, eu-west-1]
+
+The profile set with "profile use" is active until another one is chosen.
+--profile or ` + envProfile + ` select a profile for a single invocation. Plugins
+see the name of the active profile in ` + envProfile + `.`,
+		Annotations: map[string]string{anyProfileAnnotation: "true"},
+	}
+	profileCmd.AddCommand(
+		a.newProfileUseCommand(),
+		a.newProfileListCommand(),
+		a.newProfileClearCommand(),
+	)
+	return profileCmd
+}
+
+func (a *App) newProfileUseCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:          "use <name>",
+		Short:        "Makes a profile the active one",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			config, err := a.config()
+			if err != nil {
+				return err
+			}
+			name := args[0]
+			if _, ok := config.Profiles[name]; !ok {
+				return fmt.Errorf("profile %q is not defined in %s", name, a.configPath())
+			}
+			if err := a.setActiveProfile(name); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Using profile %s.\n", name)
+			return nil
+		},
+	}
+}
+
+func (a *App) newProfileListCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:          "list",
+		Short:        "Lists the profiles, marking the active one",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			config, err := a.config()
+			if err != nil {
+				return err
+			}
+			active, _, _ := a.activeProfile()
+			displayProfiles(cmd.OutOrStdout(), config.Profiles, active)
+			return nil
+		},
+	}
+}
+
+func (a *App) newProfileClearCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:          "clear",
+		Short:        "Stops using a profile by default",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := a.setActiveProfile(""); err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), "No profile is active by default now.")
+			return nil
+		},
+	}
+}
+
+// displayProfiles prints the profile names with a summary of their settings,
+// marking active with an asterisk.
+func displayProfiles(w io.Writer, profiles map[string]Profile, active string) {
+	if len(profiles) == 0 {
+		fmt.Fprintln(w, "No profiles configured.")
+		return
+	}
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		marker := " "
+		if name == active {
+			marker = "*"
+		}
+		profile := profiles[name]
+		var summary []string
+		for _, part := range []struct {
+			count int
+			noun  string
+		}{
+			{len(profile.Env), "env var"},
+			{len(profile.PluginDirs), "plugin dir"},
+			{len(profile.Secrets), "secret"},
+			{len(profile.Plugins), "plugin"},
+		} {
+			if part.count == 1 {
+				summary = append(summary, "1 "+part.noun)
+			} else if part.count > 1 {
+				summary = append(summary, fmt.Sprintf("%d %ss", part.count, part.noun))
+			}
+		}
+		if len(summary) > 0 {
+			fmt.Fprintf(w, "%s %s (%s)\n", marker, name, strings.Join(summary, ", "))
+		} else {
+			fmt.Fprintf(w, "%s %s\n", marker, name)
+		}
+	}
+}
+
+// runsWithAnyProfile reports whether cmd or one of its parents is marked with
+// anyProfileAnnotation.
+func runsWithAnyProfile(cmd *cobra.Command) bool {
+	for c := cmd; c != nil; c = c.Parent() {
+		if c.Annotations[anyProfileAnnotation] != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// activeProfile returns the profile selected with --profile, the
+// AWESOME_CLI_PROFILE environment variable or the config file, in that order.
+// The profile is nil when none is selected.
+func (a *App) activeProfile() (string, *Profile, error) {
+	return a.selectProfile(a.profile)
+}
+
+// selectProfile is activeProfile with flag as the --profile flag.
+func (a *App) selectProfile(flag string) (string, *Profile, error) {
+	name := flag
+	if name == "" {
+		name = a.Env.Getenv(envProfile)
+	}
+	config, err := a.config()
+	if err != nil {
+		if name == "" {
+			return "", nil, nil // The config error is reported where the config is needed
+		}
+		return name, nil, err
+	}
+	if name == "" {
+		name = config.Profile
+	}
+	if name == "" {
+		return "", nil, nil
+	}
+	profile, ok := config.Profiles[name]
+	if !ok {
+		return name, nil, fmt.Errorf("profile %q is not defined in %s", name, a.configPath())
+	}
+	return name, &profile, nil
+}
+
+// setActiveProfile writes name as the active profile to the config file, or
+// removes the active profile when name is empty.
+func (a *App) setActiveProfile(name string) error {
+	var value any
+	if name != "" {
+		value = name
+	}
+	if err := setConfigValue(a.Fs, a.configPath(), "profile", value); err != nil {
+		return err
+	}
+	config, err := loadConfig(a.Fs, a.configPath())
+	if err != nil {
+		return err
+	}
+	a.Config = config
+	return nil
+}
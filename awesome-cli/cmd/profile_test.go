@@ -0,0 +1,158 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProfileUseListAndClear(t *testing.T) {
+	t.Parallel()
+	app, stdout := newTestApp()
+	afero.WriteFile(app.Fs, "/home/test/.foo/config.yaml", []byte("# Team settings\nprofiles:\n  staging:\n    env:\n      DEPLOY_ENV: staging\n  prod: {}\n"), 0644)
+
+	assert.Equal(t, 0, app.Run([]string{"profile", "use", "staging"}))
+	assert.Equal(t, "Using profile staging.\n", stdout.String())
+	config, _ := afero.ReadFile(app.Fs, "/home/test/.foo/config.yaml")
+	assert.Equal(t, "# Team settings\nprofiles:\n  staging:\n    env:\n      DEPLOY_ENV: staging\n  prod: {}\nprofile: staging\n", string(config))
+
+	stdout.Reset()
+	assert.Equal(t, 0, app.Run([]string{"profile", "list"}))
+	assert.Equal(t, "  prod\n* staging (1 env var)\n", stdout.String())
+
+	stdout.Reset()
+	assert.Equal(t, 0, app.Run([]string{"--profile", "prod", "profile", "list"}))
+	assert.Equal(t, "* prod\n  staging (1 env var)\n", stdout.String())
+
+	stdout.Reset()
+	assert.Equal(t, 0, app.Run([]string{"profile", "clear"}))
+	assert.Equal(t, "No profile is active by default now.\n", stdout.String())
+	config, _ = afero.ReadFile(app.Fs, "/home/test/.foo/config.yaml")
+	assert.Equal(t, "# Team settings\nprofiles:\n  staging:\n    env:\n      DEPLOY_ENV: staging\n  prod: {}\n", string(config))
+}
+
+func TestProfileUseUnknown(t *testing.T) {
+	t.Parallel()
+	app, _ := newTestApp()
+	var stderr bytes.Buffer
+	app.Stderr = &stderr
+	app.Config = &Config{Profiles: map[string]Profile{"staging": {}}}
+
+	assert.Equal(t, 1, app.Run([]string{"profile", "use", "qa"}))
+	assert.Equal(t, "Error: profile \"qa\" is not defined in /home/test/.foo/config.yaml\n", stderr.String())
+}
+
+func TestProfileCommandsWorkWithUndefinedProfile(t *testing.T) {
+	t.Parallel()
+	app, stdout := newTestApp()
+	var stderr bytes.Buffer
+	app.Stderr = &stderr
+	app.Env.(MapEnvironment)["AWESOME_CLI_PROFILE"] = "qa"
+	afero.WriteFile(app.Fs, "/home/test/.foo/config.yaml", []byte("profiles:\n  staging: {}\nprofile: staging\n"), 0644)
+
+	assert.Equal(t, 1, app.Run([]string{"version"}))
+	assert.Contains(t, stderr.String(), `Error: profile "qa" is not defined`)
+
+	stderr.Reset()
+	assert.Equal(t, 0, app.Run([]string{"profile", "list"}))
+	assert.Equal(t, "  staging\n", stdout.String(), "qa is active, but not listed")
+	assert.Contains(t, stderr.String(), `Warning: profile "qa" is not defined`)
+
+	stdout.Reset()
+	assert.Equal(t, 0, app.Run([]string{"profile", "clear"}))
+	assert.Equal(t, "No profile is active by default now.\n", stdout.String())
+	config, _ := afero.ReadFile(app.Fs, "/home/test/.foo/config.yaml")
+	assert.Equal(t, "profiles:\n  staging: {}\n", string(config))
+}
+
+func TestProfileCommandsWorkWithUndefinedConfigProfile(t *testing.T) {
+	t.Parallel()
+	app, stdout := newTestApp()
+	var stderr bytes.Buffer
+	app.Stderr = &stderr
+	afero.WriteFile(app.Fs, "/home/test/.foo/config.yaml", []byte("profiles:\n  staging: {}\nprofile: qa\n"), 0644)
+
+	assert.Equal(t, 0, app.Run([]string{"profile", "list"}))
+	assert.Equal(t, "  staging\n", stdout.String())
+	assert.Contains(t, stderr.String(), `Warning: profile "qa" is not defined in /home/test/.foo/config.yaml`)
+
+	stderr.Reset()
+	assert.Equal(t, 1, app.Run([]string{"version"}))
+	assert.Contains(t, stderr.String(), `Error: profile "qa" is not defined in /home/test/.foo/config.yaml`)
+
+	stdout.Reset()
+	assert.Equal(t, 0, app.Run([]string{"profile", "use", "staging"}))
+	assert.Equal(t, "Using profile staging.\n", stdout.String())
+}
+
+func TestActiveProfilePrecedence(t *testing.T) {
+	t.Parallel()
+	app, _ := newTestApp()
+	app.Config = &Config{Profile: "dev", Profiles: map[string]Profile{"dev": {}, "staging": {}, "prod": {}}}
+
+	name, profile, err := app.activeProfile()
+	assert.NoError(t, err)
+	assert.Equal(t, "dev", name)
+	assert.NotNil(t, profile)
+
+	app.Env.(MapEnvironment)["AWESOME_CLI_PROFILE"] = "staging"
+	name, _, _ = app.activeProfile()
+	assert.Equal(t, "staging", name)
+
+	app.profile = "prod"
+	name, _, _ = app.activeProfile()
+	assert.Equal(t, "prod", name)
+}
+
+func TestProfilePluginSettings(t *testing.T) {
+	t.Parallel()
+	config := &Config{
+		PluginTimeout: time.Hour,
+		Plugins: map[string]PluginConfig{
+			"deploy": {Secrets: map[string]string{"GITHUB_TOKEN": "github-token", "NPM_TOKEN": "npm-token"}},
+		},
+	}
+	profile := &Profile{
+		Secrets: map[string]string{"GITHUB_TOKEN": "staging-github-token"},
+		Plugins: map[string]PluginConfig{
+			"deploy": {Timeout: time.Minute, Args: []string{"--region", "eu"}},
+		},
+	}
+
+	assert.Equal(t, PluginConfig{
+		Timeout: time.Minute,
+		Args:    []string{"--region", "eu"},
+		Secrets: map[string]string{"GITHUB_TOKEN": "staging-github-token", "NPM_TOKEN": "npm-token"},
+	}, config.pluginConfig("deploy", profile))
+	assert.Equal(t, PluginConfig{Timeout: time.Hour, Secrets: map[string]string{"GITHUB_TOKEN": "github-token", "NPM_TOKEN": "npm-token"}}, config.pluginConfig("deploy", nil))
+}
+
+func TestProfileConfigValidation(t *testing.T) {
+	t.Parallel()
+	assert.NoError(t, (&Config{Profile: "qa"}).validate(), "an undefined profile is reported by activeProfile")
+	assert.ErrorContains(t, (&Config{Profiles: map[string]Profile{"Staging": {}}}).validate(), `invalid profile name "Staging"`)
+	assert.ErrorContains(t, (&Config{Profiles: map[string]Profile{"staging": {PluginDirs: []string{"plugins"}}}}).validate(), "must be an absolute path")
+	assert.ErrorContains(t, (&Config{Profiles: map[string]Profile{"staging": {Env: map[string]string{"DEPLOY-ENV": "x"}}}}).validate(), `profiles.staging.env: "DEPLOY-ENV" is not a valid environment variable name`)
+	assert.ErrorContains(t, (&Config{Profiles: map[string]Profile{"staging": {Secrets: map[string]string{"TOKEN": "my token"}}}}).validate(), `invalid secret name "my token"`)
+	assert.ErrorContains(t, (&Config{Profiles: map[string]Profile{"staging": {Plugins: map[string]PluginConfig{"deploy": {Timeout: -time.Second}}}}}).validate(), "profiles.staging.plugins.deploy.timeout must not be negative")
+}
+
+func TestProfilePluginDirsShadowDefaultDir(t *testing.T) {
+	t.Parallel()
+	app, _ := newTestApp()
+	afero.WriteFile(app.Fs, "/home/test/.foo/plugins/awesome-deploy", []byte{}, 0755)
+	afero.WriteFile(app.Fs, "/opt/staging/awesome-deploy", []byte{}, 0755)
+	app.Config = &Config{Profiles: map[string]Profile{"staging": {PluginDirs: []string{"/opt/staging"}}}}
+
+	app.NewRootCommand()
+	plugin, _ := app.Plugins.Get("deploy")
+	assert.Equal(t, "/home/test/.foo/plugins/awesome-deploy", plugin.Path)
+
+	app.Config.Profile = "staging"
+	app.NewRootCommand()
+	plugin, _ = app.Plugins.Get("deploy")
+	assert.Equal(t, "/opt/staging/awesome-deploy", plugin.Path, "profile plugins shadow the default directory")
+}
@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactEnv(t *testing.T) {
+	t.Parallel()
+	env := []string{
+		"PATH=/usr/bin", "GITHUB_TOKEN=ghp_123", "db_password=hunter2", "AWS_SECRET_ACCESS_KEY=abc", "EMPTY=",
+		"DATABASE_URL=postgres://app:pw@db:5432/app", "MIRRORS=https://ghp_456@example.com/a https://example.com/b",
+		"HOMEPAGE=https://example.com/@team",
+	}
+
+	assert.Equal(t, []string{
+		"AWS_SECRET_ACCESS_KEY=[REDACTED]",
+		"DATABASE_URL=postgres://[REDACTED]@db:5432/app",
+		"EMPTY=",
+		"GITHUB_TOKEN=[REDACTED]",
+		"HOMEPAGE=https://example.com/@team",
+		"MIRRORS=https://[REDACTED]@example.com/a https://example.com/b",
+		"PATH=/usr/bin",
+		"db_password=[REDACTED]",
+	}, redactEnv(env))
+}
+
+func TestSessionRecorderRoundTrip(t *testing.T) {
+	t.Parallel()
+	app, _ := newTestApp()
+	now := time.Date(2024, 8, 1, 9, 30, 0, 0, time.UTC)
+	app.now = func() time.Time { return now }
+	recorder := app.newSessionRecorder("test", "/usr/bin/awesome-test", []string{"--team", "abc"}, []string{"API_TOKEN=xyz", "HOME=/home/test"})
+
+	var stdout, stderr bytes.Buffer
+	now = now.Add(100 * time.Millisecond)
+	recorder.stream("stdout", &stdout).Write([]byte("running\n"))
+	now = now.Add(time.Second)
+	recorder.stream("stderr", &stderr).Write([]byte("failed\n"))
+	now = now.Add(50 * time.Millisecond)
+	assert.NoError(t, recorder.save(app.Fs, "/tmp/session.json.gz", &exitError{code: 3}))
+
+	assert.Equal(t, "running\n", stdout.String(), "output is passed through")
+	assert.Equal(t, "failed\n", stderr.String())
+	info, err := app.Fs.Stat("/tmp/session.json.gz")
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm(), "recordings are private")
+	recording, err := loadRecording(app.Fs, "/tmp/session.json.gz")
+	assert.NoError(t, err)
+	assert.Equal(t, &sessionRecording{
+		Version:     sessionFormatVersion,
+		Plugin:      "test",
+		Path:        "/usr/bin/awesome-test",
+		Args:        []string{"--team", "abc"},
+		Env:         []string{"API_TOKEN=[REDACTED]", "HOME=/home/test"},
+		HostVersion: currentBuildInfo().Version,
+		Platform:    currentBuildInfo().Platform,
+		Started:     time.Date(2024, 8, 1, 9, 30, 0, 0, time.UTC),
+		Duration:    1150 * time.Millisecond,
+		ExitCode:    3,
+		Events: []sessionEvent{
+			{Offset: 100 * time.Millisecond, Stream: "stdout", Data: "running\n"},
+			{Offset: 1100 * time.Millisecond, Stream: "stderr", Data: "failed\n"},
+		},
+	}, recording)
+}
+
+func TestLoadRecordingErrors(t *testing.T) {
+	t.Parallel()
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, "/plain.txt", []byte("hello"), 0644)
+	var future bytes.Buffer
+	compressed := gzip.NewWriter(&future)
+	json.NewEncoder(compressed).Encode(sessionRecording{Version: 99})
+	compressed.Close()
+	afero.WriteFile(fs, "/future.json.gz", future.Bytes(), 0644)
+
+	_, err := loadRecording(fs, "/plain.txt")
+	assert.ErrorContains(t, err, "/plain.txt is not a recording")
+	_, err = loadRecording(fs, "/future.json.gz")
+	assert.EqualError(t, err, "/future.json.gz is a version 99 recording, this awesome-cli reads version 1")
+}
+
+func TestReplaySession(t *testing.T) {
+	t.Parallel()
+	recording := &sessionRecording{
+		Plugin:      "test",
+		Args:        []string{"--team", "abc"},
+		Env:         []string{"HOME=/home/test"},
+		HostVersion: "v1.2.0",
+		Platform:    "linux/amd64",
+		Started:     time.Date(2024, 8, 1, 9, 30, 0, 0, time.UTC),
+		Duration:    2500 * time.Millisecond,
+		ExitCode:    3,
+		Events: []sessionEvent{
+			{Offset: 100 * time.Millisecond, Stream: "stdout", Data: "running\n"},
+			{Offset: 2100 * time.Millisecond, Stream: "stderr", Data: "failed\n"},
+		},
+	}
+	var pauses []time.Duration
+	var stdout, stderr bytes.Buffer
+
+	replaySession(&stdout, &stderr, recording, 2, true, func(d time.Duration) { pauses = append(pauses, d) })
+
+	assert.Equal(t, []time.Duration{50 * time.Millisecond, time.Second}, pauses)
+	assert.Equal(t, "running\n", stdout.String())
+	assert.Equal(t, ""+
+		"Replaying awesome-cli test --team abc\n"+
+		"Recorded 2024-08-01T09:30:00Z on linux/amd64 with awesome-cli v1.2.0\n"+
+		"Environment:\n"+
+		"  HOME=/home/test\n"+
+		"failed\n"+
+		"Exited with 3 after 2.5s\n", stderr.String())
+}
+
+func TestRecordOnlyForPlugins(t *testing.T) {
+	t.Parallel()
+	app, _ := newTestApp()
+	var stderr bytes.Buffer
+	app.Stderr = &stderr
+
+	assert.Equal(t, 1, app.Run([]string{"--record", "/tmp/session.json.gz", "list"}))
+	assert.Equal(t, "Error: --record can only be used when running a plugin\n", stderr.String())
+}
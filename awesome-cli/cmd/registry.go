@@ -0,0 +1,69 @@
+package cmd
+
+// Plugin is an executable discovered in a plugin directory or on PATH.
+type Plugin struct {
+	// Name is the command the plugin is run as, its file name without prefix
+	// and script extension.
+	Name     string `json:"name"`
+	FileName string `json:"fileName"`
+	Path     string `json:"path"`
+}
+
+// PluginRegistry holds the plugins discovered for an App in discovery order.
+// The first plugin found with a given name wins. Disabled plugins are
+// tracked separately so they can be reported without being run.
+type PluginRegistry struct {
+	plugins       map[string]Plugin
+	order         []string
+	disabled      map[string]Plugin
+	disabledOrder []string
+}
+
+func newPluginRegistry() *PluginRegistry {
+	return &PluginRegistry{plugins: make(map[string]Plugin), disabled: make(map[string]Plugin)}
+}
+
+// Add registers plugin and reports whether it was new.
+func (r *PluginRegistry) Add(plugin Plugin) bool {
+	if _, exists := r.plugins[plugin.Name]; exists {
+		return false
+	}
+	r.plugins[plugin.Name] = plugin
+	r.order = append(r.order, plugin.Name)
+	return true
+}
+
+// Get returns the plugin registered as the command name.
+func (r *PluginRegistry) Get(name string) (Plugin, bool) {
+	plugin, exists := r.plugins[name]
+	return plugin, exists
+}
+
+// All returns every registered plugin in discovery order.
+func (r *PluginRegistry) All() []Plugin {
+	plugins := make([]Plugin, 0, len(r.order))
+	for _, name := range r.order {
+		plugins = append(plugins, r.plugins[name])
+	}
+	return plugins
+}
+
+// AddDisabled records a plugin that was found but is disabled and reports
+// whether it was new.
+func (r *PluginRegistry) AddDisabled(plugin Plugin) bool {
+	if _, exists := r.disabled[plugin.Name]; exists {
+		return false
+	}
+	r.disabled[plugin.Name] = plugin
+	r.disabledOrder = append(r.disabledOrder, plugin.Name)
+	return true
+}
+
+// Disabled returns every disabled plugin found, in discovery order.
+func (r *PluginRegistry) Disabled() []Plugin {
+	plugins := make([]Plugin, 0, len(r.disabledOrder))
+	for _, name := range r.disabledOrder {
+		plugins = append(plugins, r.disabled[name])
+	}
+	return plugins
+}
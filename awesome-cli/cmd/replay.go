@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func (a *App) newReplayCommand() *cobra.Command {
+	var speed float64
+	var showEnv bool
+	replayCmd := &cobra.Command{
+		Use:   "replay <file>",
+		Short: "Replays a plugin session recorded with --record",
+		Long: `This command prints the output of a plugin session recorded with
+awesome-cli --record <file> <plugin> ..., on stdout and stderr as the plugin
+wrote it and with the original timing. Details about the session are printed
+on stderr before and after the output.`,
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if speed < 0 {
+				return fmt.Errorf("--speed must not be negative")
+			}
+			recording, err := loadRecording(a.Fs, args[0])
+			if err != nil {
+				return err
+			}
+			replaySession(cmd.OutOrStdout(), cmd.ErrOrStderr(), recording, speed, showEnv, a.pause)
+			return nil
+		},
+	}
+	replayCmd.Flags().Float64Var(&speed, "speed", 1, "Playback speed, 2 plays twice as fast and 0 prints the output without pauses")
+	replayCmd.Flags().BoolVar(&showEnv, "env", false, "Also print the environment the plugin ran with")
+	return replayCmd
+}
+
+// replaySession writes the recorded output to stdout and stderr, pausing
+// between writes for as long as the plugin did, divided by speed.
+func replaySession(stdout, stderr io.Writer, recording *sessionRecording, speed float64, showEnv bool, pause func(time.Duration)) {
+	commandLine := strings.Join(append([]string{"awesome-cli", recording.Plugin}, recording.Args...), " ")
+	fmt.Fprintf(stderr, "Replaying %s\n", commandLine)
+	fmt.Fprintf(stderr, "Recorded %s on %s with awesome-cli %s\n", recording.Started.UTC().Format(time.RFC3339), recording.Platform, recording.HostVersion)
+	if showEnv {
+		fmt.Fprintln(stderr, "Environment:")
+		for _, entry := range recording.Env {
+			fmt.Fprintln(stderr, "  "+entry)
+		}
+	}
+
+	var previous time.Duration
+	for _, event := range recording.Events {
+		if speed > 0 && event.Offset > previous {
+			pause(time.Duration(float64(event.Offset-previous) / speed))
+		}
+		previous = event.Offset
+		if event.Stream == "stderr" {
+			io.WriteString(stderr, event.Data)
+		} else {
+			io.WriteString(stdout, event.Data)
+		}
+	}
+
+	if recording.Error != "" {
+		fmt.Fprintf(stderr, "Failed after %s: %s\n", recording.Duration.Round(time.Millisecond), recording.Error)
+		return
+	}
+	fmt.Fprintf(stderr, "Exited with %d after %s\n", recording.ExitCode, recording.Duration.Round(time.Millisecond))
+}
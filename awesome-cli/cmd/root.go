@@ -1,180 +1,528 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"os"
+	"io"
 	"os/exec"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/spf13/afero"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
-var appFS afero.Fs = afero.NewOsFs() // Use afero for filesystem abstraction
-
-var rootCmd = &cobra.Command{
-	Use:   "awesome-cli",
-	Short: "A brief description of your application",
-	Long: `A longer description that spans multiple lines and likely contains
+// NewRootCommand builds a fresh command tree for the App, including a command
+// for every plugin discovered.
+func (a *App) NewRootCommand() *cobra.Command {
+	rootCmd := &cobra.Command{
+		Use:   "awesome-cli",
+		Short: "A brief description of your application",
+		Long: `A longer description that spans multiple lines and likely contains
 examples and usage of using your application.`,
-}
-
-func Execute() {
-	if err := rootCmd.Execute(); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		SilenceErrors: true, // Errors are reported once by Run
 	}
-}
+	rootCmd.SetIn(a.Stdin)
+	rootCmd.SetOut(a.Stdout)
+	rootCmd.SetErr(a.Stderr)
 
-func init() {
 	rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
-	rootCmd.PersistentFlags().BoolVarP(&verboseMode, "verbose", "v", false, "Enable verbose output")
-	initializePlugins()
-}
-
-//func initializePlugins() {
-//	defaultPluginDir := filepath.Join(os.Getenv("HOME"), ".foo", "plugins")
-//	loadPlugins(defaultPluginDir)
-//	loadConditionalPlugins("/path/to/other/plugins", "awesome-")
-//	loadPathPlugins("awesome-")
-//}
-
-func initializePlugins() {
-	// Only initialize the map if it's nil, indicating that it hasn't been set up before
-	if cachedPlugins == nil {
-		cachedPlugins = make(map[string]string)
-	}
-
-	defaultPluginDir := filepath.Join(os.Getenv("HOME"), ".foo", "plugins")
-	loadPlugins(defaultPluginDir)
-	loadConditionalPlugins("/path/to/other/plugins", "awesome-")
-	loadPathPlugins("awesome-")
-}
-
-var cachedPlugins map[string]string
-
-//func loadPlugins(pluginDir string) {
-//	cachedPlugins = make(map[string]string) // Initialize the map
-//	files, err := afero.ReadDir(appFS, pluginDir)
-//	if err != nil {
-//		if verboseMode {
-//			fmt.Println("Failed to read plugin directory:", err)
-//		}
-//		return
-//	}
-//	for _, file := range files {
-//		if file.IsDir() || !strings.HasPrefix(file.Name(), "awesome-") {
-//			continue
-//		}
-//		registerPluginCommand(pluginDir, file.Name())
-//	}
-//}
-
-func loadPlugins(pluginDir string) {
-	files, err := afero.ReadDir(appFS, pluginDir)
-	if err != nil {
-		if verboseMode {
-			fmt.Println("Failed to read plugin directory:", err)
+	rootCmd.PersistentFlags().CountVarP(&a.verbosity, "verbose", "v", "Log what awesome-cli does, -vv for debug messages")
+	rootCmd.PersistentFlags().StringVar(&a.logLevel, "log-level", "", "Minimum level of the messages logged: debug, info, warn or error")
+	rootCmd.PersistentFlags().StringVar(&a.logFormat, "log-format", "", "Format of the log: text or json")
+	rootCmd.PersistentFlags().StringVar(&a.logFile, "log-file", "", "Also write the log to this file, rotating it when it grows large")
+	rootCmd.PersistentFlags().StringVar(&a.record, "record", "", "Record the plugin's output, arguments and environment to this file for awesome-cli replay")
+	rootCmd.PersistentFlags().DurationVar(&a.timeout, "timeout", 0, "Stop plugins running longer than this, e.g. 90s or 10m, instead of the configured timeout (0 means none)")
+	rootCmd.PersistentFlags().StringVar(&a.profile, "profile", "", "Use this profile instead of the active one")
+	rootCmd.PersistentFlags().StringVarP(&a.output, "output", "o", "text", "Output format: "+outputFormatList())
+	rootCmd.PersistentFlags().StringVar(&a.outputTemplate, "template", "", "Go template the output is rendered with, implies --output template")
+	// Plugin discovery is logged, so logging is needed before cobra parses
+	// the flags
+	early := leadingFlags(rootCmd.PersistentFlags(), a.args)
+	a.logger = nil
+	a.configureLogging(earlyLogSettings(early)) // Invalid flags are reported once parsed
+
+	rootCmd.AddCommand(
+		a.newListCommand(),
+		a.newVersionCommand(),
+		a.newDoctorCommand(),
+		a.newPluginCommand(),
+		a.newSelfUpdateCommand(),
+		a.newHistoryCommand(),
+		a.newUICommand(),
+		a.newReplayCommand(),
+		a.newSecretCommand(),
+		a.newProfileCommand(),
+	)
+	rootCmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		// Plugin commands parse the host flags themselves, after this runs
+		if a.record != "" {
+			return errors.New("--record can only be used when running a plugin")
 		}
-		return
+		if err := a.configureLogging(a.logSettings()); err != nil {
+			return err
+		}
+		if err := a.checkOutputSupported(cmd); err != nil {
+			return err
+		}
+		if _, _, err := a.activeProfile(); err != nil {
+			if !runsWithAnyProfile(cmd) {
+				return err
+			}
+			fmt.Fprintln(cmd.ErrOrStderr(), "Warning:", err)
+		}
+		return nil
 	}
-	for _, file := range files {
-		if file.IsDir() || !strings.HasPrefix(file.Name(), "awesome-") {
-			continue
+	rootCmd.PersistentPostRun = func(cmd *cobra.Command, args []string) {
+		if cmd.Name() == "self-update" {
+			return
 		}
-		if _, exists := cachedPlugins[file.Name()]; !exists {
-			registerPluginCommand(pluginDir, file.Name())
+		if notice := a.updateNotice(); notice != "" {
+			fmt.Fprintln(cmd.ErrOrStderr(), notice)
 		}
 	}
+	// The profile decides where plugins are found, so it is needed before
+	// cobra parses the flags too
+	a.profile, a.pluginProfileArgs = a.profileArg(rootCmd, a.args)
+	a.initializePlugins(rootCmd)
+	return rootCmd
 }
 
-func loadConditionalPlugins(pluginDir, prefix string) {
-	files, err := afero.ReadDir(appFS, pluginDir)
+func (a *App) initializePlugins(rootCmd *cobra.Command) {
+	a.Plugins = newPluginRegistry()
+
+	config, err := a.config()
 	if err != nil {
-		fmt.Println("Failed to read plugin directory:", err)
-		return
+		config = &Config{}
+	}
+	_, profile, _ := a.activeProfile()
+	for _, dir := range a.pluginSearchDirs(config, profile) {
+		a.loadPlugins(rootCmd, config, dir)
 	}
-	filterAndRegisterPlugins(files, pluginDir, prefix)
 }
 
-func loadPathPlugins(prefix string) {
-	path := os.Getenv("PATH")
-	dirs := strings.Split(path, string(os.PathListSeparator))
-	for _, dir := range dirs {
-		files, _ := afero.ReadDir(appFS, dir) // Ignore errors, some dirs might be inaccessible
-		filterAndRegisterPlugins(files, dir, prefix)
+// defaultPluginDir returns the directory build_and_deploy.sh installs plugins into.
+func (a *App) defaultPluginDir() string {
+	return filepath.Join(a.Env.Getenv("HOME"), ".foo", "plugins")
+}
+
+// pluginSearchDirs returns the directories searched for plugins in order:
+// the plugin directories and finally PATH. The first plugin found with a
+// given name wins.
+func (a *App) pluginSearchDirs(config *Config, profile *Profile) []string {
+	return append(a.pluginDirs(config, profile), filepath.SplitList(a.Env.Getenv("PATH"))...)
+}
+
+// pluginDirs returns the directories meant to hold plugins, unlike PATH:
+// those of profile, which may be nil, so a profile can override any plugin,
+// the default directory and those in config.
+func (a *App) pluginDirs(config *Config, profile *Profile) []string {
+	var dirs []string
+	if profile != nil {
+		dirs = append(dirs, profile.PluginDirs...)
 	}
+	dirs = append(dirs, a.defaultPluginDir())
+	return append(dirs, config.PluginDirs...)
 }
 
-func registerPlugins(files []os.FileInfo, pluginDir string) {
+// loadPlugins registers the plugins in pluginDir, the files named with one of
+// the prefixes config sets for the directory.
+func (a *App) loadPlugins(rootCmd *cobra.Command, config *Config, pluginDir string) {
+	files, err := afero.ReadDir(a.Fs, pluginDir)
+	if err != nil {
+		a.log().Debug("Failed to read plugin directory", "error", err)
+		return
+	}
+	prefixes := config.pluginPrefixes(pluginDir)
 	for _, file := range files {
 		if file.IsDir() {
 			continue
 		}
-		registerPluginCommand(pluginDir, file.Name())
+		if name, ok := config.pluginName(file.Name(), prefixes); ok {
+			a.registerPluginCommand(rootCmd, pluginDir, file.Name(), name)
+		}
 	}
 }
 
-func filterAndRegisterPlugins(files []os.FileInfo, pluginDir, prefix string) {
-	for _, file := range files {
-		if file.IsDir() || !startsWith(file.Name(), prefix) {
-			continue
+func (a *App) registerPluginCommand(rootCmd *cobra.Command, pluginDir, fileName, commandName string) {
+	pluginPath := filepath.Join(pluginDir, fileName)
+	plugin := Plugin{Name: commandName, FileName: fileName, Path: pluginPath}
+	if a.pluginDisabled(commandName) {
+		if a.Plugins.AddDisabled(plugin) {
+			a.log().Info("Skipped disabled plugin", "path", pluginPath)
 		}
-		registerPluginCommand(pluginDir, file.Name())
+		return
 	}
-}
-
-func registerPluginCommand(pluginDir, fileName string) {
-	if _, exists := cachedPlugins[fileName]; exists {
-		return // Plugin already registered, skip re-registration
+	if !a.Plugins.Add(plugin) {
+		return // A plugin with this name was found in an earlier directory
 	}
 
-	commandName := strings.TrimPrefix(fileName, "awesome-")
-	pluginPath := filepath.Join(pluginDir, fileName)
 	pluginCmd := &cobra.Command{
-		Use:   commandName,
-		Short: "Runs the " + commandName + " plugin",
-		Run: func(cmd *cobra.Command, args []string) {
-			executePlugin(pluginPath, args)
+		Use:                commandName,
+		Short:              "Runs the " + commandName + " plugin",
+		DisableFlagParsing: true, // Flags belong to the plugin
+		SilenceUsage:       true,
+		Annotations:        map[string]string{pluginPathAnnotation: pluginPath},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			hostArgs, pluginArgs := splitPluginArgs(a.args, commandName, args)
+			if hostArgs != nil {
+				pluginArgs = withoutArgs(pluginArgs, a.pluginProfileArgs, len(hostArgs)+1)
+			}
+			hostFlags := cmd.Root().PersistentFlags()
+			if err := hostFlags.Parse(hostArgs); err != nil {
+				return err
+			}
+			if err := a.configureLogging(a.logSettings()); err != nil {
+				return err
+			}
+			if _, err := a.renderer(); err != nil {
+				return err
+			}
+			if _, _, err := a.activeProfile(); err != nil {
+				return err
+			}
+			settings := a.pluginSettings(commandName)
+			if hostFlags.Changed("timeout") {
+				settings.Timeout = a.timeout
+			}
+			pluginArgs = append(slices.Clip(settings.Args), pluginArgs...)
+			if a.record == "" {
+				return a.executePlugin(cmd.Context(), pluginPath, pluginArgs, settings, cmd.InOrStdin(), cmd.OutOrStdout(), cmd.ErrOrStderr())
+			}
+
+			// Secrets are recorded by name only
+			env := a.pluginEnv(pluginPath)
+			for _, envName := range sortedKeys(settings.Secrets) {
+				env = append(env, envName+"="+redactedValue)
+			}
+			recorder := a.newSessionRecorder(commandName, pluginPath, pluginArgs, env)
+			stdout := recorder.stream("stdout", cmd.OutOrStdout())
+			stderr := recorder.stream("stderr", cmd.ErrOrStderr())
+			err := a.executePlugin(cmd.Context(), pluginPath, pluginArgs, settings, cmd.InOrStdin(), stdout, stderr)
+			if saveErr := recorder.save(a.Fs, a.record, err); saveErr != nil {
+				a.log().Warn("Failed to save recording", "path", a.record, "error", saveErr)
+			}
+			return err
 		},
 	}
 	rootCmd.AddCommand(pluginCmd)
-	cachedPlugins[fileName] = pluginPath // Cache the plugin path
-	if verboseMode {
-		fmt.Printf("Loaded plugin: %s\n", fileName)
+	a.log().Debug("Loaded plugin", "path", pluginPath)
+}
+
+// pluginPathAnnotation marks plugin commands with the path of their executable.
+const pluginPathAnnotation = "awesome-cli/plugin-path"
+
+// pluginDisabled reports whether the user disabled the plugin called name.
+func (a *App) pluginDisabled(name string) bool {
+	config, err := a.config()
+	return err == nil && config.pluginDisabled(name)
+}
+
+// Environment variables describing the host that every plugin is started with.
+const (
+	envPluginName = "AWESOME_CLI_PLUGIN"
+	envVersion    = "AWESOME_CLI_VERSION"
+	envVerbose    = "AWESOME_CLI_VERBOSE"
+	envProfile    = "AWESOME_CLI_PROFILE"
+	envOutput     = "AWESOME_CLI_OUTPUT"
+)
+
+// pluginEnv returns the environment for running the plugin at pluginPath,
+// including the variables of the active profile. The vault passphrase is left
+// out, plugins only get the secrets declared for them.
+func (a *App) pluginEnv(pluginPath string) []string {
+	env := slices.DeleteFunc(a.Env.Environ(), func(entry string) bool {
+		return strings.HasPrefix(entry, envSecretsPassphrase+"=")
+	})
+	env = append(env,
+		envPluginName+"="+filepath.Base(pluginPath),
+		envVersion+"="+currentBuildInfo().Version,
+		envVerbose+"="+strconv.FormatBool(a.verbosity > 0),
+		envOutput+"="+a.outputFormat(),
+	)
+	name, profile, err := a.activeProfile()
+	if err != nil || profile == nil {
+		return env
+	}
+	for _, envName := range sortedKeys(profile.Env) {
+		env = append(env, envName+"="+profile.Env[envName])
+	}
+	return append(env, envProfile+"="+name)
+}
+
+// splitPluginArgs separates the host flags given before the plugin name in
+// all, the arguments of the whole invocation, from the plugin's own arguments.
+// Flag parsing is disabled for plugin commands, so cobra passes both as args.
+func splitPluginArgs(all []string, name string, args []string) (host, plugin []string) {
+	for i, arg := range all {
+		if arg == name && i <= len(args) && slices.Equal(all[:i], args[:i]) && slices.Equal(all[i+1:], args[i:]) {
+			return args[:i], args[i:]
+		}
+	}
+	return nil, args
+}
+
+// withoutArgs returns args, which start at index offset of the invocation's
+// arguments, without the ones at the invocation indices in drop.
+func withoutArgs(args []string, drop []int, offset int) []string {
+	if len(drop) == 0 {
+		return args
+	}
+	kept := []string{}
+	for i, arg := range args {
+		if !slices.Contains(drop, offset+i) {
+			kept = append(kept, arg)
+		}
 	}
+	return kept
 }
 
-//func registerPluginCommand(pluginDir, fileName string) {
-//	commandName := strings.TrimPrefix(fileName, "awesome-") // Remove prefix for display
-//	pluginPath := filepath.Join(pluginDir, fileName)
-//
-//	pluginCmd := &cobra.Command{
-//		Use:   commandName, // Use modified command name
-//		Short: "Runs the " + commandName + " plugin",
-//		Run: func(cmd *cobra.Command, args []string) {
-//			executePlugin(pluginPath, args)
-//		},
-//	}
-//	rootCmd.AddCommand(pluginCmd)
-//	fmt.Printf("Loaded plugin: %s\n", fileName)
-//}
+// profileArg returns the value of the last --profile flag among the host's
+// arguments in args. As cobra does, the flag is accepted before and after the
+// names of built-in commands, up to --. The arguments after a plugin's name
+// are the plugin's, unless no plugin of that name is found with the profile
+// given before it: a --profile given there then selects the profile the
+// plugin is found with, and the indices of the flag and its value are
+// returned so they are not passed on to the plugin.
+func (a *App) profileArg(rootCmd *cobra.Command, args []string) (profile string, pluginArgs []int) {
+	cmd := rootCmd
+	lookup := func(name string) *pflag.Flag {
+		if flag := cmd.Flags().Lookup(name); flag != nil {
+			return flag
+		}
+		return rootCmd.PersistentFlags().Lookup(name)
+	}
+	plugin := ""
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--":
+			return profile, pluginArgs
+		case strings.HasPrefix(arg, "--profile="):
+			profile = strings.TrimPrefix(arg, "--profile=")
+			if plugin != "" {
+				pluginArgs = append(pluginArgs, i)
+			}
+		case arg == "--profile" && i+1 < len(args):
+			profile = args[i+1]
+			if plugin != "" {
+				pluginArgs = append(pluginArgs, i, i+1)
+			}
+			i++
+		case plugin != "":
+			// The plugin's own arguments
+		case strings.HasPrefix(arg, "--"):
+			name, _, hasValue := strings.Cut(arg[2:], "=")
+			if flag := lookup(name); flag != nil && !hasValue && flag.NoOptDefVal == "" {
+				i++ // Skip the flag's value
+			}
+		case len(arg) > 1 && arg[0] == '-':
+			// Shorthands can be combined, as in -vv, the last one taking a value
+			for j := 1; j < len(arg); j++ {
+				flag := cmd.Flags().ShorthandLookup(arg[j : j+1])
+				if flag == nil {
+					flag = rootCmd.PersistentFlags().ShorthandLookup(arg[j : j+1])
+				}
+				if flag != nil && flag.NoOptDefVal == "" {
+					if j+1 == len(arg) {
+						i++
+					}
+					break
+				}
+			}
+		default:
+			if sub := subcommand(cmd, arg); sub != nil {
+				cmd = sub
+			} else if cmd == rootCmd {
+				if a.findsPlugin(arg, profile) {
+					return profile, nil
+				}
+				plugin = arg
+			}
+		}
+	}
+	return profile, pluginArgs
+}
 
-var verboseMode bool
+// subcommand returns the command of cmd called name, or nil.
+func subcommand(cmd *cobra.Command, name string) *cobra.Command {
+	for _, sub := range cmd.Commands() {
+		if sub.Name() == name || sub.HasAlias(name) {
+			return sub
+		}
+	}
+	return nil
+}
 
-func executePlugin(pluginPath string, args []string) {
-	if verboseMode {
-		fmt.Println("Executing plugin at:", pluginPath)
+// findsPlugin reports whether a plugin called name is found with the profile
+// selected by the --profile flag value profileFlag.
+func (a *App) findsPlugin(name, profileFlag string) bool {
+	config, err := a.config()
+	if err != nil {
+		config = &Config{}
 	}
-	cmd := exec.Command(pluginPath, args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil && verboseMode {
-		fmt.Fprintf(os.Stderr, "Error executing plugin %s: %v\n", pluginPath, err)
+	_, profile, _ := a.selectProfile(profileFlag)
+	for _, dir := range a.pluginSearchDirs(config, profile) {
+		files, err := afero.ReadDir(a.Fs, dir)
+		if err != nil {
+			continue
+		}
+		prefixes := config.pluginPrefixes(dir)
+		for _, file := range files {
+			if found, ok := config.pluginName(file.Name(), prefixes); ok && found == name && !file.IsDir() {
+				return true
+			}
+		}
 	}
+	return false
 }
 
-func startsWith(name, prefix string) bool {
-	return strings.HasPrefix(name, prefix)
+// leadingFlags returns the values of the flags in args that come before the
+// first argument that is not one of flags, e.g. the name of a command, by flag
+// name. Flags without a value, like -v, get their NoOptDefVal.
+func leadingFlags(flags *pflag.FlagSet, args []string) map[string][]string {
+	values := make(map[string][]string)
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" || len(arg) < 2 || arg[0] != '-' {
+			break
+		}
+		if strings.HasPrefix(arg, "--") {
+			name, value, hasValue := strings.Cut(arg[2:], "=")
+			flag := flags.Lookup(name)
+			switch {
+			case flag == nil:
+				return values
+			case hasValue:
+			case flag.NoOptDefVal != "":
+				value = flag.NoOptDefVal
+			case i+1 < len(args):
+				i++
+				value = args[i]
+			default:
+				return values
+			}
+			values[flag.Name] = append(values[flag.Name], value)
+			continue
+		}
+		// Shorthands can be combined, as in -vv, the last one taking a value
+		for j := 1; j < len(arg); j++ {
+			flag := flags.ShorthandLookup(arg[j : j+1])
+			switch {
+			case flag == nil:
+				return values
+			case j+1 < len(arg) && arg[j+1] == '=':
+				values[flag.Name] = append(values[flag.Name], arg[j+2:])
+			case flag.NoOptDefVal != "":
+				values[flag.Name] = append(values[flag.Name], flag.NoOptDefVal)
+				continue
+			case j+1 < len(arg):
+				values[flag.Name] = append(values[flag.Name], arg[j+1:])
+			case i+1 < len(args):
+				i++
+				values[flag.Name] = append(values[flag.Name], args[i])
+			default:
+				return values
+			}
+			break
+		}
+	}
+	return values
+}
+
+// pluginSettings returns the configured settings of the plugin called name
+// in the active profile.
+func (a *App) pluginSettings(name string) PluginConfig {
+	config, err := a.config()
+	if err != nil {
+		return PluginConfig{}
+	}
+	_, profile, _ := a.activeProfile()
+	return config.pluginConfig(name, profile)
+}
+
+// timeoutExitCode is the exit code of a plugin stopped by its timeout, as
+// used by timeout(1).
+const timeoutExitCode = 124
+
+// defaultTerminateGrace is how long a plugin may take to exit after SIGTERM
+// before it is killed.
+const defaultTerminateGrace = 10 * time.Second
+
+// executePlugin runs the plugin at pluginPath with settings. A plugin that
+// exits with a non-zero status is reported as an exitError carrying that
+// status. A plugin that runs out of time is sent SIGTERM along with the
+// programs it started, killed if it is still running after the grace period
+// and reported with timeoutExitCode.
+func (a *App) executePlugin(ctx context.Context, pluginPath string, args []string, settings PluginConfig, stdin io.Reader, stdout, stderr io.Writer) error {
+	a.log().Debug("Executing plugin", "path", pluginPath)
+	if settings.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, settings.Timeout)
+		defer cancel()
+	}
+
+	name, argv, err := a.pluginCommand(pluginPath, args)
+	if err != nil {
+		return err
+	}
+	if !settings.Limits.isZero() {
+		limitedName, limitedArgs, err := limitCommand(name, argv, settings.Limits)
+		switch {
+		case errors.Is(err, errResourceLimitsUnsupported):
+			a.log().Warn("Running plugin without resource limits", "path", pluginPath, "error", err)
+		case err != nil:
+			return fmt.Errorf("limiting resources of plugin %s: %w", pluginPath, err)
+		default:
+			name, argv = limitedName, limitedArgs
+		}
+	}
+
+	env := a.pluginEnv(pluginPath)
+	if len(settings.Secrets) > 0 {
+		secretEnv, err := a.secretEnv(settings.Secrets)
+		if err != nil {
+			return fmt.Errorf("injecting secrets into plugin %s: %w", pluginPath, err)
+		}
+		env = append(env, secretEnv...)
+	}
+
+	cmd := exec.CommandContext(ctx, name, argv...)
+	cmd.Env = env
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.Cancel = func() error { return cmd.Process.Signal(syscall.SIGTERM) }
+	if settings.Timeout > 0 {
+		// Only then, as a plugin outside the terminal's foreground process
+		// group is stopped when reading from it
+		startProcessGroup(cmd)
+		cmd.WaitDelay = a.terminateGrace
+		if cmd.WaitDelay == 0 {
+			cmd.WaitDelay = defaultTerminateGrace
+		}
+	}
+	err = cmd.Run()
+	if ctx.Err() != nil {
+		killProcessGroup(cmd)
+	}
+	if err != nil {
+		if settings.Timeout > 0 && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			fmt.Fprintf(stderr, "Error: plugin %s timed out after %s\n", pluginPath, settings.Timeout)
+			return &exitError{code: timeoutExitCode}
+		}
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			a.log().Info("Plugin failed", "path", pluginPath, "error", err)
+			return &exitError{code: exitErr.ExitCode()}
+		}
+		return fmt.Errorf("executing plugin %s: %w", pluginPath, err)
+	}
+	return nil
 }
@@ -1 +1,247 @@
 package cmd
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestApp returns an App running against an in-memory filesystem and a
+// fixed environment, with stdout captured in the returned buffer.
+func newTestApp() (*App, *bytes.Buffer) {
+	stdout := new(bytes.Buffer)
+	return &App{
+		Fs: afero.NewMemMapFs(),
+		Env: MapEnvironment{
+			"HOME": "/home/test",
+			"PATH": "/usr/local/bin:/usr/bin",
+		},
+		Stdin:  new(bytes.Buffer),
+		Stdout: stdout,
+		Stderr: io.Discard,
+	}, stdout
+}
+
+func pluginNames(app *App) []string {
+	var names []string
+	for _, plugin := range app.Plugins.All() {
+		names = append(names, plugin.Name)
+	}
+	return names
+}
+
+func TestPluginDiscovery(t *testing.T) {
+	t.Parallel()
+	app, _ := newTestApp()
+	afero.WriteFile(app.Fs, "/home/test/.foo/plugins/awesome-test", []byte{}, 0755)
+	afero.WriteFile(app.Fs, "/home/test/.foo/plugins/unrelated", []byte{}, 0755)
+	afero.WriteFile(app.Fs, "/opt/plugins/awesome-reporter", []byte{}, 0755)
+	afero.WriteFile(app.Fs, "/usr/bin/awesome-uatu", []byte{}, 0755)
+	afero.WriteFile(app.Fs, "/usr/bin/awesome-test", []byte{}, 0755)
+	afero.WriteFile(app.Fs, "/home/test/.foo/config.yaml", []byte("pluginDirs: [/opt/plugins]\n"), 0644)
+
+	root := app.NewRootCommand()
+
+	assert.Equal(t, []string{"test", "reporter", "uatu"}, pluginNames(app))
+	plugin, _ := app.Plugins.Get("test")
+	assert.Equal(t, "/home/test/.foo/plugins/awesome-test", plugin.Path, "earlier directories shadow later ones")
+	for _, name := range []string{"test", "reporter", "uatu"} {
+		cmd, _, err := root.Find([]string{name})
+		assert.NoError(t, err)
+		assert.Equal(t, name, cmd.Name())
+	}
+}
+
+func TestAppsAreIndependent(t *testing.T) {
+	t.Parallel()
+	first, _ := newTestApp()
+	second, _ := newTestApp()
+	afero.WriteFile(first.Fs, "/home/test/.foo/plugins/awesome-only-first", []byte{}, 0755)
+
+	first.NewRootCommand()
+	second.NewRootCommand()
+
+	assert.Equal(t, []string{"only-first"}, pluginNames(first))
+	assert.Empty(t, pluginNames(second))
+}
+
+func TestNewRootCommandIsFresh(t *testing.T) {
+	t.Parallel()
+	app, _ := newTestApp()
+	afero.WriteFile(app.Fs, "/home/test/.foo/plugins/awesome-test", []byte{}, 0755)
+	app.NewRootCommand()
+
+	app.Fs.Remove("/home/test/.foo/plugins/awesome-test")
+	root := app.NewRootCommand()
+
+	assert.Empty(t, pluginNames(app))
+	var names []string
+	for _, cmd := range root.Commands() {
+		names = append(names, cmd.Name())
+	}
+	sort.Strings(names)
+	assert.Equal(t, []string{"doctor", "history", "list", "plugin", "profile", "replay", "secret", "self-update", "ui", "version"}, names)
+}
+
+func TestRunReportsErrors(t *testing.T) {
+	t.Parallel()
+	app, _ := newTestApp()
+	stderr := new(bytes.Buffer)
+	app.Stderr = stderr
+
+	code := app.Run([]string{"no-such-command"})
+
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr.String(), `Error: unknown command "no-such-command"`)
+}
+
+func TestMapEnvironment(t *testing.T) {
+	t.Parallel()
+	env := MapEnvironment{"HOME": "/home/test"}
+
+	assert.Equal(t, "/home/test", env.Getenv("HOME"))
+	assert.Equal(t, "", env.Getenv("MISSING"))
+	assert.Equal(t, []string{"HOME=/home/test"}, env.Environ())
+}
+
+func TestLookPath(t *testing.T) {
+	t.Parallel()
+	app, _ := newTestApp()
+	afero.WriteFile(app.Fs, "/usr/bin/podman", []byte{}, 0755)
+	afero.WriteFile(app.Fs, "/usr/local/bin/docker", []byte{}, 0644)
+
+	path, err := app.lookPath("podman")
+	assert.NoError(t, err)
+	assert.Equal(t, "/usr/bin/podman", path)
+
+	_, err = app.lookPath("docker")
+	assert.Error(t, err, "files that are not executable are skipped")
+}
+
+func TestSplitPluginArgs(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		all, args    []string
+		host, plugin []string
+	}{
+		{[]string{"test", "-v"}, []string{"-v"}, []string{}, []string{"-v"}},
+		{[]string{"-v", "--timeout", "5s", "test", "x"}, []string{"-v", "--timeout", "5s", "x"}, []string{"-v", "--timeout", "5s"}, []string{"x"}},
+		{[]string{"--timeout=test", "test", "test"}, []string{"--timeout=test", "test"}, []string{"--timeout=test"}, []string{"test"}},
+		{nil, []string{"x"}, nil, []string{"x"}},
+	}
+	for _, test := range tests {
+		host, plugin := splitPluginArgs(test.all, "test", test.args)
+		assert.Equal(t, test.host, host, test.all)
+		assert.Equal(t, test.plugin, plugin, test.all)
+	}
+}
+
+func TestExecutePluginTimeout(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name   string
+		script string
+		stdout string
+	}{
+		{"exits on SIGTERM", "trap 'echo stopping; exit 0' TERM\nsleep 5 &\nwait\n", "stopping\n"},
+		{"killed when ignoring SIGTERM", "trap '' TERM\nexec sleep 5\n", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			app, _ := newTestApp()
+			app.terminateGrace = 200 * time.Millisecond
+			plugin := filepath.Join(t.TempDir(), "awesome-slow")
+			os.WriteFile(plugin, []byte("#!/bin/sh\n"+test.script), 0755)
+
+			var stdout, stderr bytes.Buffer
+			started := time.Now()
+			err := app.executePlugin(context.Background(), plugin, nil, PluginConfig{Timeout: 100 * time.Millisecond}, nil, &stdout, &stderr)
+
+			assert.Equal(t, &exitError{code: timeoutExitCode}, err)
+			assert.Less(t, time.Since(started), 3*time.Second)
+			assert.Equal(t, test.stdout, stdout.String())
+			assert.Equal(t, "Error: plugin "+plugin+" timed out after 100ms\n", stderr.String())
+		})
+	}
+}
+
+func TestExecutePluginWaitsForOutputWithoutTimeout(t *testing.T) {
+	t.Parallel()
+	app, _ := newTestApp()
+	app.terminateGrace = 100 * time.Millisecond
+	plugin := filepath.Join(t.TempDir(), "awesome-background")
+	// The background child keeps writing to stdout after the plugin exits
+	os.WriteFile(plugin, []byte("#!/bin/sh\n(sleep 0.5; echo done) &\n"), 0755)
+
+	var stdout, stderr bytes.Buffer
+	err := app.executePlugin(context.Background(), plugin, nil, PluginConfig{}, nil, &stdout, &stderr)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "done\n", stdout.String())
+}
+
+func TestProfileFlagAfterCommand(t *testing.T) {
+	t.Parallel()
+	app, stdout := newTestApp()
+	dir := t.TempDir()
+	plugin := filepath.Join(dir, "awesome-deploy")
+	script := []byte("#!/bin/sh\necho \"$AWESOME_CLI_PROFILE $*\"\n")
+	// On disk to be executed, in Fs to be found
+	os.WriteFile(plugin, script, 0755)
+	afero.WriteFile(app.Fs, plugin, script, 0755)
+	app.Config = &Config{Profiles: map[string]Profile{"staging": {PluginDirs: []string{dir}}, "prod": {}}}
+
+	assert.Equal(t, 0, app.Run([]string{"list"}))
+	assert.Equal(t, "No plugins found.\n", stdout.String())
+
+	for _, args := range [][]string{{"list", "--profile", "staging"}, {"list", "--profile=staging"}, {"--profile", "staging", "list"}} {
+		stdout.Reset()
+		assert.Equal(t, 0, app.Run(args), args)
+		assert.Equal(t, "Available plugins:\n  - deploy\n", stdout.String(), args)
+	}
+
+	stdout.Reset()
+	assert.Equal(t, 0, app.Run([]string{"version", "--plugins", "--profile", "staging"}))
+	assert.Contains(t, stdout.String(), "deploy")
+
+	stdout.Reset()
+	assert.Equal(t, 0, app.Run([]string{"deploy", "--profile", "staging", "--region", "eu"}))
+	assert.Equal(t, "staging --region eu\n", stdout.String(), "the --profile the plugin is found with is the host's")
+
+	stdout.Reset()
+	assert.Equal(t, 0, app.Run([]string{"--profile", "staging", "deploy", "--profile", "prod"}))
+	assert.Equal(t, "staging --profile prod\n", stdout.String(), "arguments after a plugin found before are the plugin's")
+
+	stdout.Reset()
+	assert.Equal(t, 0, app.Run([]string{"--profile", "staging", "deploy", "--", "--profile", "prod"}))
+	assert.Equal(t, "staging -- --profile prod\n", stdout.String())
+}
+
+func TestLeadingFlags(t *testing.T) {
+	t.Parallel()
+	app, _ := newTestApp()
+	flags := app.NewRootCommand().PersistentFlags()
+
+	for _, tt := range []struct {
+		args []string
+		want map[string][]string
+	}{
+		{[]string{"--profile", "staging", "deploy", "--profile", "prod"}, map[string][]string{"profile": {"staging"}}},
+		{[]string{"--profile=staging", "-vv", "--log-level", "debug"}, map[string][]string{"profile": {"staging"}, "verbose": {"+1", "+1"}, "log-level": {"debug"}}},
+		{[]string{"-v", "--timeout", "5s", "--verbose", "deploy"}, map[string][]string{"verbose": {"+1", "+1"}, "timeout": {"5s"}}},
+		{[]string{"--", "--profile", "staging"}, map[string][]string{}},
+		{[]string{"--unknown", "--profile", "staging"}, map[string][]string{}},
+		{[]string{"--profile"}, map[string][]string{}},
+	} {
+		assert.Equal(t, tt.want, leadingFlags(flags, tt.args), tt.args)
+	}
+}
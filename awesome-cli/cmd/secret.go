@@ -0,0 +1,278 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var (
+	secretNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+	envNamePattern    = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+func validateSecretName(name string) error {
+	if !secretNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid secret name %q: use letters, digits, dots, dashes and underscores", name)
+	}
+	return nil
+}
+
+// newSecretCommand returns the command grouping the secret management subcommands.
+func (a *App) newSecretCommand() *cobra.Command {
+	secretCmd := &cobra.Command{
+		Use:   "secret",
+		Short: "Manages the secrets injected into plugins",
+		Long: `This command groups the subcommands managing the encrypted secrets vault.
+
+Secrets are injected into plugins as environment variables declared in the
+config file, for example:
+
+  plugins:
+    test:
+      secrets:
+        GITHUB_TOKEN: github-token
+
+The vault is unlocked with a passphrase, prompted for or read from
+` + envSecretsPassphrase + `. Secrets are only ever decrypted in memory.`,
+		// Secret values may be given as arguments, which must not be recorded
+		Annotations: map[string]string{skipHistoryAnnotation: "true"},
+	}
+	secretCmd.AddCommand(
+		a.newSecretSetCommand(),
+		a.newSecretGetCommand(),
+		a.newSecretListCommand(),
+		a.newSecretDeleteCommand(),
+	)
+	return secretCmd
+}
+
+func (a *App) newSecretSetCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "set <name> [value]",
+		Short: "Stores a secret",
+		Long: `This command stores a secret in the vault. Without a value argument, which
+would end up in your shell history, the value is prompted for or read from
+stdin.`,
+		Args:         cobra.RangeArgs(1, 2),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := args[0]
+			if err := validateSecretName(name); err != nil {
+				return err
+			}
+			var value string
+			if len(args) == 2 {
+				value = args[1]
+			} else {
+				var err error
+				if value, err = a.readSecretValue(name); err != nil {
+					return err
+				}
+			}
+			if err := a.secrets().Set(name, value); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Stored secret %s.\n", name)
+			return nil
+		},
+	}
+}
+
+func (a *App) newSecretGetCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:          "get <name>",
+		Short:        "Prints the value of a secret",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			value, err := a.secrets().Get(args[0])
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), value)
+			return nil
+		},
+	}
+}
+
+func (a *App) newSecretListCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:          "list",
+		Short:        "Lists the names of the stored secrets and the plugins using them",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			names, err := a.secrets().List()
+			if err != nil {
+				return err
+			}
+			config, err := a.config()
+			if err != nil {
+				config = &Config{}
+			}
+			displaySecrets(cmd.OutOrStdout(), names, config)
+			return nil
+		},
+	}
+}
+
+func (a *App) newSecretDeleteCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:          "delete <name>",
+		Short:        "Removes a secret",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := a.secrets().Delete(args[0]); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Deleted secret %s.\n", args[0])
+			return nil
+		},
+	}
+}
+
+// displaySecrets prints the secret names, never their values, with the
+// environment variables of the plugins they are injected as.
+func displaySecrets(w io.Writer, names []string, config *Config) {
+	if len(names) == 0 {
+		fmt.Fprintln(w, "No secrets stored.")
+		return
+	}
+	usedBy := make(map[string][]string)
+	for plugin, settings := range config.Plugins {
+		for envName, secret := range settings.Secrets {
+			usedBy[secret] = append(usedBy[secret], plugin+" as "+envName)
+		}
+	}
+	for name, profile := range config.Profiles {
+		for envName, secret := range profile.Secrets {
+			usedBy[secret] = append(usedBy[secret], "profile "+name+" as "+envName)
+		}
+		for plugin, settings := range profile.Plugins {
+			for envName, secret := range settings.Secrets {
+				usedBy[secret] = append(usedBy[secret], plugin+" in profile "+name+" as "+envName)
+			}
+		}
+	}
+	for _, name := range names {
+		if uses := usedBy[name]; len(uses) > 0 {
+			sort.Strings(uses)
+			fmt.Fprintf(w, "%s (%s)\n", name, strings.Join(uses, ", "))
+		} else {
+			fmt.Fprintln(w, name)
+		}
+	}
+}
+
+// secrets returns the App's SecretProvider, the vault file unless one was set.
+func (a *App) secrets() SecretProvider {
+	if a.Secrets == nil {
+		a.Secrets = newVaultStore(a.Fs, a.secretsPath(), a.vaultPassphrase)
+	}
+	return a.Secrets
+}
+
+// secretsPath returns the location of the vault file.
+func (a *App) secretsPath() string {
+	if config, err := a.config(); err == nil && config.SecretsFile != "" {
+		return config.SecretsFile
+	}
+	return filepath.Join(a.Env.Getenv("HOME"), ".foo", "secrets.vault")
+}
+
+// vaultPassphrase reads the vault passphrase from the environment or prompts
+// for it, twice when the vault is being created.
+func (a *App) vaultPassphrase(create bool) (string, error) {
+	if passphrase := a.Env.Getenv(envSecretsPassphrase); passphrase != "" {
+		return passphrase, nil
+	}
+	if !a.stdinIsTerminal() {
+		return "", fmt.Errorf("the secrets vault is locked, set %s or run in a terminal", envSecretsPassphrase)
+	}
+	prompt := "Vault passphrase: "
+	if create {
+		prompt = "New vault passphrase: "
+	}
+	passphrase, err := a.readHidden(prompt)
+	if err != nil || !create {
+		return passphrase, err
+	}
+	confirmation, err := a.readHidden("Repeat passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	if confirmation != passphrase {
+		return "", errors.New("the passphrases do not match")
+	}
+	return passphrase, nil
+}
+
+// readSecretValue prompts for the value of a secret, or reads all of stdin
+// when it is not a terminal.
+func (a *App) readSecretValue(name string) (string, error) {
+	if a.stdinIsTerminal() {
+		return a.readHidden("Value for " + name + ": ")
+	}
+	data, err := io.ReadAll(a.stdinReader())
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// readHidden prompts on stderr and reads a line from stdin without echoing it.
+func (a *App) readHidden(prompt string) (string, error) {
+	fmt.Fprint(a.stderr(), prompt)
+	defer fmt.Fprintln(a.stderr())
+	if file, ok := a.Stdin.(*os.File); ok && term.IsTerminal(int(file.Fd())) {
+		value, err := term.ReadPassword(int(file.Fd()))
+		return string(value), err
+	}
+	line, err := a.stdinReader().ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// stdinReader returns a buffered reader of stdin shared between prompts.
+func (a *App) stdinReader() *bufio.Reader {
+	if a.stdinLines == nil {
+		a.stdinLines = bufio.NewReader(a.Stdin)
+	}
+	return a.stdinLines
+}
+
+// secretEnv resolves the secrets declared for a plugin into environment
+// variables, sorted by name.
+func (a *App) secretEnv(secrets map[string]string) ([]string, error) {
+	env := make([]string, 0, len(secrets))
+	for _, envName := range sortedKeys(secrets) {
+		value, err := a.secrets().Get(secrets[envName])
+		if err != nil {
+			return nil, err
+		}
+		env = append(env, envName+"="+value)
+	}
+	return env, nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
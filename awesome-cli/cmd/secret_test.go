@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecretCommands(t *testing.T) {
+	t.Parallel()
+	app, stdout := newTestApp()
+	app.Env = MapEnvironment{"HOME": "/home/test", envSecretsPassphrase: "passphrase"}
+	app.Config = &Config{Plugins: map[string]PluginConfig{
+		"test": {Secrets: map[string]string{"GITHUB_TOKEN": "github-token"}},
+	}}
+
+	assert.Equal(t, 0, app.Run([]string{"secret", "set", "github-token", "ghp_s3cr3t"}))
+	app.Stdin = strings.NewReader("hunter2\n")
+	assert.Equal(t, 0, app.Run([]string{"secret", "set", "db-password"}))
+	assert.Equal(t, 0, app.Run([]string{"secret", "list"}))
+	assert.Equal(t, 0, app.Run([]string{"secret", "get", "db-password"}))
+
+	assert.Equal(t, ""+
+		"Stored secret github-token.\n"+
+		"Stored secret db-password.\n"+
+		"db-password\n"+
+		"github-token (test as GITHUB_TOKEN)\n"+
+		"hunter2\n", stdout.String())
+
+	env, err := app.secretEnv(app.Config.Plugins["test"].Secrets)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"GITHUB_TOKEN=ghp_s3cr3t"}, env)
+
+	history, err := app.loadHistory()
+	assert.NoError(t, err)
+	assert.Empty(t, history, "secret commands are not recorded")
+}
+
+func TestPluginEnvLeavesOutPassphrase(t *testing.T) {
+	t.Parallel()
+	app, _ := newTestApp()
+	app.Env = MapEnvironment{"HOME": "/home/test", envSecretsPassphrase: "passphrase"}
+
+	env := app.pluginEnv("/home/test/.foo/plugins/awesome-test")
+
+	assert.Contains(t, env, "HOME=/home/test")
+	for _, entry := range env {
+		assert.NotContains(t, entry, envSecretsPassphrase)
+	}
+}
+
+func TestSecretSetPromptsInTerminal(t *testing.T) {
+	t.Parallel()
+	app, _ := newTestApp()
+	var stderr bytes.Buffer
+	app.Stderr = &stderr
+	app.Stdin = strings.NewReader("s3cr3t\nnew passphrase\nnew passphrase\n")
+	app.isTerminal = func(any) bool { return true }
+
+	assert.Equal(t, 0, app.Run([]string{"secret", "set", "token"}))
+
+	assert.Equal(t, "Value for token: \nNew vault passphrase: \nRepeat passphrase: \n", stderr.String())
+	value, err := newVaultStore(app.Fs, "/home/test/.foo/secrets.vault", fixedPassphrase("new passphrase")).Get("token")
+	assert.NoError(t, err)
+	assert.Equal(t, "s3cr3t", value)
+}
+
+func TestSecretVaultLockedWithoutTerminal(t *testing.T) {
+	t.Parallel()
+	app, _ := newTestApp()
+	var stderr bytes.Buffer
+	app.Stderr = &stderr
+
+	assert.Equal(t, 1, app.Run([]string{"secret", "set", "token", "value"}))
+	assert.Equal(t, "Error: the secrets vault is locked, set AWESOME_CLI_SECRETS_PASSPHRASE or run in a terminal\n", stderr.String())
+}
+
+func TestSecretConfigValidation(t *testing.T) {
+	t.Parallel()
+	invalidEnv := &Config{Plugins: map[string]PluginConfig{"test": {Secrets: map[string]string{"GITHUB-TOKEN": "token"}}}}
+	assert.ErrorContains(t, invalidEnv.validate(), `"GITHUB-TOKEN" is not a valid environment variable name`)
+	invalidSecret := &Config{Plugins: map[string]PluginConfig{"test": {Secrets: map[string]string{"TOKEN": "my token"}}}}
+	assert.ErrorContains(t, invalidSecret.validate(), `invalid secret name "my token"`)
+	assert.ErrorContains(t, (&Config{SecretsFile: "vault"}).validate(), "must be an absolute path")
+}
@@ -0,0 +1,241 @@
+package cmd
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/spf13/afero"
+	"golang.org/x/crypto/scrypt"
+)
+
+// envSecretsPassphrase holds the passphrase of the secrets vault, for
+// non-interactive use such as CI.
+const envSecretsPassphrase = "AWESOME_CLI_SECRETS_PASSPHRASE"
+
+// vaultFormatVersion is the version of the vault file format.
+const vaultFormatVersion = 1
+
+// SecretProvider stores named secrets for injection into plugins.
+type SecretProvider interface {
+	// Get returns the value of the secret called name.
+	Get(name string) (string, error)
+	// Set stores value as the secret called name.
+	Set(name, value string) error
+	// Delete removes the secret called name.
+	Delete(name string) error
+	// List returns the names of all secrets, sorted.
+	List() ([]string, error)
+}
+
+// errSecretNotFound is returned by Get and Delete for unknown secrets.
+var errSecretNotFound = errors.New("secret not found")
+
+// scryptParams are the key derivation settings stored in a vault file.
+type scryptParams struct {
+	Salt []byte `json:"salt"`
+	N    int    `json:"n"`
+	R    int    `json:"r"`
+	P    int    `json:"p"`
+}
+
+// defaultScryptParams are used when creating a vault. They are the only
+// cost settings read back, so a vault file cannot demand unbounded memory or
+// time from the key derivation.
+var defaultScryptParams = scryptParams{N: 1 << 15, R: 8, P: 1}
+
+// supported reports whether p uses the cost settings of defaultScryptParams
+// and has a salt.
+func (p scryptParams) supported() bool {
+	return p.N == defaultScryptParams.N && p.R == defaultScryptParams.R && p.P == defaultScryptParams.P && len(p.Salt) > 0
+}
+
+// vaultFile is the on-disk form of a vault: the secrets as JSON, encrypted
+// with AES-256-GCM under a key derived from the passphrase with scrypt.
+type vaultFile struct {
+	Version    int          `json:"version"`
+	KDF        scryptParams `json:"kdf"`
+	Nonce      []byte       `json:"nonce"`
+	Ciphertext []byte       `json:"ciphertext"`
+}
+
+// vaultStore is a SecretProvider backed by an encrypted file. The passphrase
+// is asked for only when the vault is first read or created.
+type vaultStore struct {
+	fs   afero.Fs
+	path string
+	// passphrase returns the vault passphrase, confirming it when create is set.
+	passphrase func(create bool) (string, error)
+
+	loaded  bool
+	secrets map[string]string
+	kdf     scryptParams
+	key     []byte
+}
+
+func newVaultStore(fs afero.Fs, path string, passphrase func(create bool) (string, error)) *vaultStore {
+	return &vaultStore{fs: fs, path: path, passphrase: passphrase}
+}
+
+func (v *vaultStore) Get(name string) (string, error) {
+	if err := v.load(); err != nil {
+		return "", err
+	}
+	value, ok := v.secrets[name]
+	if !ok {
+		return "", fmt.Errorf("%s: %w", name, errSecretNotFound)
+	}
+	return value, nil
+}
+
+func (v *vaultStore) Set(name, value string) error {
+	if err := v.load(); err != nil {
+		return err
+	}
+	v.secrets[name] = value
+	return v.save()
+}
+
+func (v *vaultStore) Delete(name string) error {
+	if err := v.load(); err != nil {
+		return err
+	}
+	if _, ok := v.secrets[name]; !ok {
+		return fmt.Errorf("%s: %w", name, errSecretNotFound)
+	}
+	delete(v.secrets, name)
+	return v.save()
+}
+
+func (v *vaultStore) List() ([]string, error) {
+	if err := v.load(); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(v.secrets))
+	for name := range v.secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// load decrypts the vault. A missing vault is empty and only asks for a
+// passphrase once something is saved.
+func (v *vaultStore) load() error {
+	if v.loaded {
+		return nil
+	}
+	data, err := afero.ReadFile(v.fs, v.path)
+	if os.IsNotExist(err) {
+		v.secrets = make(map[string]string)
+		v.loaded = true
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var file vaultFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("reading vault %s: %w", v.path, err)
+	}
+	if file.Version != vaultFormatVersion {
+		return fmt.Errorf("vault %s has version %d, this awesome-cli reads version %d", v.path, file.Version, vaultFormatVersion)
+	}
+	if !file.KDF.supported() {
+		return fmt.Errorf("corrupt vault %s: unsupported key derivation settings n=%d r=%d p=%d", v.path, file.KDF.N, file.KDF.R, file.KDF.P)
+	}
+	passphrase, err := v.passphrase(false)
+	if err != nil {
+		return err
+	}
+	key, err := deriveVaultKey(passphrase, file.KDF)
+	if err != nil {
+		return err
+	}
+	gcm, err := newVaultCipher(key)
+	if err != nil {
+		return err
+	}
+	plaintext, err := gcm.Open(nil, file.Nonce, file.Ciphertext, nil)
+	if err != nil {
+		return fmt.Errorf("cannot decrypt vault %s: wrong passphrase or corrupted file", v.path)
+	}
+	secrets := make(map[string]string)
+	if err := json.Unmarshal(plaintext, &secrets); err != nil {
+		return fmt.Errorf("reading vault %s: %w", v.path, err)
+	}
+
+	v.secrets, v.kdf, v.key, v.loaded = secrets, file.KDF, key, true
+	return nil
+}
+
+// save encrypts the secrets with a fresh nonce and replaces the vault file.
+func (v *vaultStore) save() error {
+	if v.key == nil {
+		passphrase, err := v.passphrase(true)
+		if err != nil {
+			return err
+		}
+		v.kdf = defaultScryptParams
+		v.kdf.Salt = make([]byte, 16)
+		if _, err := rand.Read(v.kdf.Salt); err != nil {
+			return err
+		}
+		if v.key, err = deriveVaultKey(passphrase, v.kdf); err != nil {
+			return err
+		}
+	}
+
+	plaintext, err := json.Marshal(v.secrets)
+	if err != nil {
+		return err
+	}
+	gcm, err := newVaultCipher(v.key)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(vaultFile{
+		Version:    vaultFormatVersion,
+		KDF:        v.kdf,
+		Nonce:      nonce,
+		Ciphertext: gcm.Seal(nil, nonce, plaintext, nil),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := v.fs.MkdirAll(filepath.Dir(v.path), 0700); err != nil {
+		return err
+	}
+	tmp := v.path + ".tmp"
+	if err := afero.WriteFile(v.fs, tmp, data, 0600); err != nil {
+		return err
+	}
+	return v.fs.Rename(tmp, v.path)
+}
+
+func deriveVaultKey(passphrase string, params scryptParams) ([]byte, error) {
+	if passphrase == "" {
+		return nil, errors.New("the vault passphrase must not be empty")
+	}
+	return scrypt.Key([]byte(passphrase), params.Salt, params.N, params.R, params.P, 32)
+}
+
+func newVaultCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
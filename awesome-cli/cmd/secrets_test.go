@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func fixedPassphrase(passphrase string) func(bool) (string, error) {
+	return func(bool) (string, error) { return passphrase, nil }
+}
+
+func TestVaultStoreRoundTrip(t *testing.T) {
+	t.Parallel()
+	fs := afero.NewMemMapFs()
+	vault := newVaultStore(fs, "/home/test/.foo/secrets.vault", fixedPassphrase("correct horse"))
+
+	assert.NoError(t, vault.Set("github-token", "ghp_s3cr3t"))
+	assert.NoError(t, vault.Set("db-password", "hunter2"))
+
+	data, _ := afero.ReadFile(fs, "/home/test/.foo/secrets.vault")
+	assert.NotContains(t, string(data), "ghp_s3cr3t")
+	assert.NotContains(t, string(data), "github-token", "names are encrypted too")
+	info, _ := fs.Stat("/home/test/.foo/secrets.vault")
+	assert.Equal(t, "-rw-------", info.Mode().String())
+
+	reopened := newVaultStore(fs, "/home/test/.foo/secrets.vault", fixedPassphrase("correct horse"))
+	value, err := reopened.Get("github-token")
+	assert.NoError(t, err)
+	assert.Equal(t, "ghp_s3cr3t", value)
+	names, _ := reopened.List()
+	assert.Equal(t, []string{"db-password", "github-token"}, names)
+
+	assert.NoError(t, reopened.Delete("db-password"))
+	_, err = reopened.Get("db-password")
+	assert.True(t, errors.Is(err, errSecretNotFound))
+}
+
+func TestVaultStoreWrongPassphrase(t *testing.T) {
+	t.Parallel()
+	fs := afero.NewMemMapFs()
+	assert.NoError(t, newVaultStore(fs, "/vault", fixedPassphrase("right")).Set("name", "value"))
+
+	_, err := newVaultStore(fs, "/vault", fixedPassphrase("wrong")).Get("name")
+
+	assert.EqualError(t, err, "cannot decrypt vault /vault: wrong passphrase or corrupted file")
+}
+
+func TestVaultStoreRejectsUnsupportedKDFSettings(t *testing.T) {
+	t.Parallel()
+	fs := afero.NewMemMapFs()
+	assert.NoError(t, newVaultStore(fs, "/vault", fixedPassphrase("right")).Set("name", "value"))
+	data, _ := afero.ReadFile(fs, "/vault")
+	afero.WriteFile(fs, "/vault", bytes.Replace(data, []byte(`"n": 32768`), []byte(`"n": 1073741824`), 1), 0600)
+
+	_, err := newVaultStore(fs, "/vault", func(bool) (string, error) {
+		return "", errors.New("should not be asked")
+	}).Get("name")
+
+	assert.EqualError(t, err, "corrupt vault /vault: unsupported key derivation settings n=1073741824 r=8 p=1")
+}
+
+func TestVaultStoreDoesNotAskForPassphraseWhenEmpty(t *testing.T) {
+	t.Parallel()
+	vault := newVaultStore(afero.NewMemMapFs(), "/vault", func(bool) (string, error) {
+		return "", errors.New("should not be asked")
+	})
+
+	names, err := vault.List()
+
+	assert.NoError(t, err)
+	assert.Empty(t, names)
+}
@@ -0,0 +1,439 @@
+package cmd
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/spf13/afero"
+	"github.com/spf13/cobra"
+)
+
+// releaseChannels are the channels a release feed may publish.
+var releaseChannels = []string{"stable", "beta"}
+
+const (
+	defaultReleaseChannel = "stable"
+	// updateCheckInterval is how often the new version notice checks the feed.
+	updateCheckInterval = 24 * time.Hour
+	// updateNoticeTimeout bounds the feed request made for the notice.
+	updateNoticeTimeout = 2 * time.Second
+
+	maxFeedSize     = 1 << 20
+	maxArtifactSize = 256 << 20
+)
+
+// envNoUpdateCheck disables the new version notice when set, for scripts and
+// for the new binary's test run during self-update.
+const envNoUpdateCheck = "AWESOME_CLI_NO_UPDATE_CHECK"
+
+// releaseFeed is the releases.json document published for self-update.
+type releaseFeed struct {
+	Channels map[string]release `json:"channels"`
+}
+
+type release struct {
+	Version   string            `json:"version"`
+	Artifacts []releaseArtifact `json:"artifacts"`
+}
+
+// releaseArtifact is a binary for one platform. URL may be relative to the
+// feed. Signature is the base64 ed25519 signature of the message returned by
+// signedReleaseMessage.
+type releaseArtifact struct {
+	OS        string `json:"os"`
+	Arch      string `json:"arch"`
+	URL       string `json:"url"`
+	SHA256    string `json:"sha256"`
+	Signature string `json:"signature"`
+}
+
+// updateCheck is cached between runs so the notice checks at most once a day.
+type updateCheck struct {
+	CheckedAt time.Time `json:"checkedAt"`
+	// Channel is the channel Latest was read from, the cache is stale once
+	// another channel is configured.
+	Channel string `json:"channel"`
+	Latest  string `json:"latest"`
+}
+
+func isReleaseChannel(channel string) bool {
+	for _, known := range releaseChannels {
+		if channel == known {
+			return true
+		}
+	}
+	return false
+}
+
+func decodePublicKey(encoded string) (ed25519.PublicKey, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base64: %w", err)
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("expected a %d byte ed25519 key, got %d bytes", ed25519.PublicKeySize, len(key))
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+func (a *App) newSelfUpdateCommand() *cobra.Command {
+	var channel string
+	var checkOnly, force, allowDowngrade bool
+	selfUpdateCmd := &cobra.Command{
+		Use:   "self-update",
+		Short: "Updates awesome-cli to the latest release",
+		Long: `This command downloads the latest awesome-cli release for this platform from
+the release feed configured under update.feed, verifies its checksum and
+signature and replaces the running binary, rolling back if anything fails.
+
+A release older than the running version is only installed with
+--allow-downgrade, even with --force. Set AWESOME_CLI_NO_UPDATE_CHECK to turn
+off the new version notice other commands print.`,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			config, err := a.config()
+			if err != nil {
+				return err
+			}
+			if channel == "" {
+				channel = config.Update.Channel
+			}
+			if channel == "" {
+				channel = defaultReleaseChannel
+			}
+			return a.selfUpdate(cmd.Context(), cmd.OutOrStdout(), config.Update, channel, checkOnly, force, allowDowngrade)
+		},
+	}
+	selfUpdateCmd.Flags().StringVar(&channel, "channel", "", "Release channel to update from: stable or beta (default from config, else stable)")
+	selfUpdateCmd.Flags().BoolVar(&checkOnly, "check", false, "Only report whether a new version is available")
+	selfUpdateCmd.Flags().BoolVar(&force, "force", false, "Reinstall even if the current version is up to date")
+	selfUpdateCmd.Flags().BoolVar(&allowDowngrade, "allow-downgrade", false, "Install the channel's release even if it is older than the current version")
+	return selfUpdateCmd
+}
+
+func (a *App) selfUpdate(ctx context.Context, w io.Writer, settings UpdateConfig, channel string, checkOnly, force, allowDowngrade bool) error {
+	if settings.Feed == "" {
+		return errors.New("no release feed configured, set update.feed in " + a.configPath())
+	}
+	if !isReleaseChannel(channel) {
+		return fmt.Errorf("unknown channel %q, choose one of %s", channel, strings.Join(releaseChannels, ", "))
+	}
+
+	feed, err := a.fetchFeed(ctx, settings.Feed)
+	if err != nil {
+		return err
+	}
+	latest, ok := feed.Channels[channel]
+	if !ok {
+		return fmt.Errorf("release feed has no %s channel", channel)
+	}
+	current := currentBuildInfo().Version
+	newer, err := isNewerVersion(latest.Version, current)
+	if err != nil {
+		return err
+	}
+	older := isOlderVersion(latest.Version, current)
+	switch {
+	case older && allowDowngrade:
+	case older && force:
+		return fmt.Errorf("the %s channel has %s, older than %s, use --allow-downgrade to install it", channel, latest.Version, current)
+	case older:
+		fmt.Fprintf(w, "awesome-cli %s is newer than %s on the %s channel, use --allow-downgrade to install it\n", current, latest.Version, channel)
+		return nil
+	case !newer && !force:
+		fmt.Fprintf(w, "awesome-cli %s is up to date (%s channel)\n", current, channel)
+		return nil
+	}
+	if checkOnly {
+		fmt.Fprintf(w, "awesome-cli %s is available (%s channel), you have %s\n", latest.Version, channel, current)
+		return nil
+	}
+
+	// Check the key before downloading anything
+	if settings.PublicKey == "" {
+		return errors.New("no signing key configured, set update.publicKey to verify releases")
+	}
+	publicKey, err := decodePublicKey(settings.PublicKey)
+	if err != nil {
+		return err
+	}
+	artifact, err := latest.artifactFor(runtime.GOOS, runtime.GOARCH)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "Downloading awesome-cli %s for %s/%s...\n", latest.Version, runtime.GOOS, runtime.GOARCH)
+	data, err := a.fetchResource(ctx, settings.Feed, artifact.URL, maxArtifactSize)
+	if err != nil {
+		return fmt.Errorf("downloading %s: %w", artifact.URL, err)
+	}
+	if err := verifyArtifact(data, latest.Version, artifact, publicKey); err != nil {
+		return err
+	}
+
+	path, err := a.executablePath()
+	if err != nil {
+		return fmt.Errorf("locating the running binary: %w", err)
+	}
+	if err := a.replaceExecutable(path, data); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Updated %s from %s to %s\n", path, current, latest.Version)
+	return nil
+}
+
+func (r release) artifactFor(goos, goarch string) (releaseArtifact, error) {
+	for _, artifact := range r.Artifacts {
+		if artifact.OS == goos && artifact.Arch == goarch {
+			return artifact, nil
+		}
+	}
+	return releaseArtifact{}, fmt.Errorf("release %s has no artifact for %s/%s", r.Version, goos, goarch)
+}
+
+// isNewerVersion reports whether candidate is newer than current. A current
+// version that is not semver, such as a development build, is always older.
+func isNewerVersion(candidate, current string) (bool, error) {
+	candidateVersion, err := semver.NewVersion(candidate)
+	if err != nil {
+		return false, fmt.Errorf("release feed has invalid version %q: %w", candidate, err)
+	}
+	currentVersion, err := semver.NewVersion(current)
+	if err != nil {
+		return true, nil
+	}
+	return candidateVersion.GreaterThan(currentVersion), nil
+}
+
+// isOlderVersion reports whether candidate, a valid semver version, is older
+// than current. Nothing is older than a development build.
+func isOlderVersion(candidate, current string) bool {
+	currentVersion, err := semver.NewVersion(current)
+	if err != nil {
+		return false
+	}
+	return semver.MustParse(candidate).LessThan(currentVersion)
+}
+
+// signedReleaseMessage returns the message signed for the artifact of version
+// for goos/goarch with the given SHA-256 digest. Signing the version and
+// platform along with the digest keeps a feed from passing off an older
+// release as the latest or one platform's binary as another's.
+func signedReleaseMessage(version, goos, goarch string, digest []byte) []byte {
+	return []byte(fmt.Sprintf("awesome-cli %s %s/%s sha256:%s", version, goos, goarch, hex.EncodeToString(digest)))
+}
+
+// verifyArtifact checks data against the checksum and signature of the
+// artifact, published as version.
+func verifyArtifact(data []byte, version string, artifact releaseArtifact, publicKey ed25519.PublicKey) error {
+	digest := sha256.Sum256(data)
+	if !strings.EqualFold(hex.EncodeToString(digest[:]), artifact.SHA256) {
+		return fmt.Errorf("checksum mismatch for %s", artifact.URL)
+	}
+	signature, err := base64.StdEncoding.DecodeString(artifact.Signature)
+	if err != nil {
+		return fmt.Errorf("invalid signature for %s: %w", artifact.URL, err)
+	}
+	if !ed25519.Verify(publicKey, signedReleaseMessage(version, artifact.OS, artifact.Arch, digest[:]), signature) {
+		return fmt.Errorf("signature verification failed for %s", artifact.URL)
+	}
+	return nil
+}
+
+// replaceExecutable swaps the binary at path for data. A copy of the old
+// binary is kept until the new one runs, and is restored if it doesn't. The
+// new binary is renamed over the old one, so there always is a binary at
+// path.
+func (a *App) replaceExecutable(path string, data []byte) error {
+	info, err := a.Fs.Stat(path)
+	if err != nil {
+		return err
+	}
+	newPath, oldPath := path+".new", path+".old"
+
+	if err := afero.WriteFile(a.Fs, newPath, data, info.Mode().Perm()|0111); err != nil {
+		return fmt.Errorf("writing new binary: %w", err)
+	}
+	current, err := afero.ReadFile(a.Fs, path)
+	if err == nil {
+		err = afero.WriteFile(a.Fs, oldPath, current, info.Mode().Perm())
+	}
+	if err != nil {
+		a.Fs.Remove(newPath)
+		return fmt.Errorf("backing up current binary: %w", err)
+	}
+	if err := a.Fs.Rename(newPath, path); err != nil {
+		a.Fs.Remove(newPath)
+		a.Fs.Remove(oldPath)
+		return fmt.Errorf("installing new binary: %w", err)
+	}
+	// Without the update check, which would reach out to the feed again
+	if output, err := a.commandOutputWithEnv([]string{envNoUpdateCheck + "=1"}, path, "version"); err != nil {
+		if rollbackErr := a.Fs.Rename(oldPath, path); rollbackErr != nil {
+			return fmt.Errorf("new binary failed to run: %v: %s; rolling back failed too, the previous binary is at %s: %w",
+				err, strings.TrimSpace(string(output)), oldPath, rollbackErr)
+		}
+		return fmt.Errorf("new binary failed to run, rolled back: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	a.Fs.Remove(oldPath) // Best effort, may fail on platforms that lock running binaries
+	return nil
+}
+
+// fetchFeed reads and parses the release feed at location.
+func (a *App) fetchFeed(ctx context.Context, location string) (*releaseFeed, error) {
+	data, err := a.fetchResource(ctx, location, "", maxFeedSize)
+	if err != nil {
+		return nil, fmt.Errorf("reading release feed: %w", err)
+	}
+	feed := &releaseFeed{}
+	if err := json.Unmarshal(data, feed); err != nil {
+		return nil, fmt.Errorf("parsing release feed: %w", err)
+	}
+	return feed, nil
+}
+
+// fetchResource reads ref relative to the feed location, or the feed itself
+// when ref is empty. Feeds are HTTP(S) URLs, releases.json files or
+// directories containing a releases.json.
+func (a *App) fetchResource(ctx context.Context, feed, ref string, limit int64) ([]byte, error) {
+	if isHTTPURL(ref) {
+		return a.fetchHTTP(ctx, ref, limit)
+	}
+	if isHTTPURL(feed) {
+		base, err := url.Parse(feed)
+		if err != nil {
+			return nil, err
+		}
+		target := base
+		if ref != "" {
+			relative, err := url.Parse(ref)
+			if err != nil {
+				return nil, err
+			}
+			target = base.ResolveReference(relative)
+		}
+		return a.fetchHTTP(ctx, target.String(), limit)
+	}
+
+	feedFile := feed
+	if info, err := a.Fs.Stat(feed); err == nil && info.IsDir() {
+		feedFile = filepath.Join(feed, "releases.json")
+	}
+	target := feedFile
+	if ref != "" {
+		target = ref
+		if !filepath.IsAbs(ref) {
+			target = filepath.Join(filepath.Dir(feedFile), ref)
+		}
+	}
+	file, err := a.Fs.Open(target)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return readLimited(file, limit)
+}
+
+func (a *App) fetchHTTP(ctx context.Context, target string, limit int64) ([]byte, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := a.client().Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", target, response.Status)
+	}
+	return readLimited(response.Body, limit)
+}
+
+func readLimited(r io.Reader, limit int64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("response larger than %d bytes", limit)
+	}
+	return data, nil
+}
+
+func isHTTPURL(location string) bool {
+	return strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://")
+}
+
+// updateCheckPath returns the file the last update check is cached in.
+func (a *App) updateCheckPath() string {
+	return filepath.Join(a.Env.Getenv("HOME"), ".foo", "update-check.json")
+}
+
+// updateNotice returns a message announcing a newer release, or an empty
+// string. The feed is consulted at most once per updateCheckInterval; failures
+// are silent so the notice never gets in the way of the command that ran.
+func (a *App) updateNotice() string {
+	return a.updateNoticeFor(currentBuildInfo().Version)
+}
+
+// updateNoticeFor returns the update notice for a binary at version current.
+// Development builds, whose version is not semver, get no notice, nor does
+// anything when envNoUpdateCheck is set.
+func (a *App) updateNoticeFor(current string) string {
+	if _, err := semver.NewVersion(current); err != nil || a.Env.Getenv(envNoUpdateCheck) != "" {
+		return ""
+	}
+	config, err := a.config()
+	if err != nil || config.Update.Feed == "" {
+		return ""
+	}
+	channel := config.Update.Channel
+	if channel == "" {
+		channel = defaultReleaseChannel
+	}
+
+	var cached updateCheck
+	if data, err := afero.ReadFile(a.Fs, a.updateCheckPath()); err == nil {
+		json.Unmarshal(data, &cached)
+	}
+	now := a.currentTime()
+	if cached.Channel != channel || now.Sub(cached.CheckedAt) >= updateCheckInterval {
+		ctx, cancel := context.WithTimeout(context.Background(), updateNoticeTimeout)
+		defer cancel()
+		cached = updateCheck{CheckedAt: now, Channel: channel}
+		if feed, err := a.fetchFeed(ctx, config.Update.Feed); err == nil {
+			cached.Latest = feed.Channels[channel].Version
+		}
+		if data, err := json.Marshal(cached); err == nil {
+			a.Fs.MkdirAll(filepath.Dir(a.updateCheckPath()), 0755)
+			afero.WriteFile(a.Fs, a.updateCheckPath(), data, 0644)
+		}
+	}
+
+	if cached.Latest == "" {
+		return ""
+	}
+	if newer, err := isNewerVersion(cached.Latest, current); err != nil || !newer {
+		return ""
+	}
+	return fmt.Sprintf("A new version of awesome-cli is available: %s (you have %s). Run `awesome-cli self-update` to upgrade.", cached.Latest, current)
+}
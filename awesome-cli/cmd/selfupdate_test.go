@@ -0,0 +1,387 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+const testExecutable = "/usr/local/bin/awesome-cli"
+
+type testRelease struct {
+	publicKey  string
+	privateKey ed25519.PrivateKey
+	binary     []byte
+	feed       releaseFeed
+}
+
+// newTestRelease returns a signed v9.0.0 stable release for the current platform.
+func newTestRelease(t *testing.T) *testRelease {
+	t.Helper()
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary := []byte("new awesome-cli binary")
+	digest := sha256.Sum256(binary)
+	return &testRelease{
+		publicKey:  base64.StdEncoding.EncodeToString(publicKey),
+		privateKey: privateKey,
+		binary:     binary,
+		feed: releaseFeed{Channels: map[string]release{
+			"stable": {
+				Version: "v9.0.0",
+				Artifacts: []releaseArtifact{{
+					OS:        runtime.GOOS,
+					Arch:      runtime.GOARCH,
+					URL:       "awesome-cli-v9.0.0",
+					SHA256:    hex.EncodeToString(digest[:]),
+					Signature: signRelease(privateKey, "v9.0.0", runtime.GOOS, runtime.GOARCH, binary),
+				}},
+			},
+		}},
+	}
+}
+
+func signRelease(privateKey ed25519.PrivateKey, version, goos, goarch string, binary []byte) string {
+	digest := sha256.Sum256(binary)
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, signedReleaseMessage(version, goos, goarch, digest[:])))
+}
+
+// serve publishes the release over HTTP and returns the feed URL and a
+// counter of feed requests.
+func (r *testRelease) serve(t *testing.T) (string, *int32) {
+	var feedRequests int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/releases/releases.json", func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&feedRequests, 1)
+		json.NewEncoder(w).Encode(r.feed)
+	})
+	mux.HandleFunc("/releases/awesome-cli-v9.0.0", func(w http.ResponseWriter, req *http.Request) {
+		w.Write(r.binary)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server.URL + "/releases/releases.json", &feedRequests
+}
+
+// newUpdateTestApp returns an App with an installed binary that runs
+// successfully unless runErr is set.
+func newUpdateTestApp(runErr error) *App {
+	app, _ := newTestApp()
+	afero.WriteFile(app.Fs, testExecutable, []byte("old awesome-cli binary"), 0755)
+	app.executable = func() (string, error) { return testExecutable, nil }
+	app.runCommand = func(env []string, name string, args ...string) ([]byte, error) { return nil, runErr }
+	return app
+}
+
+func TestSelfUpdateFromHTTPFeed(t *testing.T) {
+	t.Parallel()
+	release := newTestRelease(t)
+	feed, _ := release.serve(t)
+	app := newUpdateTestApp(nil)
+
+	var out bytes.Buffer
+	err := app.selfUpdate(context.Background(), &out, UpdateConfig{Feed: feed, PublicKey: release.publicKey}, "stable", false, false, false)
+
+	assert.NoError(t, err)
+	assert.Contains(t, out.String(), "Updated /usr/local/bin/awesome-cli from v1.0.0 to v9.0.0")
+	installed, _ := afero.ReadFile(app.Fs, testExecutable)
+	assert.Equal(t, release.binary, installed)
+	info, _ := app.Fs.Stat(testExecutable)
+	assert.Equal(t, "-rwxr-xr-x", info.Mode().String())
+	exists, _ := afero.Exists(app.Fs, testExecutable+".old")
+	assert.False(t, exists)
+}
+
+func TestSelfUpdateFromDirectoryMirror(t *testing.T) {
+	t.Parallel()
+	release := newTestRelease(t)
+	app := newUpdateTestApp(nil)
+	feed, _ := json.Marshal(release.feed)
+	afero.WriteFile(app.Fs, "/mnt/mirror/releases.json", feed, 0644)
+	afero.WriteFile(app.Fs, "/mnt/mirror/awesome-cli-v9.0.0", release.binary, 0644)
+
+	err := app.selfUpdate(context.Background(), &bytes.Buffer{}, UpdateConfig{Feed: "/mnt/mirror", PublicKey: release.publicKey}, "stable", false, false, false)
+
+	assert.NoError(t, err)
+	installed, _ := afero.ReadFile(app.Fs, testExecutable)
+	assert.Equal(t, release.binary, installed)
+}
+
+func TestSelfUpdateRollsBackWhenNewBinaryFails(t *testing.T) {
+	t.Parallel()
+	release := newTestRelease(t)
+	feed, _ := release.serve(t)
+	app := newUpdateTestApp(errors.New("exec format error"))
+
+	err := app.selfUpdate(context.Background(), &bytes.Buffer{}, UpdateConfig{Feed: feed, PublicKey: release.publicKey}, "stable", false, false, false)
+
+	assert.ErrorContains(t, err, "new binary failed to run, rolled back")
+	installed, _ := afero.ReadFile(app.Fs, testExecutable)
+	assert.Equal(t, "old awesome-cli binary", string(installed))
+}
+
+// renameFailingFs fails to rename files ending in suffix.
+type renameFailingFs struct {
+	afero.Fs
+	suffix string
+}
+
+func (fs renameFailingFs) Rename(oldname, newname string) error {
+	if strings.HasSuffix(oldname, fs.suffix) {
+		return errors.New("permission denied")
+	}
+	return fs.Fs.Rename(oldname, newname)
+}
+
+func TestSelfUpdateReportsFailedRollback(t *testing.T) {
+	t.Parallel()
+	release := newTestRelease(t)
+	feed, _ := release.serve(t)
+	app := newUpdateTestApp(errors.New("exec format error"))
+	app.Fs = renameFailingFs{Fs: app.Fs, suffix: ".old"}
+
+	err := app.selfUpdate(context.Background(), &bytes.Buffer{}, UpdateConfig{Feed: feed, PublicKey: release.publicKey}, "stable", false, false, false)
+
+	assert.ErrorContains(t, err, "rolling back failed too, the previous binary is at "+testExecutable+".old: permission denied")
+	assert.NotContains(t, err.Error(), "rolled back")
+	kept, _ := afero.ReadFile(app.Fs, testExecutable+".old")
+	assert.Equal(t, "old awesome-cli binary", string(kept))
+}
+
+func TestSelfUpdateRunsNewBinaryWithoutUpdateCheck(t *testing.T) {
+	t.Parallel()
+	release := newTestRelease(t)
+	feed, _ := release.serve(t)
+	app := newUpdateTestApp(nil)
+	var ran []string
+	app.runCommand = func(env []string, name string, args ...string) ([]byte, error) {
+		ran = append(append(ran, env...), name)
+		return nil, nil
+	}
+
+	err := app.selfUpdate(context.Background(), &bytes.Buffer{}, UpdateConfig{Feed: feed, PublicKey: release.publicKey}, "stable", false, false, false)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{envNoUpdateCheck + "=1", testExecutable}, ran)
+}
+
+func TestSelfUpdateRefusesDowngrades(t *testing.T) {
+	t.Parallel()
+	published := newTestRelease(t)
+	older := published.feed.Channels["stable"]
+	older.Version = "v0.9.0"
+	older.Artifacts[0].Signature = signRelease(published.privateKey, "v0.9.0", runtime.GOOS, runtime.GOARCH, published.binary)
+	published.feed.Channels["stable"] = older
+	feed, _ := published.serve(t)
+	settings := UpdateConfig{Feed: feed, PublicKey: published.publicKey}
+
+	app := newUpdateTestApp(nil)
+	var out bytes.Buffer
+	assert.NoError(t, app.selfUpdate(context.Background(), &out, settings, "stable", false, false, false))
+	assert.Equal(t, "awesome-cli v1.0.0 is newer than v0.9.0 on the stable channel, use --allow-downgrade to install it\n", out.String())
+
+	out.Reset()
+	assert.NoError(t, app.selfUpdate(context.Background(), &out, settings, "stable", true, false, false))
+	assert.Equal(t, "awesome-cli v1.0.0 is newer than v0.9.0 on the stable channel, use --allow-downgrade to install it\n", out.String(), "--check reports it too")
+
+	err := app.selfUpdate(context.Background(), &out, settings, "stable", false, true, false)
+	assert.EqualError(t, err, "the stable channel has v0.9.0, older than v1.0.0, use --allow-downgrade to install it")
+	installed, _ := afero.ReadFile(app.Fs, testExecutable)
+	assert.Equal(t, "old awesome-cli binary", string(installed))
+
+	assert.NoError(t, app.selfUpdate(context.Background(), &out, settings, "stable", false, false, true))
+	installed, _ = afero.ReadFile(app.Fs, testExecutable)
+	assert.Equal(t, published.binary, installed)
+}
+
+func TestSelfUpdateRejectsTamperedReleases(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		tamper  func(r *testRelease)
+		wantErr string
+	}{
+		{
+			name:    "modified binary",
+			tamper:  func(r *testRelease) { r.binary = []byte("malicious binary") },
+			wantErr: "checksum mismatch",
+		},
+		{
+			name: "wrong key",
+			tamper: func(r *testRelease) {
+				other, _, _ := ed25519.GenerateKey(rand.Reader)
+				r.publicKey = base64.StdEncoding.EncodeToString(other)
+			},
+			wantErr: "signature verification failed",
+		},
+		{
+			name: "older release signed for another version",
+			tamper: func(r *testRelease) {
+				r.feed.Channels["stable"].Artifacts[0].Signature = signRelease(r.privateKey, "v8.0.0", runtime.GOOS, runtime.GOARCH, r.binary)
+			},
+			wantErr: "signature verification failed",
+		},
+		{
+			name: "binary signed for another platform",
+			tamper: func(r *testRelease) {
+				r.feed.Channels["stable"].Artifacts[0].Signature = signRelease(r.privateKey, "v9.0.0", "plan9", runtime.GOARCH, r.binary)
+			},
+			wantErr: "signature verification failed",
+		},
+		{
+			name: "missing platform",
+			tamper: func(r *testRelease) {
+				stable := r.feed.Channels["stable"]
+				stable.Artifacts[0].OS = "plan9"
+				r.feed.Channels["stable"] = stable
+			},
+			wantErr: "has no artifact for " + runtime.GOOS + "/" + runtime.GOARCH,
+		},
+		{
+			name:    "no key",
+			tamper:  func(r *testRelease) { r.publicKey = "" },
+			wantErr: "no signing key configured",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			release := newTestRelease(t)
+			test.tamper(release)
+			feed, _ := release.serve(t)
+			app := newUpdateTestApp(nil)
+
+			err := app.selfUpdate(context.Background(), &bytes.Buffer{}, UpdateConfig{Feed: feed, PublicKey: release.publicKey}, "stable", false, false, false)
+
+			assert.ErrorContains(t, err, test.wantErr)
+			installed, _ := afero.ReadFile(app.Fs, testExecutable)
+			assert.Equal(t, "old awesome-cli binary", string(installed))
+		})
+	}
+}
+
+func TestSelfUpdateChannels(t *testing.T) {
+	t.Parallel()
+	published := newTestRelease(t)
+	published.feed.Channels["stable"] = release{Version: "v1.0.0"}
+	feed, _ := published.serve(t)
+	app := newUpdateTestApp(nil)
+	settings := UpdateConfig{Feed: feed, PublicKey: published.publicKey}
+
+	var out bytes.Buffer
+	assert.NoError(t, app.selfUpdate(context.Background(), &out, settings, "stable", false, false, false))
+	assert.Equal(t, "awesome-cli v1.0.0 is up to date (stable channel)\n", out.String())
+
+	err := app.selfUpdate(context.Background(), &out, settings, "beta", false, false, false)
+	assert.EqualError(t, err, "release feed has no beta channel")
+
+	err = app.selfUpdate(context.Background(), &out, settings, "nightly", false, false, false)
+	assert.ErrorContains(t, err, `unknown channel "nightly"`)
+}
+
+func TestSelfUpdateCheckOnly(t *testing.T) {
+	t.Parallel()
+	release := newTestRelease(t)
+	feed, _ := release.serve(t)
+	app := newUpdateTestApp(nil)
+
+	var out bytes.Buffer
+	err := app.selfUpdate(context.Background(), &out, UpdateConfig{Feed: feed}, "stable", true, false, false)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "awesome-cli v9.0.0 is available (stable channel), you have v1.0.0\n", out.String())
+	installed, _ := afero.ReadFile(app.Fs, testExecutable)
+	assert.Equal(t, "old awesome-cli binary", string(installed))
+}
+
+func TestUpdateNoticeChecksOncePerDay(t *testing.T) {
+	t.Parallel()
+	release := newTestRelease(t)
+	feed, requests := release.serve(t)
+	app, _ := newTestApp()
+	app.Config = &Config{Update: UpdateConfig{Feed: feed}}
+	now := time.Date(2024, 8, 1, 9, 0, 0, 0, time.UTC)
+	app.now = func() time.Time { return now }
+
+	notice := app.updateNotice()
+	assert.Equal(t, "A new version of awesome-cli is available: v9.0.0 (you have v1.0.0). Run `awesome-cli self-update` to upgrade.", notice)
+	assert.Equal(t, int32(1), atomic.LoadInt32(requests))
+
+	now = now.Add(23 * time.Hour)
+	assert.NotEmpty(t, app.updateNotice())
+	assert.Equal(t, int32(1), atomic.LoadInt32(requests), "cached result is used within a day")
+
+	now = now.Add(2 * time.Hour)
+	assert.NotEmpty(t, app.updateNotice())
+	assert.Equal(t, int32(2), atomic.LoadInt32(requests))
+}
+
+func TestUpdateNoticeRechecksWhenChannelChanges(t *testing.T) {
+	t.Parallel()
+	published := newTestRelease(t)
+	published.feed.Channels["beta"] = published.feed.Channels["stable"]
+	published.feed.Channels["stable"] = release{Version: "v1.0.0"}
+	feed, requests := published.serve(t)
+	app, _ := newTestApp()
+	app.Config = &Config{Update: UpdateConfig{Feed: feed}}
+	app.now = func() time.Time { return time.Date(2024, 8, 1, 9, 0, 0, 0, time.UTC) }
+
+	assert.Empty(t, app.updateNotice())
+	app.Config.Update.Channel = "beta"
+	assert.Contains(t, app.updateNotice(), "v9.0.0")
+	assert.Equal(t, int32(2), atomic.LoadInt32(requests), "the stable result is not reused for beta")
+}
+
+func TestUpdateNoticeSkipsDevelopmentBuilds(t *testing.T) {
+	t.Parallel()
+	release := newTestRelease(t)
+	feed, requests := release.serve(t)
+	app, _ := newTestApp()
+	app.Config = &Config{Update: UpdateConfig{Feed: feed}}
+
+	assert.Empty(t, app.updateNoticeFor("(devel)"))
+	assert.Equal(t, int32(0), atomic.LoadInt32(requests))
+}
+
+func TestUpdateNoticeDisabledByEnvironment(t *testing.T) {
+	t.Parallel()
+	release := newTestRelease(t)
+	feed, requests := release.serve(t)
+	app, _ := newTestApp()
+	app.Config = &Config{Update: UpdateConfig{Feed: feed}}
+	app.Env.(MapEnvironment)[envNoUpdateCheck] = "1"
+
+	assert.Empty(t, app.updateNotice())
+	assert.Equal(t, int32(0), atomic.LoadInt32(requests))
+}
+
+func TestUpdateNoticeWithoutFeed(t *testing.T) {
+	t.Parallel()
+	app, _ := newTestApp()
+	assert.Empty(t, app.updateNotice())
+}
+
+func TestUpdateConfigValidation(t *testing.T) {
+	t.Parallel()
+	assert.ErrorContains(t, (&Config{Update: UpdateConfig{Channel: "nightly"}}).validate(), `update channel "nightly"`)
+	assert.ErrorContains(t, (&Config{Update: UpdateConfig{PublicKey: "c2hvcnQ="}}).validate(), "expected a 32 byte ed25519 key")
+	assert.NoError(t, (&Config{Update: UpdateConfig{Channel: "beta"}}).validate())
+}
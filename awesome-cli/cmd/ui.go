@@ -0,0 +1,257 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// recentLauncherEntries is how many history entries the launcher offers.
+const recentLauncherEntries = 5
+
+// launcherEntry is a command the launcher can run.
+type launcherEntry struct {
+	// Args is the command path below the root, or a whole command line for
+	// recent entries.
+	Args        []string
+	Description string
+	Plugin      bool
+	// Recent entries come from the history and are run as they are.
+	Recent bool
+	Flags  []launcherFlag
+}
+
+// launcherFlag is a flag shown as a field of the argument form.
+type launcherFlag struct {
+	Name    string
+	Usage   string
+	Default string
+}
+
+func (e launcherEntry) title() string {
+	return strings.Join(e.Args, " ")
+}
+
+// commandRunner runs awesome-cli with args, sending every line of its
+// combined output to lines, and returns its exit code.
+type commandRunner func(ctx context.Context, args []string, lines chan<- string) (int, error)
+
+func (a *App) newUICommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "ui",
+		Short: "Browses and runs commands and plugins interactively",
+		Long: `This command opens an interactive launcher. Type to fuzzy search the built-in
+commands, plugins and recently run command lines, press enter to fill in
+arguments and enter again to run the command with its output streamed below.
+
+Commands run from the launcher do not get any input. Without a terminal the
+available commands and recent history are printed instead.`,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		Annotations:  map[string]string{skipHistoryAnnotation: "true"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			recent, err := a.recentHistory(recentLauncherEntries)
+			if err != nil {
+				a.log().Info("Failed to read history", "error", err)
+			}
+			entries := launcherEntries(cmd.Root(), recent)
+
+			if !a.stdinIsTerminal() || !a.stdoutIsTerminal() {
+				displayLauncherEntries(cmd.OutOrStdout(), entries)
+				return nil
+			}
+			return runLauncher(cmd.Context(), a.Stdin, a.Stdout, entries, a.streamCommand)
+		},
+	}
+}
+
+// launcherEntries lists the recent command lines followed by every runnable
+// command below root.
+func launcherEntries(root *cobra.Command, recent []historyEntry) []launcherEntry {
+	var entries []launcherEntry
+	for _, entry := range recent {
+		description := "recently run"
+		if entry.ExitCode != 0 {
+			description = fmt.Sprintf("recently run, exited with %d", entry.ExitCode)
+		}
+		entries = append(entries, launcherEntry{Args: entry.Args, Description: description, Recent: true})
+	}
+
+	var walk func(cmd *cobra.Command)
+	walk = func(cmd *cobra.Command) {
+		for _, child := range cmd.Commands() {
+			if !child.IsAvailableCommand() || child.Name() == "completion" || child.Name() == "ui" {
+				continue
+			}
+			if child.HasAvailableSubCommands() {
+				walk(child)
+				continue
+			}
+			_, isPlugin := child.Annotations[pluginPathAnnotation]
+			entries = append(entries, launcherEntry{
+				Args:        strings.Fields(child.CommandPath())[1:],
+				Description: child.Short,
+				Plugin:      isPlugin,
+				Flags:       launcherFlags(child),
+			})
+		}
+	}
+	walk(root)
+	return entries
+}
+
+// launcherFlags returns the flags of cmd shown in the argument form: its own
+// and --output for commands with structured output.
+func launcherFlags(cmd *cobra.Command) []launcherFlag {
+	var flags []launcherFlag
+	add := func(flag *pflag.Flag) {
+		if flag.Hidden || flag.Name == "help" {
+			return
+		}
+		flags = append(flags, launcherFlag{Name: flag.Name, Usage: flag.Usage, Default: flag.DefValue})
+	}
+	cmd.LocalNonPersistentFlags().VisitAll(add)
+	if _, ok := cmd.Annotations[structuredOutputAnnotation]; ok {
+		if output := cmd.InheritedFlags().Lookup("output"); output != nil {
+			add(output)
+		}
+	}
+	return flags
+}
+
+// displayLauncherEntries is the launcher's fallback when there is no terminal.
+func displayLauncherEntries(w io.Writer, entries []launcherEntry) {
+	fmt.Fprintln(w, "The interactive launcher needs a terminal. Run one of these commands instead:")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	var recent []launcherEntry
+	for _, entry := range entries {
+		if entry.Recent {
+			recent = append(recent, entry)
+			continue
+		}
+		description := entry.Description
+		if entry.Plugin {
+			description += " (plugin)"
+		}
+		fmt.Fprintf(tw, "  %s\t%s\n", entry.title(), description)
+	}
+	tw.Flush()
+	if len(recent) > 0 {
+		fmt.Fprintln(w, "Recent:")
+		for _, entry := range recent {
+			fmt.Fprintln(w, "  awesome-cli", entry.title())
+		}
+	}
+}
+
+// buildLauncherArgs turns the values of the argument form into a command
+// line. values[0] holds the positional arguments, the rest the flags in the
+// order of entry.Flags. Flags left at their default are omitted.
+func buildLauncherArgs(entry launcherEntry, values []string) ([]string, error) {
+	args := append([]string(nil), entry.Args...)
+	for i, flag := range entry.Flags {
+		value := strings.TrimSpace(values[i+1])
+		if value == "" || value == flag.Default {
+			continue
+		}
+		args = append(args, "--"+flag.Name+"="+value)
+	}
+	positional, err := splitArgs(values[0])
+	if err != nil {
+		return nil, err
+	}
+	return append(args, positional...), nil
+}
+
+// splitArgs splits s into arguments like a shell would, honouring single and
+// double quotes and backslash escapes.
+func splitArgs(s string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	inArg := false
+	var quote rune
+	escaped := false
+	for _, r := range s {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inArg = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if escaped {
+		return nil, errors.New("trailing backslash")
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
+
+// streamCommand runs the awesome-cli binary with args as a child process, so
+// a failing command cannot take the launcher down with it.
+func (a *App) streamCommand(ctx context.Context, args []string, lines chan<- string) (int, error) {
+	path, err := a.executablePath()
+	if err != nil {
+		return 0, err
+	}
+	reader, writer := io.Pipe()
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Env = a.Env.Environ()
+	cmd.Stdout = writer
+	cmd.Stderr = writer
+	if err := cmd.Start(); err != nil {
+		return 0, err
+	}
+
+	scanned := make(chan struct{})
+	go func() {
+		defer close(scanned)
+		scanner := bufio.NewScanner(reader)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		io.Copy(io.Discard, reader) // Keep the child from blocking on an overlong line
+	}()
+	err = cmd.Wait()
+	writer.Close()
+	<-scanned
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), nil
+	}
+	return 0, err
+}
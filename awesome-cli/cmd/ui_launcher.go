@@ -0,0 +1,437 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+type launcherMode int
+
+const (
+	modeBrowse launcherMode = iota
+	modeForm
+	modeOutput
+)
+
+// maxOutputLines bounds the output pane, older lines are dropped.
+const maxOutputLines = 5000
+
+var (
+	titleStyle    = lipgloss.NewStyle().Bold(true)
+	selectedStyle = lipgloss.NewStyle().Reverse(true)
+	faintStyle    = lipgloss.NewStyle().Faint(true)
+	errorStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("1"))
+)
+
+// outputLineMsg is a line printed by the running command.
+type outputLineMsg string
+
+// commandDoneMsg reports that the running command exited.
+type commandDoneMsg struct {
+	code int
+	err  error
+}
+
+// commandRun is a command started from the launcher.
+type commandRun struct {
+	lines  chan string
+	done   chan commandDoneMsg
+	cancel context.CancelFunc
+}
+
+func startCommand(ctx context.Context, run commandRunner, args []string) *commandRun {
+	ctx, cancel := context.WithCancel(ctx)
+	r := &commandRun{lines: make(chan string, 64), done: make(chan commandDoneMsg, 1), cancel: cancel}
+	go func() {
+		code, err := run(ctx, args, r.lines)
+		if ctx.Err() != nil && err == nil {
+			err = ctx.Err()
+		}
+		close(r.lines)
+		r.done <- commandDoneMsg{code: code, err: err}
+		cancel()
+	}()
+	return r
+}
+
+// next waits for the next line of output, or for the command to exit.
+func (r *commandRun) next() tea.Msg {
+	if line, ok := <-r.lines; ok {
+		return outputLineMsg(line)
+	}
+	return <-r.done
+}
+
+// launcherModel is the state of the interactive launcher.
+type launcherModel struct {
+	ctx     context.Context
+	run     commandRunner
+	entries []launcherEntry
+	mode    launcherMode
+	width   int
+	height  int
+
+	search  textinput.Model
+	matches []launcherEntry
+	cursor  int
+
+	selected launcherEntry
+	fields   []textinput.Model
+	labels   []string
+	focus    int
+	formErr  string
+
+	output  viewport.Model
+	lines   []string
+	args    []string
+	running *commandRun
+	status  string
+}
+
+func newLauncherModel(ctx context.Context, entries []launcherEntry, run commandRunner) *launcherModel {
+	search := textinput.New()
+	search.Prompt = "> "
+	search.Placeholder = "type to search commands and plugins"
+	search.Focus()
+	m := &launcherModel{
+		ctx:     ctx,
+		run:     run,
+		entries: entries,
+		search:  search,
+		output:  viewport.New(80, 20),
+		width:   80,
+		height:  24,
+	}
+	m.filter()
+	return m
+}
+
+// runLauncher shows the launcher until the user quits.
+func runLauncher(ctx context.Context, in io.Reader, out io.Writer, entries []launcherEntry, run commandRunner) error {
+	program := tea.NewProgram(newLauncherModel(ctx, entries, run),
+		tea.WithContext(ctx),
+		tea.WithInput(in),
+		tea.WithOutput(out),
+		tea.WithAltScreen(),
+	)
+	final, err := program.Run()
+	if m, ok := final.(*launcherModel); ok && m.running != nil {
+		m.running.cancel()
+	}
+	return err
+}
+
+func (m *launcherModel) Init() tea.Cmd {
+	return textinput.Blink
+}
+
+func (m *launcherModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		m.output.Width = msg.Width
+		m.output.Height = max(msg.Height-4, 1)
+		return m, nil
+	case outputLineMsg:
+		m.appendOutput(string(msg))
+		return m, m.running.next
+	case commandDoneMsg:
+		m.finish(msg)
+		return m, nil
+	case tea.KeyMsg:
+		switch m.mode {
+		case modeForm:
+			return m.updateForm(msg)
+		case modeOutput:
+			return m.updateOutput(msg)
+		default:
+			return m.updateBrowse(msg)
+		}
+	}
+	return m, nil
+}
+
+func (m *launcherModel) updateBrowse(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "ctrl+c", "esc":
+		return m, tea.Quit
+	case "up", "ctrl+p":
+		if m.cursor > 0 {
+			m.cursor--
+		}
+		return m, nil
+	case "down", "ctrl+n":
+		if m.cursor < len(m.matches)-1 {
+			m.cursor++
+		}
+		return m, nil
+	case "enter":
+		if len(m.matches) == 0 {
+			return m, nil
+		}
+		entry := m.matches[m.cursor]
+		if entry.Recent {
+			return m, m.start(entry.Args)
+		}
+		m.openForm(entry)
+		return m, textinput.Blink
+	}
+
+	var cmd tea.Cmd
+	query := m.search.Value()
+	m.search, cmd = m.search.Update(msg)
+	if m.search.Value() != query {
+		m.filter()
+	}
+	return m, cmd
+}
+
+func (m *launcherModel) updateForm(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "ctrl+c":
+		return m, tea.Quit
+	case "esc":
+		m.mode = modeBrowse
+		m.search.Focus()
+		return m, nil
+	case "tab", "down":
+		m.focusField(m.focus + 1)
+		return m, nil
+	case "shift+tab", "up":
+		m.focusField(m.focus - 1)
+		return m, nil
+	case "enter":
+		values := make([]string, len(m.fields))
+		for i, field := range m.fields {
+			values[i] = field.Value()
+		}
+		args, err := buildLauncherArgs(m.selected, values)
+		if err != nil {
+			m.formErr = err.Error()
+			return m, nil
+		}
+		return m, m.start(args)
+	}
+
+	var cmd tea.Cmd
+	m.fields[m.focus], cmd = m.fields[m.focus].Update(msg)
+	return m, cmd
+}
+
+func (m *launcherModel) updateOutput(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "ctrl+c":
+		if m.running != nil {
+			m.running.cancel()
+			return m, nil
+		}
+		return m, tea.Quit
+	case "esc", "q":
+		if m.running == nil {
+			m.mode = modeBrowse
+			m.search.Focus()
+		}
+		return m, nil
+	}
+	var cmd tea.Cmd
+	m.output, cmd = m.output.Update(msg)
+	return m, cmd
+}
+
+// filter ranks the entries matching the search query.
+func (m *launcherModel) filter() {
+	query := m.search.Value()
+	type match struct {
+		entry launcherEntry
+		score int
+	}
+	var matches []match
+	for _, entry := range m.entries {
+		if score, ok := fuzzyScore(query, entry.title()+" "+entry.Description); ok {
+			matches = append(matches, match{entry, score})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].score > matches[j].score })
+
+	m.matches = m.matches[:0]
+	for _, match := range matches {
+		m.matches = append(m.matches, match.entry)
+	}
+	if m.cursor >= len(m.matches) {
+		m.cursor = max(len(m.matches)-1, 0)
+	}
+}
+
+func (m *launcherModel) openForm(entry launcherEntry) {
+	m.selected = entry
+	m.mode = modeForm
+	m.formErr = ""
+	m.fields = nil
+	m.labels = nil
+
+	positional := textinput.New()
+	positional.Prompt = ""
+	positional.Placeholder = "arguments"
+	m.fields = append(m.fields, positional)
+	m.labels = append(m.labels, "Arguments")
+	for _, flag := range entry.Flags {
+		field := textinput.New()
+		field.Prompt = ""
+		field.Placeholder = flag.Default
+		m.fields = append(m.fields, field)
+		m.labels = append(m.labels, "--"+flag.Name)
+	}
+	m.search.Blur()
+	m.focus = 0
+	m.fields[0].Focus()
+}
+
+func (m *launcherModel) focusField(i int) {
+	if i < 0 || i >= len(m.fields) {
+		return
+	}
+	m.fields[m.focus].Blur()
+	m.focus = i
+	m.fields[i].Focus()
+}
+
+func (m *launcherModel) start(args []string) tea.Cmd {
+	m.mode = modeOutput
+	m.args = args
+	m.lines = nil
+	m.status = "running"
+	m.output.SetContent("")
+	m.running = startCommand(m.ctx, m.run, args)
+	return m.running.next
+}
+
+func (m *launcherModel) appendOutput(line string) {
+	m.lines = append(m.lines, line)
+	if len(m.lines) > maxOutputLines {
+		m.lines = m.lines[len(m.lines)-maxOutputLines:]
+	}
+	atBottom := m.output.AtBottom()
+	m.output.SetContent(strings.Join(m.lines, "\n"))
+	if atBottom {
+		m.output.GotoBottom()
+	}
+}
+
+func (m *launcherModel) finish(done commandDoneMsg) {
+	m.running = nil
+	switch {
+	case errors.Is(done.err, context.Canceled):
+		m.status = "cancelled"
+	case done.err != nil:
+		m.status = "failed: " + done.err.Error()
+	default:
+		m.status = fmt.Sprintf("exited with %d", done.code)
+	}
+
+	// Offer the command line at the top of the list next time
+	title := strings.Join(m.args, " ")
+	entries := []launcherEntry{{Args: m.args, Description: "recently run", Recent: true}}
+	for _, entry := range m.entries {
+		if !(entry.Recent && entry.title() == title) {
+			entries = append(entries, entry)
+		}
+	}
+	m.entries = entries
+	m.filter()
+}
+
+func (m *launcherModel) View() string {
+	var b strings.Builder
+	switch m.mode {
+	case modeForm:
+		b.WriteString(titleStyle.Render("awesome-cli "+m.selected.title()) + "\n")
+		b.WriteString(faintStyle.Render(m.selected.Description) + "\n\n")
+		for i, field := range m.fields {
+			label := m.labels[i]
+			if i > 0 && m.selected.Flags[i-1].Usage != "" {
+				label += faintStyle.Render("  " + m.selected.Flags[i-1].Usage)
+			}
+			b.WriteString(label + "\n  " + field.View() + "\n")
+		}
+		if m.formErr != "" {
+			b.WriteString("\n" + errorStyle.Render(m.formErr) + "\n")
+		}
+		b.WriteString("\n" + faintStyle.Render("enter run • tab next field • esc back"))
+	case modeOutput:
+		b.WriteString(titleStyle.Render("$ awesome-cli "+strings.Join(m.args, " ")) + "  " + faintStyle.Render(m.status) + "\n")
+		b.WriteString(m.output.View() + "\n")
+		if m.running != nil {
+			b.WriteString(faintStyle.Render("ctrl+c stop • ↑/↓ scroll"))
+		} else {
+			b.WriteString(faintStyle.Render("esc back • ctrl+c quit • ↑/↓ scroll"))
+		}
+	default:
+		b.WriteString(m.search.View() + "\n\n")
+		visible := max(m.height-4, 1)
+		offset := 0
+		if m.cursor >= visible {
+			offset = m.cursor - visible + 1
+		}
+		for i := offset; i < len(m.matches) && i < offset+visible; i++ {
+			entry := m.matches[i]
+			title := entry.title()
+			if entry.Plugin {
+				title += " (plugin)"
+			}
+			if entry.Recent {
+				title = "↺ " + title
+			}
+			line := fmt.Sprintf("%-28s %s", title, faintStyle.Render(entry.Description))
+			if i == m.cursor {
+				line = selectedStyle.Render(fmt.Sprintf("%-28s", title)) + " " + entry.Description
+			}
+			b.WriteString(line + "\n")
+		}
+		if len(m.matches) == 0 {
+			b.WriteString(faintStyle.Render("no matching commands") + "\n")
+		}
+		b.WriteString("\n" + faintStyle.Render("enter select • ↑/↓ move • esc quit"))
+	}
+	return b.String()
+}
+
+// fuzzyScore reports whether the characters of query appear in text in order,
+// ignoring case, and scores the match. Consecutive characters and characters
+// at the start of words score higher, gaps lower.
+func fuzzyScore(query, text string) (int, bool) {
+	q := []rune(strings.ToLower(strings.TrimSpace(query)))
+	if len(q) == 0 {
+		return 0, true
+	}
+	t := []rune(strings.ToLower(text))
+	score, qi, last := 0, 0, -1
+	for ti := 0; ti < len(t) && qi < len(q); ti++ {
+		if t[ti] != q[qi] {
+			continue
+		}
+		switch {
+		case ti == last+1:
+			score += 5
+		case ti == 0 || !unicode.IsLetter(t[ti-1]) && !unicode.IsDigit(t[ti-1]):
+			score += 3
+		default:
+			score++
+		}
+		if last >= 0 {
+			score -= min(ti-last-1, 3)
+		}
+		last = ti
+		qi++
+	}
+	return score, qi == len(q)
+}
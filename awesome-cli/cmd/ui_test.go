@@ -0,0 +1,137 @@
+package cmd
+
+import (
+	"context"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFuzzyScore(t *testing.T) {
+	t.Parallel()
+	_, ok := fuzzyScore("slf", "self-update")
+	assert.True(t, ok)
+	_, ok = fuzzyScore("xyz", "self-update")
+	assert.False(t, ok)
+	_, ok = fuzzyScore("", "anything")
+	assert.True(t, ok)
+
+	prefix, _ := fuzzyScore("ver", "version")
+	scattered, _ := fuzzyScore("ver", "self-update Downloads a newer release")
+	assert.Greater(t, prefix, scattered)
+}
+
+func TestSplitArgs(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		input   string
+		want    []string
+		wantErr string
+	}{
+		{"", nil, ""},
+		{"  one two  ", []string{"one", "two"}, ""},
+		{`"hello world" 'it''s' a\ b`, []string{"hello world", "its", "a b"}, ""},
+		{`--name="" x`, []string{"--name=", "x"}, ""},
+		{`"open`, nil, "unterminated \" quote"},
+		{`trailing\`, nil, "trailing backslash"},
+	}
+	for _, test := range tests {
+		got, err := splitArgs(test.input)
+		if test.wantErr != "" {
+			assert.EqualError(t, err, test.wantErr, test.input)
+			continue
+		}
+		assert.NoError(t, err, test.input)
+		assert.Equal(t, test.want, got, test.input)
+	}
+}
+
+func TestBuildLauncherArgs(t *testing.T) {
+	t.Parallel()
+	entry := launcherEntry{
+		Args:  []string{"version"},
+		Flags: []launcherFlag{{Name: "output", Default: "text"}, {Name: "plugins", Default: "false"}},
+	}
+
+	args, err := buildLauncherArgs(entry, []string{"", "json", "false"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"version", "--output=json"}, args)
+
+	args, err = buildLauncherArgs(entry, []string{`a "b c"`, "", "true"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"version", "--plugins=true", "a", "b c"}, args)
+}
+
+func TestLauncherEntries(t *testing.T) {
+	t.Parallel()
+	app, _ := newTestApp()
+	afero.WriteFile(app.Fs, "/home/test/.foo/plugins/awesome-test", []byte{}, 0755)
+	root := app.NewRootCommand()
+
+	entries := launcherEntries(root, []historyEntry{{Args: []string{"list"}, ExitCode: 2}})
+
+	titles := make(map[string]launcherEntry)
+	for _, entry := range entries[1:] {
+		titles[entry.title()] = entry
+	}
+	assert.Equal(t, launcherEntry{Args: []string{"list"}, Description: "recently run, exited with 2", Recent: true}, entries[0])
+	assert.Contains(t, titles, "plugin new")
+	assert.Contains(t, titles, "self-update")
+	assert.NotContains(t, titles, "plugin")
+	assert.NotContains(t, titles, "ui")
+	assert.NotContains(t, titles, "help")
+	assert.True(t, titles["test"].Plugin)
+	assert.Contains(t, titles["version"].Flags, launcherFlag{Name: "output", Usage: "Output format: text, json, yaml or template", Default: "text"})
+}
+
+func TestUIWithoutTerminal(t *testing.T) {
+	t.Parallel()
+	app, stdout := newTestApp()
+	app.Run([]string{"version"})
+
+	code := app.Run([]string{"ui"})
+
+	assert.Equal(t, 0, code)
+	assert.Contains(t, stdout.String(), "The interactive launcher needs a terminal.")
+	assert.Contains(t, stdout.String(), "  self-update  ")
+	assert.Contains(t, stdout.String(), "Recent:\n  awesome-cli version\n")
+}
+
+func TestLauncherRunsCommand(t *testing.T) {
+	t.Parallel()
+	entries := []launcherEntry{
+		{Args: []string{"list"}, Description: "Lists all the available plugins"},
+		{Args: []string{"version"}, Description: "Print the version number of the CLI", Flags: []launcherFlag{{Name: "output", Default: "text"}}},
+	}
+	var ran []string
+	run := func(ctx context.Context, args []string, lines chan<- string) (int, error) {
+		ran = args
+		lines <- "first line"
+		lines <- "second line"
+		return 3, nil
+	}
+	m := newLauncherModel(context.Background(), entries, run)
+
+	m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("vrs")})
+	assert.Equal(t, []launcherEntry{entries[1]}, m.matches)
+
+	m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	assert.Equal(t, modeForm, m.mode)
+	m.Update(tea.KeyMsg{Type: tea.KeyTab})
+	m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("json")})
+	_, next := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	for next != nil {
+		_, next = m.Update(next())
+	}
+
+	assert.Equal(t, []string{"version", "--output=json"}, ran)
+	assert.Equal(t, []string{"first line", "second line"}, m.lines)
+	assert.Equal(t, "exited with 3", m.status)
+	assert.Contains(t, m.View(), "$ awesome-cli version --output=json")
+
+	m.Update(tea.KeyMsg{Type: tea.KeyEsc})
+	assert.Equal(t, modeBrowse, m.mode)
+	assert.Equal(t, launcherEntry{Args: []string{"version", "--output=json"}, Description: "recently run", Recent: true}, m.entries[0])
+}
@@ -1,22 +1,221 @@
 package cmd
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"fmt"
+	"io"
+	"os/exec"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
 	"github.com/spf13/cobra"
 )
 
-// Current version of the CLI tool
-var cliVersion = "v1.0.0"
+// Build information injected at build time, for example:
+//
+//	go build -ldflags "-X awesome-cli/cmd.version=v1.2.0 -X awesome-cli/cmd.commit=$(git rev-parse HEAD) -X awesome-cli/cmd.date=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Anything left empty is filled in from the binary's embedded build info.
+var (
+	version string
+	commit  string
+	date    string
+)
+
+// defaultVersion is reported when no version is injected or embedded.
+const defaultVersion = "v1.0.0"
+
+// pluginVersionTimeout bounds how long a plugin may take to report its version.
+const pluginVersionTimeout = 5 * time.Second
+
+// BuildInfo describes the running awesome-cli binary.
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	Date      string `json:"date"`
+	GoVersion string `json:"goVersion"`
+	Platform  string `json:"platform"`
+}
+
+// PluginVersion is the version a plugin reports for itself.
+type PluginVersion struct {
+	Name    string `json:"name"`
+	Path    string `json:"path"`
+	Version string `json:"version"`
+}
+
+// currentBuildInfo returns the build information of the running binary.
+func currentBuildInfo() BuildInfo {
+	info, _ := debug.ReadBuildInfo()
+	return resolveBuildInfo(info)
+}
+
+// resolveBuildInfo combines the injected build variables with info, which may
+// be nil when the binary was built without module support.
+func resolveBuildInfo(info *debug.BuildInfo) BuildInfo {
+	build := BuildInfo{
+		Version:   version,
+		Commit:    commit,
+		Date:      date,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+	if info != nil {
+		if build.Version == "" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+			build.Version = info.Main.Version
+		}
+		if info.GoVersion != "" {
+			build.GoVersion = info.GoVersion
+		}
+		modified := false
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if build.Commit == "" {
+					build.Commit = setting.Value
+				}
+			case "vcs.time":
+				if build.Date == "" {
+					build.Date = setting.Value
+				}
+			case "vcs.modified":
+				modified = setting.Value == "true"
+			}
+		}
+		if modified && commit == "" && build.Commit != "" {
+			build.Commit += "-dirty"
+		}
+	}
+
+	if build.Version == "" {
+		build.Version = defaultVersion
+	}
+	if build.Commit == "" {
+		build.Commit = "unknown"
+	}
+	if build.Date == "" {
+		build.Date = "unknown"
+	}
+	return build
+}
+
+// versionReport is the structured output of the version command.
+type versionReport struct {
+	schemaHeader
+	BuildInfo
+	Plugins []PluginVersion `json:"plugins,omitempty"`
+}
+
+func (a *App) newVersionCommand() *cobra.Command {
+	var withPlugins bool
+	versionCmd := &cobra.Command{
+		Use:          "version",
+		Short:        "Print the version number of the CLI",
+		Long:         `All software has versions. This is CLI's`,
+		SilenceUsage: true,
+		Annotations:  map[string]string{structuredOutputAnnotation: "true"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			build := currentBuildInfo()
+			var plugins []PluginVersion
+			if withPlugins {
+				plugins = a.pluginVersions()
+			}
+
+			report := versionReport{schemaHeader{Kind: "Version", SchemaVersion: 1}, build, plugins}
+			out := cmd.OutOrStdout()
+			if err := a.render(out, report, func() { displayVersion(out, build, plugins) }); err != nil {
+				return err
+			}
+			if config, err := a.config(); err == nil {
+				if warning := minimumVersionWarning(build.Version, config.MinVersion); warning != "" {
+					fmt.Fprintln(cmd.ErrOrStderr(), "Warning:", warning)
+				}
+			}
+			return nil
+		},
+	}
+	versionCmd.Flags().BoolVar(&withPlugins, "plugins", false, "Also list the version reported by each plugin")
+	return versionCmd
+}
+
+func displayVersion(w io.Writer, build BuildInfo, plugins []PluginVersion) {
+	fmt.Fprintf(w, "CLI Version %s\n", build.Version) // Ensure output goes to cmd.OutOrStdout()
+	fmt.Fprintf(w, "  Commit:     %s\n", build.Commit)
+	fmt.Fprintf(w, "  Built:      %s\n", build.Date)
+	fmt.Fprintf(w, "  Go version: %s\n", build.GoVersion)
+	fmt.Fprintf(w, "  Platform:   %s\n", build.Platform)
+	if len(plugins) > 0 {
+		fmt.Fprintln(w, "Plugins:")
+		for _, plugin := range plugins {
+			fmt.Fprintf(w, "  - %s %s\n", plugin.Name, plugin.Version)
+		}
+	}
+}
+
+// pluginVersions asks every discovered plugin for its version.
+func (a *App) pluginVersions() []PluginVersion {
+	plugins := a.Plugins.All()
+	versions := make([]PluginVersion, 0, len(plugins))
+	for _, plugin := range plugins {
+		versions = append(versions, PluginVersion{
+			Name:    plugin.Name,
+			Path:    plugin.Path,
+			Version: a.queryPluginVersion(plugin.Path),
+		})
+	}
+	return versions
+}
+
+// queryPluginVersion runs the plugin with --version. Plugins report their
+// version as the last word of the first line they print; anything that does
+// not look like a version is reported as unknown.
+func (a *App) queryPluginVersion(pluginPath string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), pluginVersionTimeout)
+	defer cancel()
 
-var versionCmd = &cobra.Command{
-	Use:   "version",
-	Short: "Print the version number of the CLI",
-	Long:  `All software has versions. This is CLI's`,
-	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Fprintf(cmd.OutOrStdout(), "CLI Version %s\n", cliVersion) // Ensure output goes to cmd.OutOrStdout()
-	},
+	name, args, err := a.pluginCommand(pluginPath, []string{"--version"})
+	if err != nil {
+		return "unknown"
+	}
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Env = a.pluginEnv(pluginPath)
+	output, err := cmd.Output()
+	if err != nil {
+		return "unknown"
+	}
+	line, _ := bufio.NewReader(bytes.NewReader(output)).ReadString('\n')
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return "unknown"
+	}
+	reported := fields[len(fields)-1]
+	if _, err := semver.NewVersion(reported); err != nil {
+		return "unknown"
+	}
+	return reported
 }
 
-func init() {
-	rootCmd.AddCommand(versionCmd)
+// minimumVersionWarning returns a warning when current is older than minimum,
+// or an empty string when it is not or either version cannot be parsed.
+func minimumVersionWarning(current, minimum string) string {
+	if minimum == "" {
+		return ""
+	}
+	currentVersion, err := semver.NewVersion(current)
+	if err != nil {
+		return ""
+	}
+	minimumVersion, err := semver.NewVersion(minimum)
+	if err != nil {
+		return ""
+	}
+	if currentVersion.LessThan(minimumVersion) {
+		return fmt.Sprintf("awesome-cli %s is older than the minimum version %s configured for your team, please upgrade", current, minimum)
+	}
+	return ""
 }
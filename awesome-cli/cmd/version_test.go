@@ -2,8 +2,14 @@ package cmd
 
 import (
 	"bytes"
+	"encoding/json"
+	"github.com/spf13/afero"
 	"github.com/spf13/cobra"
 	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
 	"testing"
 )
 
@@ -17,7 +23,113 @@ func executeCommand(root *cobra.Command, args ...string) (output string, err err
 }
 
 func TestVersionCommand(t *testing.T) {
-	output, err := executeCommand(rootCmd, "version")
+	app, _ := newTestApp()
+	output, err := executeCommand(app.NewRootCommand(), "version")
 	assert.NoError(t, err)
 	assert.Contains(t, output, "CLI")
 }
+
+func TestResolveBuildInfo(t *testing.T) {
+	tests := []struct {
+		name string
+		info *debug.BuildInfo
+		want BuildInfo
+	}{
+		{
+			name: "no build info",
+			want: BuildInfo{Version: defaultVersion, Commit: "unknown", Date: "unknown"},
+		},
+		{
+			name: "development build",
+			info: &debug.BuildInfo{
+				GoVersion: "go1.22.6",
+				Main:      debug.Module{Version: "(devel)"},
+				Settings: []debug.BuildSetting{
+					{Key: "vcs.revision", Value: "abc123"},
+					{Key: "vcs.time", Value: "2024-08-01T10:00:00Z"},
+					{Key: "vcs.modified", Value: "true"},
+				},
+			},
+			want: BuildInfo{Version: defaultVersion, Commit: "abc123-dirty", Date: "2024-08-01T10:00:00Z", GoVersion: "go1.22.6"},
+		},
+		{
+			name: "installed module",
+			info: &debug.BuildInfo{GoVersion: "go1.22.6", Main: debug.Module{Version: "v1.3.0"}},
+			want: BuildInfo{Version: "v1.3.0", Commit: "unknown", Date: "unknown", GoVersion: "go1.22.6"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := resolveBuildInfo(test.info)
+			if test.want.GoVersion == "" {
+				test.want.GoVersion = runtime.Version()
+			}
+			test.want.Platform = runtime.GOOS + "/" + runtime.GOARCH
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
+
+func TestMinimumVersionWarning(t *testing.T) {
+	tests := []struct {
+		current, minimum string
+		warn             bool
+	}{
+		{"v1.0.0", "", false},
+		{"v1.0.0", "v1.0.0", false},
+		{"v1.2.0", "1.1", false},
+		{"v1.0.0", "v1.1.0", true},
+		{"v1.0.0-rc.1", "v1.0.0", true},
+		{"unknown", "v1.1.0", false},
+	}
+	for _, test := range tests {
+		warning := minimumVersionWarning(test.current, test.minimum)
+		assert.Equal(t, test.warn, warning != "", "%s >= %s", test.current, test.minimum)
+	}
+}
+
+func TestVersionCommandJSON(t *testing.T) {
+	t.Parallel()
+	app, stdout := newTestApp()
+
+	code := app.Run([]string{"version", "--output", "json"})
+
+	assert.Equal(t, 0, code)
+	var build BuildInfo
+	assert.NoError(t, json.Unmarshal(stdout.Bytes(), &build))
+	assert.Equal(t, currentBuildInfo(), build)
+}
+
+func TestVersionCommandWarnsBelowMinimum(t *testing.T) {
+	t.Parallel()
+	app, _ := newTestApp()
+	stderr := new(bytes.Buffer)
+	app.Stderr = stderr
+	app.Config = &Config{MinVersion: "v99.0.0"}
+
+	code := app.Run([]string{"version"})
+
+	assert.Equal(t, 0, code)
+	assert.Contains(t, stderr.String(), "Warning: awesome-cli "+currentBuildInfo().Version+" is older than the minimum version v99.0.0")
+}
+
+func TestQueryPluginVersion(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	scripts := map[string]string{
+		"awesome-cobra":   `echo "awesome-cobra version 0.2.0"`,
+		"awesome-plain":   `echo 1.4.2`,
+		"awesome-chatty":  `echo "Running the checks"`,
+		"awesome-failing": `exit 2`,
+	}
+	for name, script := range scripts {
+		os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+script+"\n"), 0755)
+	}
+	app := &App{Fs: afero.NewOsFs(), Env: MapEnvironment{"PATH": "/usr/bin:/bin", "HOME": dir}}
+
+	assert.Equal(t, "0.2.0", app.queryPluginVersion(filepath.Join(dir, "awesome-cobra")))
+	assert.Equal(t, "1.4.2", app.queryPluginVersion(filepath.Join(dir, "awesome-plain")))
+	assert.Equal(t, "unknown", app.queryPluginVersion(filepath.Join(dir, "awesome-chatty")))
+	assert.Equal(t, "unknown", app.queryPluginVersion(filepath.Join(dir, "awesome-failing")))
+}
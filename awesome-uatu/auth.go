@@ -0,0 +1,493 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// tokenCookie is the cookie the dashboard sends its token in, as browsers
+// can't add an Authorization header to EventSource requests.
+const tokenCookie = "uatu-token"
+
+const (
+	// tokenReviewTTL is how long the result of a TokenReview is reused, so
+	// polling clients don't send a review per request.
+	tokenReviewTTL = time.Minute
+	// tokenReviewFailureTTL is how long a rejected token stays rejected,
+	// shorter so a token that was just created soon works.
+	tokenReviewFailureTTL = 5 * time.Second
+	// maxTokenReviews is how many reviews are cached at most, as any token
+	// sent is.
+	maxTokenReviews = 1000
+	// Each client may cause tokenReviewBurst reviews at once and then
+	// tokenReviewRate per second, so guessing tokens doesn't flood the API
+	// server. Clients are told apart by address, at most maxTokenReviewClients.
+	tokenReviewRate       = 1
+	tokenReviewBurst      = 10
+	maxTokenReviewClients = 1000
+)
+
+// errTooManyTokenReviews is returned when a client sent too many tokens to
+// review.
+var errTooManyTokenReviews = errors.New("too many token reviews")
+
+// identity is who made a request.
+type identity struct {
+	Name   string
+	Groups []string
+}
+
+// authenticator identifies the client of a request from one kind of
+// credentials.
+type authenticator interface {
+	// authenticate returns who made r, or nil if r carries none of the
+	// credentials it recognizes. Errors mean the credentials couldn't be
+	// checked, not that they are invalid.
+	authenticate(r *http.Request) (*identity, error)
+}
+
+// bearerToken returns the token of the Authorization header of r, or else
+// of the cookie set by handleLogin, if any.
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if ok && strings.EqualFold(scheme, "Bearer") && strings.TrimSpace(token) != "" {
+		return strings.TrimSpace(token), true
+	}
+	if cookie, err := r.Cookie(tokenCookie); err == nil {
+		// Encoded as tokens may contain bytes cookies can't
+		if token, err := base64.RawURLEncoding.DecodeString(cookie.Value); err == nil && len(token) > 0 {
+			return string(token), true
+		}
+	}
+	return "", false
+}
+
+// tokenFileAuthenticator accepts static bearer tokens read from a CSV file
+// in the format of the API server's --token-auth-file: token, user name,
+// uid and optionally a quoted, comma separated list of groups.
+type tokenFileAuthenticator struct {
+	// tokens are the identities by SHA-256 of their token.
+	tokens map[[sha256.Size]byte]*identity
+}
+
+func loadTokenFile(name string) (*tokenFileAuthenticator, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.Comment = '#'
+	a := &tokenFileAuthenticator{tokens: map[[sha256.Size]byte]*identity{}}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid token file %s: %w", name, err)
+		}
+		line, _ := reader.FieldPos(0)
+		if len(record) < 3 || record[0] == "" || record[1] == "" {
+			return nil, fmt.Errorf("invalid token file %s: line %d needs a token, user name and uid", name, line)
+		}
+		id := &identity{Name: record[1]}
+		if len(record) > 3 && record[3] != "" {
+			for _, group := range strings.Split(record[3], ",") {
+				id.Groups = append(id.Groups, strings.TrimSpace(group))
+			}
+		}
+		sum := sha256.Sum256([]byte(record[0]))
+		if _, ok := a.tokens[sum]; ok {
+			return nil, fmt.Errorf("invalid token file %s: line %d repeats a token", name, line)
+		}
+		a.tokens[sum] = id
+	}
+	if len(a.tokens) == 0 {
+		return nil, fmt.Errorf("token file %s has no tokens", name)
+	}
+	return a, nil
+}
+
+func (a *tokenFileAuthenticator) authenticate(r *http.Request) (*identity, error) {
+	token, ok := bearerToken(r)
+	if !ok {
+		return nil, nil
+	}
+	// Comparing hashes in constant time doesn't reveal how much of a token
+	// matched
+	sum := sha256.Sum256([]byte(token))
+	var found *identity
+	for known, id := range a.tokens {
+		if subtle.ConstantTimeCompare(known[:], sum[:]) == 1 {
+			found = id
+		}
+	}
+	return found, nil
+}
+
+// certAuthenticator accepts client certificates verified against the
+// client CA of the TLS listener. As for the API server, the common name is
+// the user name and the organizations are the groups.
+type certAuthenticator struct{}
+
+func (certAuthenticator) authenticate(r *http.Request) (*identity, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil, nil
+	}
+	subject := r.TLS.VerifiedChains[0][0].Subject
+	if subject.CommonName == "" {
+		return nil, nil
+	}
+	return &identity{Name: subject.CommonName, Groups: subject.Organization}, nil
+}
+
+// tokenReviewAuthenticator accepts bearer tokens the API server of a
+// cluster vouches for, such as service account tokens.
+type tokenReviewAuthenticator struct {
+	cluster *cluster
+
+	mu      sync.Mutex
+	reviews map[[sha256.Size]byte]tokenReview
+	// clients limit the reviews by client address.
+	clients map[string]*rate.Limiter
+	now     func() time.Time
+}
+
+type tokenReview struct {
+	identity *identity
+	expires  time.Time
+}
+
+func newTokenReviewAuthenticator(c *cluster) *tokenReviewAuthenticator {
+	return &tokenReviewAuthenticator{
+		cluster: c,
+		reviews: map[[sha256.Size]byte]tokenReview{},
+		clients: map[string]*rate.Limiter{},
+		now:     time.Now,
+	}
+}
+
+func (a *tokenReviewAuthenticator) authenticate(r *http.Request) (*identity, error) {
+	token, ok := bearerToken(r)
+	if !ok {
+		return nil, nil
+	}
+	sum := sha256.Sum256([]byte(token))
+	now := a.now()
+	a.mu.Lock()
+	review, ok := a.reviews[sum]
+	cached := ok && now.Before(review.expires)
+	// Only reviews count against the limit, not cached results
+	allowed := cached || a.limiter(r, now).AllowN(now, 1)
+	a.mu.Unlock()
+	if cached {
+		return review.identity, nil
+	}
+	if !allowed {
+		return nil, errTooManyTokenReviews
+	}
+
+	result, err := a.cluster.clientset.AuthenticationV1().TokenReviews().Create(r.Context(), &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{Token: token},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		a.cluster.apiErrors.WithLabelValues("tokenreviews").Inc()
+		return nil, fmt.Errorf("failed to review token with cluster %s: %w", a.cluster.name, err)
+	}
+	review = tokenReview{expires: now.Add(tokenReviewFailureTTL)}
+	if status := result.Status; status.Authenticated {
+		review = tokenReview{
+			identity: &identity{Name: status.User.Username, Groups: status.User.Groups},
+			expires:  now.Add(tokenReviewTTL),
+		}
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.reviews) >= maxTokenReviews {
+		// Forget expired reviews first, then any
+		for key, cached := range a.reviews {
+			if !now.Before(cached.expires) {
+				delete(a.reviews, key)
+			}
+		}
+		for key := range a.reviews {
+			if len(a.reviews) < maxTokenReviews {
+				break
+			}
+			delete(a.reviews, key)
+		}
+	}
+	a.reviews[sum] = review
+	return review.identity, nil
+}
+
+// limiter returns the rate limiter of the client of r. a.mu must be held.
+func (a *tokenReviewAuthenticator) limiter(r *http.Request, now time.Time) *rate.Limiter {
+	client, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		client = r.RemoteAddr
+	}
+	if limiter, ok := a.clients[client]; ok {
+		return limiter
+	}
+	if len(a.clients) >= maxTokenReviewClients {
+		// Limiters that refilled are as good as new ones, then forget any
+		for key, limiter := range a.clients {
+			if limiter.TokensAt(now) >= tokenReviewBurst {
+				delete(a.clients, key)
+			}
+		}
+		for key := range a.clients {
+			if len(a.clients) < maxTokenReviewClients {
+				break
+			}
+			delete(a.clients, key)
+		}
+	}
+	limiter := rate.NewLimiter(tokenReviewRate, tokenReviewBurst)
+	a.clients[client] = limiter
+	return limiter
+}
+
+// authorizationRule grants the users and members of groups it lists access
+// to namespaces. Names and namespaces may be shell patterns such as team-*,
+// * matching any user or namespace.
+type authorizationRule struct {
+	Users      []string `json:"users,omitempty"`
+	Groups     []string `json:"groups,omitempty"`
+	Namespaces []string `json:"namespaces"`
+}
+
+type authorizationRules struct {
+	Rules []authorizationRule `json:"rules"`
+}
+
+// loadAuthorizationRules reads the rules in the YAML or JSON file at name.
+func loadAuthorizationRules(name string) (*authorizationRules, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var rules authorizationRules
+	if err := yaml.UnmarshalStrict(data, &rules); err != nil {
+		return nil, fmt.Errorf("invalid authorization rules %s: %w", name, err)
+	}
+	for i, rule := range rules.Rules {
+		if len(rule.Users) == 0 && len(rule.Groups) == 0 {
+			return nil, fmt.Errorf("invalid authorization rules %s: rule %d applies to no users or groups", name, i+1)
+		}
+		for _, pattern := range slices.Concat(rule.Users, rule.Groups, rule.Namespaces) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("invalid authorization rules %s: rule %d: invalid pattern %q", name, i+1, pattern)
+			}
+		}
+	}
+	return &rules, nil
+}
+
+// access returns the namespaces id may see.
+func (rules *authorizationRules) access(id *identity) *access {
+	a := &access{}
+	for _, rule := range rules.Rules {
+		if matchesAny(rule.Users, id.Name) || slices.ContainsFunc(id.Groups, func(group string) bool { return matchesAny(rule.Groups, group) }) {
+			a.namespaces = append(a.namespaces, rule.Namespaces...)
+		}
+	}
+	return a
+}
+
+func matchesAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// access is the namespaces a client may see. A nil access allows every
+// namespace.
+type access struct {
+	// namespaces are patterns of the namespaces allowed.
+	namespaces []string
+}
+
+func (a *access) allows(namespace string) bool {
+	return a == nil || matchesAny(a.namespaces, namespace)
+}
+
+// all reports whether every namespace is allowed.
+func (a *access) all() bool {
+	return a == nil || slices.Contains(a.namespaces, "*")
+}
+
+// none reports whether no namespace is allowed.
+func (a *access) none() bool {
+	return a != nil && len(a.namespaces) == 0
+}
+
+type contextKey int
+
+const accessKey contextKey = iota
+
+// authenticate returns who made r according to the first authenticator
+// that recognizes its credentials, or nil if none does. An authenticator
+// that fails doesn't stop the later ones, e.g. one cluster being unreachable
+// doesn't reject tokens another cluster accepts; its error is only returned
+// when no authenticator recognizes the credentials.
+func (s *server) authenticate(r *http.Request) (*identity, error) {
+	var firstErr error
+	for _, a := range s.authenticators {
+		id, err := a.authenticate(r)
+		if id != nil {
+			return id, nil
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return nil, firstErr
+}
+
+// authenticated only passes requests on to h if the client is
+// authenticated, with the namespaces it may see in the request context.
+// Every request is passed on when no authenticators are configured.
+func (s *server) authenticated(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if len(s.authenticators) == 0 {
+			h(w, r)
+			return
+		}
+		id, err := s.authenticate(r)
+		if err != nil {
+			authenticationFailed(w, err)
+			return
+		}
+		if id == nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="awesome-uatu"`)
+			if _, ok := bearerToken(r); ok {
+				http.Error(w, "Invalid bearer token", http.StatusUnauthorized)
+			} else {
+				http.Error(w, "Authentication required, send a bearer token or client certificate", http.StatusUnauthorized)
+			}
+			return
+		}
+		var allowed *access
+		if s.authorization != nil {
+			allowed = s.authorization.access(id)
+		}
+		h(w, r.WithContext(context.WithValue(r.Context(), accessKey, allowed)))
+	}
+}
+
+// authenticationFailed responds to a request whose credentials couldn't be
+// checked because of err.
+func authenticationFailed(w http.ResponseWriter, err error) {
+	if errors.Is(err, errTooManyTokenReviews) {
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "Too many tokens to review, try again later", http.StatusTooManyRequests)
+		return
+	}
+	log.Printf("Failed to authenticate request: %v", err)
+	http.Error(w, "Failed to authenticate request", http.StatusServiceUnavailable)
+}
+
+// handleLogin checks the token posted by the dashboard's sign in form and
+// keeps it in a cookie, which EventSource sends unlike an Authorization
+// header. The cookie is HttpOnly so scripts can't read the token back, and
+// SameSite so other sites can't send it.
+func (s *server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	if origin := r.Header.Get("Origin"); origin != "" {
+		if u, err := url.Parse(origin); err != nil || u.Host != r.Host {
+			http.Error(w, "Forbidden, cross-origin sign in", http.StatusForbidden)
+			return
+		}
+	}
+	token := strings.TrimSpace(r.PostFormValue("token"))
+	if token == "" {
+		http.Error(w, "Missing token", http.StatusBadRequest)
+		return
+	}
+	// Only the token is checked, not a client certificate sent along
+	probe := r.Clone(r.Context())
+	probe.TLS = nil
+	probe.Header.Set("Authorization", "Bearer "+token)
+	id, err := s.authenticate(probe)
+	if err != nil {
+		authenticationFailed(w, err)
+		return
+	}
+	if id == nil {
+		http.Error(w, "Invalid bearer token", http.StatusUnauthorized)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     tokenCookie,
+		Value:    base64.RawURLEncoding.EncodeToString([]byte(token)),
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// requestAccess returns the namespaces the client of r may see.
+func requestAccess(r *http.Request) *access {
+	allowed, _ := r.Context().Value(accessKey).(*access)
+	return allowed
+}
+
+// authorizeNamespaces checks that the client of r may see namespaces, or
+// any namespace when namespaces is empty, and returns what it may see. It
+// writes a Forbidden response and returns false otherwise.
+func authorizeNamespaces(w http.ResponseWriter, r *http.Request, namespaces ...string) (*access, bool) {
+	allowed := requestAccess(r)
+	if allowed.none() {
+		http.Error(w, "Forbidden, no namespaces are allowed", http.StatusForbidden)
+		return nil, false
+	}
+	for _, namespace := range namespaces {
+		if !allowed.allows(namespace) {
+			http.Error(w, fmt.Sprintf("Forbidden, namespace %s is not allowed", namespace), http.StatusForbidden)
+			return nil, false
+		}
+	}
+	return allowed, true
+}
+
+// requireAllNamespaces only passes requests on to h if the client may see
+// every namespace, for endpoints that report on all of them.
+func requireAllNamespaces(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !requestAccess(r).all() {
+			http.Error(w, "Forbidden, access to all namespaces is required", http.StatusForbidden)
+			return
+		}
+		h(w, r)
+	}
+}
@@ -0,0 +1,422 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// getWithToken is get sending token as a bearer token, unless it is empty.
+func getWithToken(t *testing.T, handler http.Handler, target, token string) *httptest.ResponseRecorder {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, target, nil)
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestLoadTokenFile(t *testing.T) {
+	tokens, err := loadTokenFile(writeFile(t, "tokens.csv", `# comment
+admin-token,alice,1,"admins,developers"
+dev-token, bob, 2
+`))
+	if err != nil {
+		t.Fatalf("loadTokenFile: %v", err)
+	}
+	for _, tt := range []struct {
+		token string
+		want  *identity
+	}{
+		{"admin-token", &identity{Name: "alice", Groups: []string{"admins", "developers"}}},
+		{"dev-token", &identity{Name: "bob"}},
+		{"guess", nil},
+		{"", nil},
+	} {
+		request := httptest.NewRequest(http.MethodGet, "/status", nil)
+		if tt.token != "" {
+			request.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		id, err := tokens.authenticate(request)
+		if err != nil || !reflect.DeepEqual(id, tt.want) {
+			t.Errorf("authenticate with %q = %+v, %v, want %+v", tt.token, id, err, tt.want)
+		}
+	}
+
+	for name, content := range map[string]string{
+		"empty.csv":      "# no tokens\n",
+		"short.csv":      "token,alice\n",
+		"repeated.csv":   "token,alice,1\ntoken,bob,2\n",
+		"no-token.csv":   ",alice,1\n",
+		"unquoted.csv":   "token,alice,1,\"admins\n",
+		"no-user.csv":    "token,,1\n",
+		"whitespace.csv": "   \n",
+	} {
+		if _, err := loadTokenFile(writeFile(t, name, content)); err == nil {
+			t.Errorf("loadTokenFile(%s) succeeded, want an error", name)
+		}
+	}
+}
+
+func TestCertAuthenticator(t *testing.T) {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "alice", Organization: []string{"admins"}}}
+	for _, tt := range []struct {
+		name  string
+		state *tls.ConnectionState
+		want  *identity
+	}{
+		{"plain HTTP", nil, nil},
+		{"no client certificate", &tls.ConnectionState{}, nil},
+		{"verified certificate", &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}, &identity{Name: "alice", Groups: []string{"admins"}}},
+		// Certificates the server didn't verify are not in VerifiedChains
+		{"unverified certificate", &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}, nil},
+	} {
+		request := httptest.NewRequest(http.MethodGet, "/status", nil)
+		request.TLS = tt.state
+		if id, err := (certAuthenticator{}).authenticate(request); err != nil || !reflect.DeepEqual(id, tt.want) {
+			t.Errorf("%s: authenticate = %+v, %v, want %+v", tt.name, id, err, tt.want)
+		}
+	}
+}
+
+func TestTokenReviewAuthenticator(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	reviews := 0
+	clientset.PrependReactor("create", "tokenreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		reviews++
+		review := action.(k8stesting.CreateAction).GetObject().(*authenticationv1.TokenReview)
+		switch review.Spec.Token {
+		case "service-account-token":
+			review.Status = authenticationv1.TokenReviewStatus{
+				Authenticated: true,
+				User:          authenticationv1.UserInfo{Username: "system:serviceaccount:web:viewer", Groups: []string{"system:serviceaccounts"}},
+			}
+		case "unreachable":
+			return true, nil, errors.New("connection refused")
+		}
+		return true, review, nil
+	})
+	srv := newTestServer(clientset)
+	now := testNow
+	reviewer := newTokenReviewAuthenticator(srv.clusters[0])
+	reviewer.now = func() time.Time { return now }
+
+	authenticateFrom := func(client, token string) (*identity, error) {
+		request := httptest.NewRequest(http.MethodGet, "/status", nil)
+		request.RemoteAddr = client + ":1234"
+		request.Header.Set("Authorization", "Bearer "+token)
+		return reviewer.authenticate(request)
+	}
+	authenticate := func(token string) (*identity, error) {
+		return authenticateFrom("192.0.2.1", token)
+	}
+	want := &identity{Name: "system:serviceaccount:web:viewer", Groups: []string{"system:serviceaccounts"}}
+	for range 2 {
+		if id, err := authenticate("service-account-token"); err != nil || !reflect.DeepEqual(id, want) {
+			t.Errorf("authenticate = %+v, %v, want %+v", id, err, want)
+		}
+	}
+	if reviews != 1 {
+		t.Errorf("%d reviews for repeated requests, want the first review to be reused", reviews)
+	}
+	now = now.Add(tokenReviewTTL)
+	authenticate("service-account-token")
+	if reviews != 2 {
+		t.Errorf("%d reviews after the first one expired, want 2", reviews)
+	}
+
+	if id, err := authenticate("forged"); id != nil || err != nil {
+		t.Errorf("authenticate with a rejected token = %+v, %v, want no identity", id, err)
+	}
+	authenticate("forged")
+	now = now.Add(tokenReviewFailureTTL)
+	authenticate("forged")
+	if reviews != 4 {
+		t.Errorf("%d reviews after a rejection expired, want 4", reviews)
+	}
+	if _, err := authenticate("unreachable"); err == nil {
+		t.Error("authenticate succeeded though the API server could not be reached")
+	}
+	if !scrape(t, srv)[`uatu_kubernetes_api_errors_total{cluster="test",resource="tokenreviews"} 1`] {
+		t.Error("failed token reviews are not counted")
+	}
+
+	guesses := 0
+	for ; guesses <= tokenReviewBurst; guesses++ {
+		if _, err := authenticateFrom("198.51.100.1", fmt.Sprint("guess-", guesses)); err != nil {
+			break
+		}
+	}
+	if _, err := authenticateFrom("198.51.100.1", "guess"); guesses != tokenReviewBurst || !errors.Is(err, errTooManyTokenReviews) {
+		t.Errorf("client guessed %d tokens then got %v, want %d guesses then %v", guesses, err, tokenReviewBurst, errTooManyTokenReviews)
+	}
+	if id, err := authenticateFrom("198.51.100.1", "service-account-token"); err != nil || id == nil {
+		t.Errorf("authenticate with a cached token after guessing = %+v, %v, want it accepted", id, err)
+	}
+	if _, err := authenticateFrom("198.51.100.2", "guess"); err != nil {
+		t.Errorf("authenticate from another client = %v, want it reviewed", err)
+	}
+	now = now.Add(time.Second / tokenReviewRate)
+	if _, err := authenticateFrom("198.51.100.1", "guess"); err != nil {
+		t.Errorf("authenticate after waiting = %v, want it reviewed", err)
+	}
+
+	for i := range maxTokenReviews + 10 {
+		authenticateFrom(fmt.Sprint("10.0.", i/256, ".", i%256), fmt.Sprint("token-", i))
+	}
+	if len(reviewer.reviews) > maxTokenReviews || len(reviewer.clients) > maxTokenReviewClients {
+		t.Errorf("%d reviews and %d clients cached, want at most %d and %d", len(reviewer.reviews), len(reviewer.clients), maxTokenReviews, maxTokenReviewClients)
+	}
+}
+
+func TestLoadAuthorizationRules(t *testing.T) {
+	rules, err := loadAuthorizationRules(writeFile(t, "rules.yaml", `rules:
+- groups: [admins]
+  namespaces: ["*"]
+- users: [bob]
+  groups: ["team-web"]
+  namespaces: [web, "web-*"]
+- users: ["system:serviceaccount:monitoring:*"]
+  namespaces: [monitoring]
+`))
+	if err != nil {
+		t.Fatalf("loadAuthorizationRules: %v", err)
+	}
+	for _, tt := range []struct {
+		id        identity
+		allowed   []string
+		forbidden []string
+		all       bool
+	}{
+		{identity{Name: "alice", Groups: []string{"admins"}}, []string{"web", "kube-system"}, nil, true},
+		{identity{Name: "bob"}, []string{"web", "web-staging"}, []string{"webshop", "kube-system"}, false},
+		{identity{Name: "carol", Groups: []string{"team-web"}}, []string{"web"}, []string{"monitoring"}, false},
+		{identity{Name: "system:serviceaccount:monitoring:prometheus"}, []string{"monitoring"}, []string{"web"}, false},
+		{identity{Name: "mallory"}, nil, []string{"web", "default"}, false},
+	} {
+		access := rules.access(&tt.id)
+		for _, namespace := range tt.allowed {
+			if !access.allows(namespace) {
+				t.Errorf("%s may not see namespace %s, want allowed", tt.id.Name, namespace)
+			}
+		}
+		for _, namespace := range tt.forbidden {
+			if access.allows(namespace) {
+				t.Errorf("%s may see namespace %s, want forbidden", tt.id.Name, namespace)
+			}
+		}
+		if access.all() != tt.all {
+			t.Errorf("%s may see all namespaces = %v, want %v", tt.id.Name, access.all(), tt.all)
+		}
+	}
+
+	for name, content := range map[string]string{
+		"nobody.yaml":  "rules:\n- namespaces: [web]\n",
+		"pattern.yaml": "rules:\n- users: [bob]\n  namespaces: [\"web-[\"]\n",
+		"unknown.yaml": "rules:\n- user: bob\n  namespaces: [web]\n",
+	} {
+		if _, err := loadAuthorizationRules(writeFile(t, name, content)); err == nil {
+			t.Errorf("loadAuthorizationRules(%s) succeeded, want an error", name)
+		}
+	}
+}
+
+func TestAuthorization(t *testing.T) {
+	tokens, err := loadTokenFile(writeFile(t, "tokens.csv", `admin-token,alice,1,admins
+web-token,bob,2
+nobody-token,mallory,3
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules, err := loadAuthorizationRules(writeFile(t, "rules.yaml", `rules:
+- groups: [admins]
+  namespaces: ["*"]
+- users: [bob]
+  namespaces: [web]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := newTestServer(fake.NewSimpleClientset(
+		testPod("web", "frontend", corev1.PodRunning, nil),
+		testPod("db", "postgres", corev1.PodRunning, nil),
+		testDeployment("frontend", 1, appsv1.DeploymentStatus{}),
+	))
+	srv.authenticators = []authenticator{tokens}
+	srv.authorization = rules
+	routes := startServer(t, srv).routes()
+
+	for _, tt := range []struct {
+		target string
+		token  string
+		code   int
+	}{
+		{"/status", "", http.StatusUnauthorized},
+		{"/status", "guess", http.StatusUnauthorized},
+		{"/status/stream", "", http.StatusUnauthorized},
+		{"/pods/web/frontend/logs", "", http.StatusUnauthorized},
+		{"/clusters", "", http.StatusUnauthorized},
+		{"/metrics", "", http.StatusUnauthorized},
+		{"/healthz", "", http.StatusOK},
+		{"/readyz", "", http.StatusOK},
+		{"/dashboard/", "", http.StatusOK},
+		{"/status", "admin-token", http.StatusOK},
+		{"/status?namespace=db", "admin-token", http.StatusOK},
+		{"/metrics", "admin-token", http.StatusOK},
+		{"/status", "web-token", http.StatusOK},
+		{"/status?namespace=web", "web-token", http.StatusOK},
+		{"/status?namespace=web&namespace=db", "web-token", http.StatusForbidden},
+		{"/status/stream?namespace=db", "web-token", http.StatusForbidden},
+		{"/workloads?namespace=db", "web-token", http.StatusForbidden},
+		{"/workloads/deployment/web/frontend", "web-token", http.StatusOK},
+		{"/workloads/deployment/db/frontend", "web-token", http.StatusForbidden},
+		{"/pods/web/frontend/events", "web-token", http.StatusOK},
+		{"/pods/db/postgres/events", "web-token", http.StatusForbidden},
+		{"/pods/db/postgres/logs", "web-token", http.StatusForbidden},
+		{"/clusters", "web-token", http.StatusOK},
+		{"/metrics", "web-token", http.StatusForbidden},
+		{"/status", "nobody-token", http.StatusForbidden},
+		{"/workloads", "nobody-token", http.StatusForbidden},
+	} {
+		recorder := getWithToken(t, routes, tt.target, tt.token)
+		if recorder.Code != tt.code {
+			t.Errorf("GET %s with token %q = %d %s, want %d", tt.target, tt.token, recorder.Code, recorder.Body, tt.code)
+		}
+		if tt.code == http.StatusUnauthorized && !strings.HasPrefix(recorder.Header().Get("WWW-Authenticate"), "Bearer ") {
+			t.Errorf("GET %s without valid credentials has no Bearer challenge", tt.target)
+		}
+	}
+
+	for _, tt := range []struct {
+		token string
+		want  []string
+	}{
+		{"admin-token", []string{"postgres", "frontend"}},
+		{"web-token", []string{"frontend"}},
+	} {
+		var statuses []PodStatus
+		if err := json.Unmarshal(getWithToken(t, routes, "/status", tt.token).Body.Bytes(), &statuses); err != nil {
+			t.Fatal(err)
+		}
+		names := []string{}
+		for _, status := range statuses {
+			names = append(names, status.Name)
+		}
+		if !reflect.DeepEqual(names, tt.want) {
+			t.Errorf("GET /status with token %q = %v, want %v", tt.token, names, tt.want)
+		}
+	}
+}
+
+func TestAuthenticationFailure(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("create", "tokenreviews", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("connection refused")
+	})
+	srv := startTestServer(t, clientset)
+	srv.authenticators = []authenticator{newTokenReviewAuthenticator(srv.clusters[0])}
+	if code := getWithToken(t, srv.routes(), "/status", "token").Code; code != http.StatusServiceUnavailable {
+		t.Errorf("GET /status when tokens can't be reviewed = %d, want %d", code, http.StatusServiceUnavailable)
+	}
+
+	srv.authenticators = []authenticator{failingAuthenticator{errTooManyTokenReviews}}
+	if recorder := getWithToken(t, srv.routes(), "/status", "token"); recorder.Code != http.StatusTooManyRequests || recorder.Header().Get("Retry-After") == "" {
+		t.Errorf("GET /status when too many tokens were reviewed = %d, want %d with Retry-After", recorder.Code, http.StatusTooManyRequests)
+	}
+
+	tokens, err := loadTokenFile(writeFile(t, "tokens.csv", "admin-token,alice,1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.authenticators = []authenticator{failingAuthenticator{errors.New("connection refused")}, tokens}
+	if code := getWithToken(t, srv.routes(), "/status", "admin-token").Code; code != http.StatusOK {
+		t.Errorf("GET /status with a token a later authenticator accepts = %d, want %d", code, http.StatusOK)
+	}
+	if code := getWithToken(t, srv.routes(), "/status", "forged").Code; code != http.StatusServiceUnavailable {
+		t.Errorf("GET /status with a token no authenticator accepts = %d, want %d", code, http.StatusServiceUnavailable)
+	}
+}
+
+type failingAuthenticator struct{ err error }
+
+func (a failingAuthenticator) authenticate(*http.Request) (*identity, error) {
+	return nil, a.err
+}
+
+func TestLogin(t *testing.T) {
+	tokens, err := loadTokenFile(writeFile(t, "tokens.csv", "admin-token,alice,1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := newTestServer(fake.NewSimpleClientset(testPod("web", "frontend", corev1.PodRunning, nil)))
+	srv.authenticators = []authenticator{tokens}
+	routes := startServer(t, srv).routes()
+	login := func(token, origin string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(url.Values{"token": {token}}.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if origin != "" {
+			request.Header.Set("Origin", origin)
+		}
+		routes.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	for _, tt := range []struct {
+		token, origin string
+		code          int
+	}{
+		{"", "", http.StatusBadRequest},
+		{"guess", "http://example.com", http.StatusUnauthorized},
+		{"admin-token", "https://attacker.example", http.StatusForbidden},
+	} {
+		if recorder := login(tt.token, tt.origin); recorder.Code != tt.code || len(recorder.Result().Cookies()) != 0 {
+			t.Errorf("POST /login with %q from %q = %d %v, want %d without a cookie", tt.token, tt.origin, recorder.Code, recorder.Result().Cookies(), tt.code)
+		}
+	}
+
+	recorder := login("admin-token", "http://example.com")
+	cookies := recorder.Result().Cookies()
+	if recorder.Code != http.StatusNoContent || len(cookies) != 1 {
+		t.Fatalf("POST /login = %d %v, want a cookie", recorder.Code, cookies)
+	}
+	if cookie := cookies[0]; cookie.Name != tokenCookie || !cookie.HttpOnly || cookie.SameSite != http.SameSiteStrictMode || cookie.Path != "/" || strings.Contains(cookie.Value, "admin-token") {
+		t.Errorf("cookie = %+v, want an encoded HttpOnly, SameSite cookie for every path", cookie)
+	}
+	for _, tt := range []struct {
+		cookie *http.Cookie
+		code   int
+	}{
+		{cookies[0], http.StatusOK},
+		{&http.Cookie{Name: tokenCookie, Value: base64.RawURLEncoding.EncodeToString([]byte("guess"))}, http.StatusUnauthorized},
+	} {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodGet, "/status", nil)
+		request.AddCookie(tt.cookie)
+		routes.ServeHTTP(recorder, request)
+		if recorder.Code != tt.code {
+			t.Errorf("GET /status with cookie %s = %d, want %d", tt.cookie.Value, recorder.Code, tt.code)
+		}
+	}
+}
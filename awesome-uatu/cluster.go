@@ -0,0 +1,367 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	appslisters "k8s.io/client-go/listers/apps/v1"
+	batchlisters "k8s.io/client-go/listers/batch/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/yaml"
+)
+
+// inClusterName is the name of the cluster awesome-uatu runs in, when it
+// isn't given one.
+const inClusterName = "in-cluster"
+
+// clusterConfig says how to reach a cluster, as listed in the -clusters
+// file.
+type clusterConfig struct {
+	// Name identifies the cluster in responses and the cluster query
+	// parameter, the context name by default.
+	Name string `json:"name"`
+	// Context is the kubeconfig context to use, the current context when
+	// empty.
+	Context string `json:"context,omitempty"`
+	// Kubeconfig is the kubeconfig file, the one kubectl uses when empty.
+	Kubeconfig string `json:"kubeconfig,omitempty"`
+	// InCluster uses the service account awesome-uatu runs as instead of a
+	// kubeconfig.
+	InCluster bool `json:"inCluster,omitempty"`
+}
+
+type clustersFile struct {
+	Clusters []clusterConfig `json:"clusters"`
+}
+
+// loadClusters reads the clusters listed in the YAML or JSON file at path.
+func loadClusters(path string) ([]clusterConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file clustersFile
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid clusters file %s: %w", path, err)
+	}
+	if len(file.Clusters) == 0 {
+		return nil, fmt.Errorf("clusters file %s lists no clusters", path)
+	}
+	names := map[string]bool{}
+	for i := range file.Clusters {
+		config := &file.Clusters[i]
+		if config.InCluster && (config.Context != "" || config.Kubeconfig != "") {
+			return nil, fmt.Errorf("cluster %d in %s sets inCluster together with a kubeconfig context", i+1, path)
+		}
+		if config.Name == "" {
+			config.Name = config.Context
+			if config.InCluster {
+				config.Name = inClusterName
+			}
+		}
+		if config.Name == "" {
+			return nil, fmt.Errorf("cluster %d in %s needs a name or context", i+1, path)
+		}
+		if names[config.Name] {
+			return nil, fmt.Errorf("cluster %q is listed twice in %s", config.Name, path)
+		}
+		names[config.Name] = true
+	}
+	return file.Clusters, nil
+}
+
+// kubeconfigClusters returns a cluster for each of contexts in kubeconfig,
+// every context when allContexts is set, or else the current context.
+// kubeconfig defaults to the files kubectl uses. When none of them exist
+// and no contexts are asked for, awesome-uatu is assumed to run in the
+// cluster it watches.
+func kubeconfigClusters(kubeconfig string, contexts []string, allContexts bool) ([]clusterConfig, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = kubeconfig
+	if kubeconfig == "" && len(contexts) == 0 && !allContexts && !anyFileExists(rules.GetLoadingPrecedence()) {
+		return []clusterConfig{{Name: inClusterName, InCluster: true}}, nil
+	}
+	raw, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{}).RawConfig()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case allContexts:
+		contexts = nil
+		for name := range raw.Contexts {
+			contexts = append(contexts, name)
+		}
+		sort.Strings(contexts)
+	case len(contexts) == 0 && raw.CurrentContext != "":
+		contexts = []string{raw.CurrentContext}
+	}
+	if len(contexts) == 0 {
+		return nil, errors.New("kubeconfig has no contexts")
+	}
+	var clusters []clusterConfig
+	for _, context := range contexts {
+		if _, ok := raw.Contexts[context]; !ok {
+			return nil, fmt.Errorf("kubeconfig has no context %q", context)
+		}
+		clusters = append(clusters, clusterConfig{Name: context, Context: context, Kubeconfig: kubeconfig})
+	}
+	return clusters, nil
+}
+
+func anyFileExists(paths []string) bool {
+	for _, path := range paths {
+		if _, err := os.Stat(path); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// clientset returns a client for the cluster described by config.
+func (config clusterConfig) clientset() (kubernetes.Interface, error) {
+	var restConfig *rest.Config
+	var err error
+	if config.InCluster {
+		restConfig, err = rest.InClusterConfig()
+	} else {
+		rules := clientcmd.NewDefaultClientConfigLoadingRules()
+		rules.ExplicitPath = config.Kubeconfig
+		overrides := &clientcmd.ConfigOverrides{CurrentContext: config.Context}
+		restConfig, err = clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides).ClientConfig()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cluster %s: %w", config.Name, err)
+	}
+	return kubernetes.NewForConfig(restConfig)
+}
+
+// cluster caches the pods and workloads of one cluster.
+type cluster struct {
+	name string
+	// clientset reaches the API server for what isn't cached, events and
+	// logs.
+	clientset       kubernetes.Interface
+	informers       informers.SharedInformerFactory
+	pods            corelisters.PodLister
+	podsSynced      cache.InformerSynced
+	deployments     appslisters.DeploymentLister
+	statefulSets    appslisters.StatefulSetLister
+	daemonSets      appslisters.DaemonSetLister
+	jobs            batchlisters.JobLister
+	cronJobs        batchlisters.CronJobLister
+	workloadsSynced cache.InformerSynced
+
+	// apiErrors counts the failed list and watch calls by resource.
+	apiErrors *prometheus.CounterVec
+
+	mu sync.Mutex
+	// errs are the last list or watch errors of the informers by resource,
+	// cleared once the informer delivers objects again.
+	errs map[string]error
+}
+
+// newCluster returns a cluster caching the objects of clientset, resynced
+// every resync, that publishes pod changes to events and counts failed API
+// calls in apiErrors.
+func newCluster(name string, clientset kubernetes.Interface, resync time.Duration, events *podBroadcaster, apiErrors *prometheus.CounterVec) *cluster {
+	factory := informers.NewSharedInformerFactory(clientset, resync)
+	c := &cluster{name: name, clientset: clientset, informers: factory, apiErrors: apiErrors, errs: map[string]error{}}
+	pods := factory.Core().V1().Pods()
+	pods.Informer().AddEventHandler(events.eventHandler(name))
+	deployments := factory.Apps().V1().Deployments()
+	statefulSets := factory.Apps().V1().StatefulSets()
+	daemonSets := factory.Apps().V1().DaemonSets()
+	jobs := factory.Batch().V1().Jobs()
+	cronJobs := factory.Batch().V1().CronJobs()
+	workloadsSynced := []cache.InformerSynced{
+		c.watchErrors("deployments", deployments.Informer()),
+		c.watchErrors("statefulsets", statefulSets.Informer()),
+		c.watchErrors("daemonsets", daemonSets.Informer()),
+		c.watchErrors("jobs", jobs.Informer()),
+		c.watchErrors("cronjobs", cronJobs.Informer()),
+	}
+	c.pods = pods.Lister()
+	c.podsSynced = c.watchErrors("pods", pods.Informer())
+	c.deployments = deployments.Lister()
+	c.statefulSets = statefulSets.Lister()
+	c.daemonSets = daemonSets.Lister()
+	c.jobs = jobs.Lister()
+	c.cronJobs = cronJobs.Lister()
+	c.workloadsSynced = func() bool {
+		for _, synced := range workloadsSynced {
+			if !synced() {
+				return false
+			}
+		}
+		return true
+	}
+	return c
+}
+
+// watchErrors records the list and watch errors of informer under
+// resource, and returns whether it has synced. After an error the informer
+// relists, redelivering every object, so any object it delivers means it
+// reaches the cluster again.
+func (c *cluster) watchErrors(resource string, informer cache.SharedIndexInformer) cache.InformerSynced {
+	informer.SetWatchErrorHandler(func(r *cache.Reflector, err error) {
+		cache.DefaultWatchErrorHandler(r, err)
+		// Expired and closed watches are restarted as a matter of course
+		if apierrors.IsResourceExpired(err) || apierrors.IsGone(err) || err == io.EOF {
+			return
+		}
+		c.apiErrors.WithLabelValues(resource).Inc()
+		c.setError(resource, err)
+	})
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(interface{}) { c.setError(resource, nil) },
+		UpdateFunc: func(interface{}, interface{}) { c.setError(resource, nil) },
+		DeleteFunc: func(interface{}) { c.setError(resource, nil) },
+	})
+	return informer.HasSynced
+}
+
+func (c *cluster) setError(resource string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err == nil {
+		delete(c.errs, resource)
+	} else {
+		c.errs[resource] = err
+	}
+}
+
+// err returns the errors the cluster's informers currently fail with, if
+// any.
+func (c *cluster) err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	resources := make([]string, 0, len(c.errs))
+	for resource := range c.errs {
+		resources = append(resources, resource)
+	}
+	sort.Strings(resources)
+	if len(resources) == 0 {
+		return nil
+	}
+	var messages []string
+	for _, resource := range resources {
+		messages = append(messages, fmt.Sprintf("failed to watch %s: %v", resource, c.errs[resource]))
+	}
+	return errors.New(strings.Join(messages, "; "))
+}
+
+func (c *cluster) hasSynced() bool {
+	return c.podsSynced() && c.workloadsSynced()
+}
+
+// ClusterStatus is the connectivity of a cluster reported by /clusters.
+type ClusterStatus struct {
+	Name string `json:"name"`
+	// Synced is set once the cluster's objects are cached.
+	Synced bool `json:"synced"`
+	// Error is why the cache can't be kept up to date, if it can't.
+	Error string `json:"error,omitempty"`
+}
+
+func (c *cluster) status() ClusterStatus {
+	status := ClusterStatus{Name: c.name, Synced: c.hasSynced()}
+	if err := c.err(); err != nil {
+		status.Error = err.Error()
+	}
+	return status
+}
+
+// parseClusters returns the clusters named by the repeatable cluster query
+// parameter, every cluster when it isn't given.
+func (s *server) parseClusters(query url.Values) ([]*cluster, error) {
+	if !query.Has("cluster") {
+		return s.clusters, nil
+	}
+	var clusters []*cluster
+	for _, name := range query["cluster"] {
+		i := slices.IndexFunc(s.clusters, func(c *cluster) bool { return c.name == name })
+		if i < 0 {
+			return nil, fmt.Errorf("invalid cluster %q, use one of %s", name, strings.Join(s.clusterNames(), ", "))
+		}
+		if !slices.Contains(clusters, s.clusters[i]) {
+			clusters = append(clusters, s.clusters[i])
+		}
+	}
+	return clusters, nil
+}
+
+func (s *server) clusterNames() []string {
+	names := make([]string, len(s.clusters))
+	for i, c := range s.clusters {
+		names[i] = c.name
+	}
+	return names
+}
+
+// availableClusters returns the clusters whose objects of interest are
+// cached according to synced. The clusters left out, and those that fail
+// to keep their cache up to date, are reported to the client as Warning
+// headers, the way the API server reports problems that don't fail a
+// request.
+func availableClusters(w http.ResponseWriter, clusters []*cluster, synced func(*cluster) bool) []*cluster {
+	var available []*cluster
+	for _, c := range clusters {
+		err := c.err()
+		if synced(c) {
+			available = append(available, c)
+			if err != nil {
+				warn(w, fmt.Sprintf("cluster %s may be out of date: %v", c.name, err))
+			}
+			continue
+		}
+		if err != nil {
+			warn(w, fmt.Sprintf("cluster %s is unavailable: %v", c.name, err))
+		} else {
+			warn(w, fmt.Sprintf("cluster %s is not synced yet", c.name))
+		}
+	}
+	return available
+}
+
+// warn adds a Warning header with text to the response.
+func warn(w http.ResponseWriter, text string) {
+	w.Header().Add("Warning", "299 - "+strconv.Quote(text))
+}
+
+func (s *server) handleClusters(w http.ResponseWriter, r *http.Request) {
+	clusters, err := s.parseClusters(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	statuses := []ClusterStatus{}
+	for _, c := range clusters {
+		statuses = append(statuses, c.status())
+	}
+	writeJSON(w, statuses)
+}
+
+// logSynced logs when c's caches have synced.
+func (c *cluster) logSynced(stop <-chan struct{}) {
+	if cache.WaitForCacheSync(stop, c.hasSynced) {
+		log.Printf("Caches synced for cluster %s", c.name)
+	}
+}
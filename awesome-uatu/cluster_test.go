@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+)
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+current-context: staging
+clusters:
+- name: staging
+  cluster: {server: "https://staging.example.com"}
+- name: prod
+  cluster: {server: "https://prod.example.com"}
+users:
+- name: admin
+  user: {token: secret}
+contexts:
+- name: staging
+  context: {cluster: staging, user: admin}
+- name: prod
+  context: {cluster: prod, user: admin}
+`
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestKubeconfigClusters(t *testing.T) {
+	kubeconfig := writeFile(t, "config", testKubeconfig)
+	t.Setenv("KUBECONFIG", kubeconfig)
+	for _, tt := range []struct {
+		name        string
+		contexts    []string
+		allContexts bool
+		want        []string
+	}{
+		{"current context", nil, false, []string{"staging"}},
+		{"listed contexts", []string{"prod", "staging"}, false, []string{"prod", "staging"}},
+		{"all contexts", nil, true, []string{"prod", "staging"}},
+	} {
+		configs, err := kubeconfigClusters("", tt.contexts, tt.allContexts)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		var names []string
+		for _, config := range configs {
+			if config.Name != config.Context || config.InCluster {
+				t.Errorf("%s: cluster %+v, want the context of the same name", tt.name, config)
+			}
+			names = append(names, config.Name)
+		}
+		if !reflect.DeepEqual(names, tt.want) {
+			t.Errorf("%s: clusters %q, want %q", tt.name, names, tt.want)
+		}
+	}
+
+	if _, err := kubeconfigClusters("", []string{"dev"}, false); err == nil || !strings.Contains(err.Error(), `no context "dev"`) {
+		t.Errorf("unknown context: err = %v", err)
+	}
+	config, err := kubeconfigClusters(kubeconfig, []string{"prod"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := config[0].clientset(); err != nil {
+		t.Errorf("clientset for the prod context: %v", err)
+	}
+}
+
+func TestKubeconfigClustersFallBackToInCluster(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("KUBECONFIG", "")
+	configs, err := kubeconfigClusters("", nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []clusterConfig{{Name: inClusterName, InCluster: true}}; !reflect.DeepEqual(configs, want) {
+		t.Errorf("clusters without a kubeconfig = %+v, want %+v", configs, want)
+	}
+	if _, err := kubeconfigClusters("", []string{"prod"}, false); err == nil {
+		t.Error("asking for a context without a kubeconfig succeeded")
+	}
+}
+
+func TestLoadClusters(t *testing.T) {
+	configs, err := loadClusters(writeFile(t, "clusters.yaml", `clusters:
+- context: staging
+- name: production
+  context: prod
+  kubeconfig: /etc/uatu/prod.kubeconfig
+- inCluster: true
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []clusterConfig{
+		{Name: "staging", Context: "staging"},
+		{Name: "production", Context: "prod", Kubeconfig: "/etc/uatu/prod.kubeconfig"},
+		{Name: inClusterName, InCluster: true},
+	}
+	if !reflect.DeepEqual(configs, want) {
+		t.Errorf("loadClusters = %+v, want %+v", configs, want)
+	}
+
+	for _, content := range []string{
+		"clusters: []",
+		"clusters:\n- kubeconfig: /etc/uatu/prod.kubeconfig",
+		"clusters:\n- context: prod\n- name: prod\n  inCluster: true",
+		"clusters:\n- context: prod\n  inCluster: true",
+		"clusters:\n- contxt: prod",
+	} {
+		if _, err := loadClusters(writeFile(t, "clusters.yaml", content)); err == nil {
+			t.Errorf("loadClusters(%q) succeeded", content)
+		}
+	}
+}
+
+// newMultiClusterServer returns a server watching east and west, each
+// running a frontend deployment and its pod.
+func newMultiClusterServer() *server {
+	srv := newServer(0)
+	for _, name := range []string{"east", "west"} {
+		srv.addCluster(name, fake.NewSimpleClientset(
+			testPod("web", "frontend-"+name, corev1.PodRunning, nil),
+			testDeployment("frontend", 1, appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 1, UpdatedReplicas: 1, ReadyReplicas: 1, AvailableReplicas: 1}),
+		))
+	}
+	return srv
+}
+
+func TestStatusAcrossClusters(t *testing.T) {
+	routes := startServer(t, newMultiClusterServer()).routes()
+
+	for _, tt := range []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"east/frontend-east", "west/frontend-west"}},
+		{"cluster=west", []string{"west/frontend-west"}},
+		{"cluster=west&cluster=east", []string{"west/frontend-west", "east/frontend-east"}},
+	} {
+		recorder := get(t, routes, "/status?"+tt.query)
+		var statuses []PodStatus
+		if err := json.Unmarshal(recorder.Body.Bytes(), &statuses); err != nil {
+			t.Fatalf("GET /status?%s = %d %s", tt.query, recorder.Code, recorder.Body)
+		}
+		got := []string{}
+		for _, status := range statuses {
+			got = append(got, status.Cluster+"/"+status.Name)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("GET /status?%s = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+
+	for _, tt := range []struct {
+		target string
+		code   int
+	}{
+		{"/status?cluster=north", http.StatusBadRequest},
+		{"/workloads?cluster=north", http.StatusBadRequest},
+		{"/workloads/deployments/web/frontend", http.StatusConflict},
+		{"/workloads/deployments/web/frontend?cluster=west", http.StatusOK},
+		{"/status/stream?cluster=north", http.StatusBadRequest},
+	} {
+		if code := get(t, routes, tt.target).Code; code != tt.code {
+			t.Errorf("GET %s = %d, want %d", tt.target, code, tt.code)
+		}
+	}
+
+	var statuses []WorkloadStatus
+	json.Unmarshal(get(t, routes, "/workloads?kind=deployments").Body.Bytes(), &statuses)
+	if len(statuses) != 2 || statuses[0].Cluster != "east" || statuses[1].Cluster != "west" {
+		t.Errorf("GET /workloads = %+v, want the frontend of east and west", statuses)
+	}
+}
+
+func TestUnreachableClusterDoesNotFailResponses(t *testing.T) {
+	srv := newMultiClusterServer()
+	broken := fake.NewSimpleClientset()
+	broken.PrependReactor("list", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("connection refused")
+	})
+	srv.addCluster("north", broken)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	srv.start(ctx)
+	cache.WaitForCacheSync(ctx.Done(), srv.clusters[0].hasSynced, srv.clusters[1].hasSynced)
+	routes := srv.routes()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for srv.clusters[2].err() == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("the list error of north was not recorded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	recorder := get(t, routes, "/status")
+	if recorder.Code != http.StatusOK || !strings.Contains(recorder.Body.String(), "frontend-west") {
+		t.Errorf("GET /status = %d %s, want the pods of the other clusters", recorder.Code, recorder.Body)
+	}
+	if warning := recorder.Header().Get("Warning"); !strings.HasPrefix(warning, `299 - "cluster north is unavailable: `) ||
+		!strings.Contains(warning, "failed to watch pods: failed to list *v1.Pod: connection refused") {
+		t.Errorf("GET /status Warning = %q, want north reported unavailable", warning)
+	}
+	if code := get(t, routes, "/workloads?cluster=north").Code; code != http.StatusServiceUnavailable {
+		t.Errorf("GET /workloads?cluster=north = %d, want %d", code, http.StatusServiceUnavailable)
+	}
+	if code := get(t, routes, "/readyz").Code; code != http.StatusOK {
+		t.Errorf("GET /readyz = %d, want ready while other clusters are synced", code)
+	}
+
+	var clusters []ClusterStatus
+	json.Unmarshal(get(t, routes, "/clusters").Body.Bytes(), &clusters)
+	if len(clusters) != 3 || !clusters[0].Synced || clusters[0].Error != "" ||
+		clusters[2].Name != "north" || clusters[2].Synced || !strings.Contains(clusters[2].Error, "connection refused") {
+		t.Errorf("GET /clusters = %+v, want north failing", clusters)
+	}
+}
+
+func TestClusterErrorClearsOnceObjectsArrive(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	c := startTestServer(t, clientset).clusters[0]
+	c.setError("pods", errors.New("connection refused"))
+	if err := c.err(); err == nil || err.Error() != "failed to watch pods: connection refused" {
+		t.Fatalf("err = %v, want the pods error", err)
+	}
+
+	pod := testPod("web", "frontend", corev1.PodRunning, nil)
+	if _, err := clientset.CoreV1().Pods("web").Create(context.Background(), pod, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for c.err() != nil {
+		if time.Now().After(deadline) {
+			t.Fatalf("err = %v after a pod arrived, want none", c.err())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
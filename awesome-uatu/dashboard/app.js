@@ -0,0 +1,438 @@
+// The awesome-uatu dashboard. It keeps the pods up to date from
+// /status/stream, polls /workloads and /clusters, and reads the events of
+// the selected pod, so everything is served by awesome-uatu itself.
+"use strict";
+
+const workloadRefresh = 15000;
+// maxPodEvents is how many changes are kept per pod for the details panel.
+const maxPodEvents = 20;
+// logTailLines is how many lines the log links show.
+const logTailLines = 500;
+
+const state = {
+  pods: new Map(), // by podKey
+  podEvents: new Map(), // changes seen by this page, by podKey
+  kubeEvents: new Map(), // Kubernetes events of the selected pod, by podKey
+  workloads: new Map(), // by workloadKey
+  clusters: [],
+  selected: null,
+  stream: null,
+};
+
+const $ = (id) => document.getElementById(id);
+
+function podKey(pod) {
+  return `${pod.cluster}/${pod.namespace}/${pod.name}`;
+}
+
+function workloadKey(cluster, namespace, kind, name) {
+  return `${cluster}/${namespace}/${kind}/${name}`;
+}
+
+// podPath returns the path of a pod's subresource with query parameters.
+function podPath(pod, subresource, params) {
+  const query = new URLSearchParams({ cluster: pod.cluster, ...params });
+  return `../pods/${encodeURIComponent(pod.namespace)}/${encodeURIComponent(pod.name)}/${subresource}?${query}`;
+}
+
+// el creates an element with attributes and children, strings becoming
+// text so nothing from the API is parsed as HTML.
+function el(tag, attrs, ...children) {
+  const node = document.createElement(tag);
+  for (const [name, value] of Object.entries(attrs || {})) {
+    if (name.startsWith("on")) {
+      node.addEventListener(name.slice(2), value);
+    } else if (value !== undefined && value !== null && value !== false) {
+      node.setAttribute(name, value === true ? "" : value);
+    }
+  }
+  for (const child of children.flat()) {
+    if (child !== undefined && child !== null && child !== false) {
+      node.append(child instanceof Node ? child : String(child));
+    }
+  }
+  return node;
+}
+
+function badge(health) {
+  return el("span", { class: `badge health-${health}` }, health);
+}
+
+function formatTime(value) {
+  return value ? new Date(value).toLocaleString() : "";
+}
+
+// Stream
+
+function connect() {
+  const stream = new EventSource("../status/stream");
+  state.stream = stream;
+  stream.addEventListener("open", () => setConnection("connected"));
+  stream.addEventListener("error", () => {
+    // EventSource reconnects by itself, resuming from the last event id,
+    // unless the stream was refused, maybe for want of a token
+    if (stream.readyState === EventSource.CLOSED) {
+      setConnection("disconnected");
+      refreshWorkloads();
+    } else {
+      setConnection("reconnecting");
+    }
+  });
+  stream.addEventListener("SNAPSHOT", (event) => {
+    const message = JSON.parse(event.data);
+    state.pods = new Map();
+    for (const pod of message.pods || []) {
+      state.pods.set(podKey(pod), pod);
+    }
+    render();
+  });
+  for (const type of ["ADDED", "MODIFIED", "DELETED"]) {
+    stream.addEventListener(type, (event) => applyChange(JSON.parse(event.data)));
+  }
+}
+
+function disconnect() {
+  if (state.stream) {
+    state.stream.close();
+    state.stream = null;
+  }
+  setConnection("paused");
+}
+
+function setConnection(text) {
+  const connection = $("connection");
+  connection.textContent = text;
+  connection.className = "connection " + (text === "connected" ? "connected" : text === "paused" ? "" : "disconnected");
+}
+
+function applyChange(message) {
+  const pod = message.pod;
+  const key = podKey(pod);
+  const previous = state.pods.get(key);
+  if (message.type === "DELETED") {
+    state.pods.delete(key);
+  } else {
+    state.pods.set(key, pod);
+  }
+
+  let text = message.type.toLowerCase();
+  if (previous && previous.status !== pod.status) {
+    text += `: ${previous.status} → ${pod.status}`;
+  }
+  if (previous && previous.health !== pod.health) {
+    text += `, ${previous.health} → ${pod.health}`;
+  }
+  const events = state.podEvents.get(key) || [];
+  events.unshift({ time: new Date(), text, reasons: pod.reasons || [] });
+  state.podEvents.set(key, events.slice(0, maxPodEvents));
+  render();
+}
+
+// Polling
+
+async function fetchJSON(path) {
+  const response = await fetch(path, { headers: { Accept: "application/json" } });
+  if (response.status === 401) {
+    showLogin();
+    throw new Error("Sign in to see the clusters.");
+  }
+  if (!response.ok) {
+    throw new Error(`${path}: ${response.status} ${await response.text()}`);
+  }
+  return response.json();
+}
+
+async function refreshWorkloads() {
+  try {
+    const [workloads, clusters] = await Promise.all([fetchJSON("../workloads"), fetchJSON("../clusters")]);
+    state.workloads = new Map();
+    for (const workload of workloads) {
+      state.workloads.set(workloadKey(workload.cluster, workload.namespace, workload.kind, workload.name), workload);
+    }
+    state.clusters = clusters;
+    renderWarnings([]);
+  } catch (error) {
+    renderWarnings([error.message]);
+  }
+  render();
+}
+
+// Signing in
+
+// showLogin asks for a token, which /login keeps in a cookie since
+// EventSource can't send an Authorization header.
+function showLogin() {
+  if ($("login").hidden) {
+    $("login").hidden = false;
+    $("token").focus();
+  }
+}
+
+async function login(event) {
+  event.preventDefault();
+  const response = await fetch("../login", { method: "POST", body: new URLSearchParams({ token: $("token").value }) });
+  if (!response.ok) {
+    $("login-error").textContent = response.status === 401 ? "Invalid token" : await response.text();
+    return;
+  }
+  $("login").reset();
+  $("login-error").textContent = "";
+  $("login").hidden = true;
+  if ($("live").checked) {
+    if (state.stream) {
+      state.stream.close();
+    }
+    connect();
+  }
+  refreshWorkloads();
+}
+
+// Filters
+
+function filters() {
+  return {
+    search: $("search").value.trim().toLowerCase(),
+    cluster: $("cluster").value,
+    namespace: $("namespace").value,
+    phase: $("phase").value,
+    healths: new Set([...document.querySelectorAll("input[name=health]:checked")].map((input) => input.value)),
+  };
+}
+
+function matches(pod, filter) {
+  if (filter.cluster && pod.cluster !== filter.cluster) return false;
+  if (filter.namespace && pod.namespace !== filter.namespace) return false;
+  if (filter.phase && pod.status !== filter.phase) return false;
+  if (!filter.healths.has(pod.health)) return false;
+  if (!filter.search) return true;
+  const owner = pod.owner ? `${pod.owner.kind} ${pod.owner.name}` : "";
+  return [pod.name, pod.namespace, pod.node, owner, ...(pod.reasons || [])]
+    .some((value) => value && value.toLowerCase().includes(filter.search));
+}
+
+// setOptions keeps the choices of select up to date, keeping its value.
+function setOptions(select, values) {
+  const current = select.value;
+  const first = select.options[0];
+  select.replaceChildren(first, ...values.map((value) => el("option", { value }, value)));
+  select.value = values.includes(current) ? current : "";
+}
+
+// Rendering
+
+let renderPending = false;
+
+// render redraws the page once per frame however many changes arrive.
+function render() {
+  if (!renderPending) {
+    renderPending = true;
+    requestAnimationFrame(() => {
+      renderPending = false;
+      draw();
+    });
+  }
+}
+
+function draw() {
+  const pods = [...state.pods.values()];
+  const clusters = [...new Set([...state.clusters.map((cluster) => cluster.name), ...pods.map((pod) => pod.cluster)])].sort();
+  setOptions($("cluster"), clusters);
+  setOptions($("namespace"), [...new Set(pods.map((pod) => pod.namespace))].sort());
+
+  const filter = filters();
+  const shown = pods.filter((pod) => matches(pod, filter));
+  drawSummary(pods);
+  drawPods(shown, clusters.length > 1);
+  drawDetails();
+}
+
+function drawSummary(pods) {
+  const counts = { healthy: 0, degraded: 0, failing: 0 };
+  for (const pod of pods) {
+    counts[pod.health]++;
+  }
+  $("summary").replaceChildren(
+    el("span", {}, `${pods.length} pods`),
+    ...Object.entries(counts).map(([health, count]) => el("span", { class: `health-${health}` }, `${count} ${health}`)),
+  );
+}
+
+function drawPods(pods, showCluster) {
+  if (pods.length === 0) {
+    $("pods").replaceChildren(el("p", { class: "empty" }, state.pods.size ? "No pods match the filters." : "No pods yet."));
+    return;
+  }
+  // Group by cluster and namespace, then by owning workload
+  const namespaces = new Map();
+  for (const pod of pods) {
+    const namespaceKey = `${pod.cluster}/${pod.namespace}`;
+    if (!namespaces.has(namespaceKey)) {
+      namespaces.set(namespaceKey, { cluster: pod.cluster, namespace: pod.namespace, workloads: new Map() });
+    }
+    const owner = pod.owner || { kind: "", name: "" };
+    const ownerKey = `${owner.kind}/${owner.name}`;
+    const workloads = namespaces.get(namespaceKey).workloads;
+    if (!workloads.has(ownerKey)) {
+      workloads.set(ownerKey, { owner, pods: [] });
+    }
+    workloads.get(ownerKey).pods.push(pod);
+  }
+
+  const sections = [...namespaces.values()]
+    .sort((a, b) => a.cluster.localeCompare(b.cluster) || a.namespace.localeCompare(b.namespace))
+    .map((group) => el("section", { class: "namespace" },
+      el("h2", {}, group.namespace, showCluster && el("span", { class: "cluster" }, ` · ${group.cluster}`)),
+      [...group.workloads.values()]
+        .sort((a, b) => (a.owner.kind === "") - (b.owner.kind === "") || a.owner.name.localeCompare(b.owner.name))
+        .map((workload) => drawWorkload(group, workload))));
+  $("pods").replaceChildren(...sections);
+}
+
+function drawWorkload(group, { owner, pods }) {
+  const workload = state.workloads.get(workloadKey(group.cluster, group.namespace, owner.kind, owner.name));
+  const heading = owner.kind
+    ? el("h3", {}, el("span", { class: "kind" }, owner.kind + " "), owner.name,
+      workload && [" ", badge(workload.health)],
+      workload && workload.replicas && el("span", { class: "replicas" }, ` ${workload.replicas.ready}/${workload.replicas.desired} ready`))
+    : el("h3", {}, el("span", { class: "kind" }, "Pods without a workload"));
+  pods.sort((a, b) => a.name.localeCompare(b.name));
+  return el("div", { class: "workload" }, heading,
+    el("div", { class: "pod-list" }, pods.map((pod) => el("button", {
+      type: "button",
+      class: `pod health-${pod.health}` + (state.selected === podKey(pod) ? " selected" : ""),
+      title: (pod.reasons || []).join("\n") || pod.health,
+      onclick: () => select(podKey(pod)),
+    }, pod.name, el("span", { class: "phase" }, pod.status)))));
+}
+
+function select(key) {
+  state.selected = state.selected === key ? null : key;
+  if (state.selected && state.pods.has(key)) {
+    loadEvents(state.pods.get(key));
+  }
+  render();
+}
+
+async function loadEvents(pod) {
+  const key = podKey(pod);
+  try {
+    state.kubeEvents.set(key, { events: await fetchJSON(podPath(pod, "events")) });
+  } catch (error) {
+    state.kubeEvents.set(key, { error: error.message });
+  }
+  render();
+}
+
+function drawDetails() {
+  const details = $("details");
+  const pod = state.selected && state.pods.get(state.selected);
+  const events = state.selected && state.podEvents.get(state.selected);
+  if (!state.selected || (!pod && !events)) {
+    details.hidden = true;
+    return;
+  }
+  details.hidden = false;
+  const close = el("button", { type: "button", class: "close", "aria-label": "Close", onclick: () => select(state.selected) }, "×");
+  if (!pod) {
+    details.replaceChildren(el("div", {}, close, el("h2", {}, state.selected), el("p", {}, "The pod was deleted."), drawPodEvents(events)));
+    return;
+  }
+  details.replaceChildren(el("div", {},
+    close,
+    el("h2", {}, pod.name, " ", badge(pod.health)),
+    el("dl", {},
+      el("dt", {}, "Cluster"), el("dd", {}, pod.cluster),
+      el("dt", {}, "Namespace"), el("dd", {}, pod.namespace),
+      el("dt", {}, "Phase"), el("dd", {}, pod.status),
+      el("dt", {}, "Ready"), el("dd", {}, pod.ready ? "yes" : "no"),
+      el("dt", {}, "Owner"), el("dd", {}, pod.owner ? `${pod.owner.kind} ${pod.owner.name}` : "none"),
+      el("dt", {}, "Node"), el("dd", {}, pod.node || "unscheduled"),
+      el("dt", {}, "Pod IP"), el("dd", {}, pod.podIP || ""),
+      el("dt", {}, "Created"), el("dd", {}, `${formatTime(pod.createdAt)} (${pod.age} ago)`)),
+    pod.reasons && pod.reasons.length > 0 && [el("h3", {}, "Why it isn't healthy"), el("ul", {}, pod.reasons.map((reason) => el("li", {}, reason)))],
+    el("h3", {}, "Containers"),
+    el("table", {},
+      el("thead", {}, el("tr", {}, ["Name", "State", "Restarts", "Logs", "Last termination"].map((name) => el("th", {}, name)))),
+      el("tbody", {}, pod.containers.map((container) => el("tr", {},
+        el("td", {}, container.name, container.init && el("span", { class: "phase" }, " init")),
+        el("td", {}, container.state, container.reason && ` (${container.reason})`,
+          container.exitCode !== undefined && `, exit code ${container.exitCode}`, container.ready && ", ready"),
+        el("td", {}, container.restarts),
+        el("td", {},
+          el("a", { href: podPath(pod, "logs", { container: container.name, tailLines: logTailLines }), target: "_blank" }, "logs"),
+          container.restarts > 0 && [" ", el("a", {
+            href: podPath(pod, "logs", { container: container.name, tailLines: logTailLines, previous: true }),
+            target: "_blank",
+          }, "previous")]),
+        el("td", {}, container.lastTermination
+          ? `${container.lastTermination.reason || "terminated"}, exit code ${container.lastTermination.exitCode}, ${formatTime(container.lastTermination.finishedAt)}`
+          : ""))))),
+    el("h3", {}, "Conditions"),
+    el("table", {}, el("tbody", {}, pod.conditions.map((condition) => el("tr", {},
+      el("td", {}, condition.type),
+      el("td", {}, condition.status),
+      el("td", {}, [condition.reason, condition.message].filter(Boolean).join(": ")))))),
+    drawKubeEvents(state.kubeEvents.get(state.selected)),
+    drawPodEvents(events),
+  ));
+}
+
+function drawKubeEvents(loaded) {
+  let content;
+  if (!loaded) {
+    content = el("p", { class: "phase" }, "Loading…");
+  } else if (loaded.error) {
+    content = el("p", { class: "health-failing" }, loaded.error);
+  } else if (loaded.events.length === 0) {
+    content = el("p", { class: "phase" }, "No events, they expire after an hour by default.");
+  } else {
+    content = el("table", {}, el("tbody", {}, loaded.events.slice().reverse().map((event) => el("tr", {},
+      el("td", {}, new Date(event.lastSeen).toLocaleTimeString()),
+      el("td", { class: event.type === "Warning" ? "health-failing" : "" }, event.reason),
+      el("td", {}, event.container && `${event.container}: `, event.message, event.count > 1 && ` (×${event.count})`)))));
+  }
+  return [el("h3", {}, "Events"), content];
+}
+
+function drawPodEvents(events) {
+  return [
+    el("h3", {}, "Recent changes"),
+    events && events.length
+      ? el("ul", {}, events.map((event) => el("li", {},
+        `${event.time.toLocaleTimeString()} ${event.text}`,
+        event.reasons.length > 0 && el("span", { class: "phase" }, ` (${event.reasons.join("; ")})`))))
+      : el("p", { class: "phase" }, "None since the page was opened."),
+  ];
+}
+
+function renderWarnings(errors) {
+  const warnings = [...errors];
+  for (const cluster of state.clusters) {
+    if (cluster.error) {
+      warnings.push(`Cluster ${cluster.name}: ${cluster.error}`);
+    } else if (!cluster.synced) {
+      warnings.push(`Cluster ${cluster.name} is not synced yet`);
+    }
+  }
+  $("warnings").replaceChildren(...warnings.map((warning) => el("div", {}, warning)));
+}
+
+// Setup
+
+$("filters").addEventListener("input", render);
+$("filters").addEventListener("submit", (event) => event.preventDefault());
+$("login").addEventListener("submit", login);
+$("live").addEventListener("change", (event) => (event.target.checked ? connect() : disconnect()));
+document.addEventListener("keydown", (event) => {
+  if (event.key === "Escape" && state.selected) {
+    select(state.selected);
+  }
+});
+
+connect();
+refreshWorkloads();
+setInterval(() => {
+  if ($("live").checked) {
+    refreshWorkloads();
+  }
+}, workloadRefresh);
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"io/fs"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestDashboard(t *testing.T) {
+	routes := newTestServer(fake.NewSimpleClientset()).routes()
+
+	if recorder := get(t, routes, "/"); recorder.Code != http.StatusFound || recorder.Header().Get("Location") != "/dashboard/" {
+		t.Errorf("GET / = %d %s, want a redirect to the dashboard", recorder.Code, recorder.Header().Get("Location"))
+	}
+	for target, contentType := range map[string]string{
+		"/dashboard/":          "text/html; charset=utf-8",
+		"/dashboard/app.js":    "text/javascript; charset=utf-8",
+		"/dashboard/style.css": "text/css; charset=utf-8",
+	} {
+		recorder := get(t, routes, target)
+		if recorder.Code != http.StatusOK || recorder.Header().Get("Content-Type") != contentType {
+			t.Errorf("GET %s = %d %s, want %s", target, recorder.Code, recorder.Header().Get("Content-Type"), contentType)
+		}
+	}
+	if code := get(t, routes, "/unknown").Code; code != http.StatusNotFound {
+		t.Errorf("GET /unknown = %d, want %d", code, http.StatusNotFound)
+	}
+}
+
+func TestDashboardHasNoExternalDependencies(t *testing.T) {
+	external := regexp.MustCompile(`(?i)(https?:)?//[a-z0-9.-]+\.[a-z]{2,}`)
+	fs.WalkDir(dashboardFiles, "dashboard", func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		data, _ := dashboardFiles.ReadFile(path)
+		for _, line := range strings.Split(string(data), "\n") {
+			if match := external.FindString(line); match != "" && !strings.HasPrefix(strings.TrimSpace(line), "//") {
+				t.Errorf("%s loads %s: %s", path, match, line)
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// podPhases are the values accepted by the phase query parameter.
+var podPhases = []corev1.PodPhase{
+	corev1.PodPending,
+	corev1.PodRunning,
+	corev1.PodSucceeded,
+	corev1.PodFailed,
+	corev1.PodUnknown,
+}
+
+// podFilter selects the pods reported by /status.
+type podFilter struct {
+	// Namespaces to list pods in, all namespaces when empty.
+	Namespaces    []string
+	LabelSelector labels.Selector
+	FieldSelector fields.Selector
+	// Phases the pods must be in, any phase when empty.
+	Phases []corev1.PodPhase
+	// Access is what the client may see, everything when nil.
+	Access *access
+}
+
+// parsePodFilter reads a podFilter from the namespace, labelSelector,
+// fieldSelector and phase query parameters. namespace and phase may be
+// repeated.
+func parsePodFilter(query url.Values) (podFilter, error) {
+	namespaces, err := parseNamespaces(query)
+	if err != nil {
+		return podFilter{}, err
+	}
+	labelSelector, err := parseLabelSelector(query)
+	if err != nil {
+		return podFilter{}, err
+	}
+	filter := podFilter{Namespaces: namespaces, LabelSelector: labelSelector, FieldSelector: fields.Everything()}
+	if query.Has("fieldSelector") {
+		selector, err := fields.ParseSelector(query.Get("fieldSelector"))
+		if err != nil {
+			return podFilter{}, fmt.Errorf("invalid fieldSelector: %w", err)
+		}
+		supported := podFields(&corev1.Pod{})
+		for _, requirement := range selector.Requirements() {
+			if !supported.Has(requirement.Field) {
+				return podFilter{}, fmt.Errorf("invalid fieldSelector: pods can't be selected by %q", requirement.Field)
+			}
+		}
+		filter.FieldSelector = selector
+	}
+	for _, value := range query["phase"] {
+		phase, ok := parsePodPhase(value)
+		if !ok {
+			return podFilter{}, fmt.Errorf("invalid phase %q, use one of %s", value, phaseList())
+		}
+		filter.Phases = append(filter.Phases, phase)
+	}
+	return filter, nil
+}
+
+// parseNamespaces returns the distinct values of the namespace query
+// parameter.
+func parseNamespaces(query url.Values) ([]string, error) {
+	var namespaces []string
+	for _, namespace := range query["namespace"] {
+		if errs := validation.IsDNS1123Label(namespace); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid namespace %q: %s", namespace, strings.Join(errs, ", "))
+		}
+		if !slices.Contains(namespaces, namespace) {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+	return namespaces, nil
+}
+
+// parseLabelSelector returns the labelSelector query parameter, selecting
+// everything when it is not set.
+func parseLabelSelector(query url.Values) (labels.Selector, error) {
+	if !query.Has("labelSelector") {
+		return labels.Everything(), nil
+	}
+	selector, err := labels.Parse(query.Get("labelSelector"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid labelSelector: %w", err)
+	}
+	return selector, nil
+}
+
+// parsePodPhase matches value against podPhases, ignoring case.
+func parsePodPhase(value string) (corev1.PodPhase, bool) {
+	for _, phase := range podPhases {
+		if strings.EqualFold(value, string(phase)) {
+			return phase, true
+		}
+	}
+	return "", false
+}
+
+func phaseList() string {
+	names := make([]string, len(podPhases))
+	for i, phase := range podPhases {
+		names[i] = string(phase)
+	}
+	return strings.Join(names, ", ")
+}
+
+// podFields returns the fields of pod a fieldSelector can select, the same
+// ones the API server supports for pods.
+func podFields(pod *corev1.Pod) fields.Set {
+	podIPs := make([]string, len(pod.Status.PodIPs))
+	for i, ip := range pod.Status.PodIPs {
+		podIPs[i] = ip.IP
+	}
+	return fields.Set{
+		"metadata.name":            pod.Name,
+		"metadata.namespace":       pod.Namespace,
+		"spec.nodeName":            pod.Spec.NodeName,
+		"spec.restartPolicy":       string(pod.Spec.RestartPolicy),
+		"spec.schedulerName":       pod.Spec.SchedulerName,
+		"spec.serviceAccountName":  pod.Spec.ServiceAccountName,
+		"spec.hostNetwork":         strconv.FormatBool(pod.Spec.HostNetwork),
+		"status.phase":             string(pod.Status.Phase),
+		"status.podIP":             pod.Status.PodIP,
+		"status.podIPs":            strings.Join(podIPs, ","),
+		"status.nominatedNodeName": pod.Status.NominatedNodeName,
+	}
+}
+
+// namespaces returns the namespaces to list pods in, "" meaning all of them.
+func (f podFilter) namespaces() []string {
+	if len(f.Namespaces) == 0 {
+		return []string{metav1.NamespaceAll}
+	}
+	return f.Namespaces
+}
+
+// matches reports whether pod is in one of the filter's namespaces that the
+// client may see, selected by its selectors and in one of its phases.
+func (f podFilter) matches(pod *corev1.Pod) bool {
+	if len(f.Namespaces) > 0 && !slices.Contains(f.Namespaces, pod.Namespace) || !f.Access.allows(pod.Namespace) {
+		return false
+	}
+	if !f.LabelSelector.Matches(labels.Set(pod.Labels)) || !f.FieldSelector.Matches(podFields(pod)) {
+		return false
+	}
+	if len(f.Phases) == 0 {
+		return true
+	}
+	for _, phase := range f.Phases {
+		if pod.Status.Phase == phase {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParsePodFilter(t *testing.T) {
+	for _, tt := range []struct {
+		query          string
+		namespaces     []string
+		labelSelector  string
+		fieldSelector  string
+		phases         []corev1.PodPhase
+		listNamespaces []string
+	}{
+		{"", nil, "", "", nil, []string{""}},
+		{"namespace=web&namespace=db&namespace=web", []string{"web", "db"}, "", "", nil, []string{"web", "db"}},
+		{"labelSelector=app%3Dweb,tier+in+(front,back)", nil, "app=web,tier in (back,front)", "", nil, []string{""}},
+		{"fieldSelector=spec.nodeName%3Dnode-1", nil, "", "spec.nodeName=node-1", nil, []string{""}},
+		{"phase=running", nil, "", "", []corev1.PodPhase{corev1.PodRunning}, []string{""}},
+		{"phase=Pending&phase=Failed&fieldSelector=spec.nodeName%3Dnode-1", nil, "", "spec.nodeName=node-1", []corev1.PodPhase{corev1.PodPending, corev1.PodFailed}, []string{""}},
+	} {
+		query, _ := url.ParseQuery(tt.query)
+		filter, err := parsePodFilter(query)
+		if err != nil {
+			t.Errorf("parsePodFilter(%q) failed: %v", tt.query, err)
+			continue
+		}
+		if !reflect.DeepEqual(filter.Namespaces, tt.namespaces) {
+			t.Errorf("parsePodFilter(%q) namespaces = %q, want %q", tt.query, filter.Namespaces, tt.namespaces)
+		}
+		if !reflect.DeepEqual(filter.namespaces(), tt.listNamespaces) {
+			t.Errorf("parsePodFilter(%q) lists namespaces %q, want %q", tt.query, filter.namespaces(), tt.listNamespaces)
+		}
+		if filter.LabelSelector.String() != tt.labelSelector {
+			t.Errorf("parsePodFilter(%q) labelSelector = %q, want %q", tt.query, filter.LabelSelector, tt.labelSelector)
+		}
+		if filter.FieldSelector.String() != tt.fieldSelector {
+			t.Errorf("parsePodFilter(%q) fieldSelector = %q, want %q", tt.query, filter.FieldSelector, tt.fieldSelector)
+		}
+		if !reflect.DeepEqual(filter.Phases, tt.phases) {
+			t.Errorf("parsePodFilter(%q) phases = %q, want %q", tt.query, filter.Phases, tt.phases)
+		}
+	}
+}
+
+func TestParsePodFilterErrors(t *testing.T) {
+	for _, tt := range []struct {
+		query string
+		want  string
+	}{
+		{"namespace=Web_Apps", `invalid namespace "Web_Apps"`},
+		{"namespace=", `invalid namespace ""`},
+		{"labelSelector=app%3D%3D%3Dweb", "invalid labelSelector"},
+		{"labelSelector=app+in+web", "invalid labelSelector"},
+		{"fieldSelector=spec.nodeName", "invalid fieldSelector"},
+		{"fieldSelector=spec.priority%3D1", `invalid fieldSelector: pods can't be selected by "spec.priority"`},
+		{"phase=Crashing", `invalid phase "Crashing", use one of Pending, Running, Succeeded, Failed, Unknown`},
+	} {
+		query, _ := url.ParseQuery(tt.query)
+		_, err := parsePodFilter(query)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("parsePodFilter(%q) error = %v, want %q", tt.query, err, tt.want)
+		}
+	}
+}
+
+func TestPodFilterMatches(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "web", Name: "frontend", Labels: map[string]string{"app": "frontend"}},
+		Spec:       corev1.PodSpec{NodeName: "node-1"},
+		Status:     corev1.PodStatus{Phase: corev1.PodRunning, PodIP: "10.0.0.7"},
+	}
+	for _, tt := range []struct {
+		query string
+		want  bool
+	}{
+		{"", true},
+		{"labelSelector=app%3Dfrontend", true},
+		{"labelSelector=app!%3Dfrontend", false},
+		{"fieldSelector=spec.nodeName%3Dnode-1,status.podIP%3D10.0.0.7", true},
+		{"fieldSelector=spec.nodeName!%3Dnode-1", false},
+		{"phase=Pending&phase=Running", true},
+		{"phase=Failed", false},
+	} {
+		query, _ := url.ParseQuery(tt.query)
+		filter, err := parsePodFilter(query)
+		if err != nil {
+			t.Fatalf("parsePodFilter(%q) failed: %v", tt.query, err)
+		}
+		if got := filter.matches(pod); got != tt.want {
+			t.Errorf("parsePodFilter(%q).matches(pod) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/duration"
+)
+
+// Health is the overall state of a pod, derived from its phase, conditions
+// and containers.
+type Health string
+
+const (
+	// Healthy pods are running and ready, or completed successfully.
+	Healthy Health = "healthy"
+	// Degraded pods are starting, not ready or recently restarted, and may
+	// recover on their own.
+	Degraded Health = "degraded"
+	// Failing pods failed, are crash looping or can't start or be scheduled.
+	Failing Health = "failing"
+)
+
+// recentRestart is how long a container restart keeps a pod degraded.
+const recentRestart = 10 * time.Minute
+
+// failingWaitingReasons are container waiting reasons that don't resolve
+// without someone fixing the pod or its image.
+var failingWaitingReasons = map[string]bool{
+	"CrashLoopBackOff":           true,
+	"ImagePullBackOff":           true,
+	"ErrImagePull":               true,
+	"InvalidImageName":           true,
+	"CreateContainerConfigError": true,
+	"CreateContainerError":       true,
+	"RunContainerError":          true,
+}
+
+// PodStatus is a pod as reported by /status and streamed by /status/stream.
+type PodStatus struct {
+	// Cluster is the name of the cluster the pod runs in.
+	Cluster   string `json:"cluster,omitempty"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	// Status is the pod's phase.
+	Status     string            `json:"status"`
+	Node       string            `json:"node,omitempty"`
+	PodIP      string            `json:"podIP,omitempty"`
+	Ready      bool              `json:"ready"`
+	Conditions []PodCondition    `json:"conditions"`
+	Containers []ContainerStatus `json:"containers"`
+	// Owner is the workload managing the pod, if any.
+	Owner     *Owner    `json:"owner,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Age is how long ago the pod was created, as kubectl shows it.
+	Age    string `json:"age"`
+	Health Health `json:"health"`
+	// Reasons explain why the pod isn't healthy.
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+// PodCondition is one of the conditions of a pod, e.g. Ready or PodScheduled.
+type PodCondition struct {
+	Type    string `json:"type"`
+	Status  string `json:"status"`
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// ContainerStatus is the state of one of a pod's containers.
+type ContainerStatus struct {
+	Name string `json:"name"`
+	// Init is set for init containers.
+	Init  bool `json:"init,omitempty"`
+	Ready bool `json:"ready"`
+	// State is waiting, running or terminated.
+	State string `json:"state"`
+	// Reason is why the container is waiting or terminated.
+	Reason   string `json:"reason,omitempty"`
+	ExitCode *int32 `json:"exitCode,omitempty"`
+	Restarts int32  `json:"restarts"`
+	// LastTermination is how the previous run of the container ended.
+	LastTermination *Termination `json:"lastTermination,omitempty"`
+}
+
+// Termination describes how a container run ended.
+type Termination struct {
+	Reason     string    `json:"reason,omitempty"`
+	ExitCode   int32     `json:"exitCode"`
+	FinishedAt time.Time `json:"finishedAt"`
+}
+
+// Owner identifies the workload a pod belongs to. Pods of a Deployment are
+// reported as owned by the Deployment rather than its ReplicaSet.
+type Owner struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+}
+
+// podStatus describes pod as of now.
+func podStatus(pod *corev1.Pod, now time.Time) PodStatus {
+	status := PodStatus{
+		Namespace:  pod.Namespace,
+		Name:       pod.Name,
+		Status:     string(pod.Status.Phase),
+		Node:       pod.Spec.NodeName,
+		PodIP:      pod.Status.PodIP,
+		Conditions: []PodCondition{},
+		Containers: []ContainerStatus{},
+		Owner:      podOwner(pod),
+		CreatedAt:  pod.CreationTimestamp.Time,
+		Age:        duration.HumanDuration(now.Sub(pod.CreationTimestamp.Time)),
+	}
+	for _, condition := range pod.Status.Conditions {
+		status.Conditions = append(status.Conditions, PodCondition{
+			Type:    string(condition.Type),
+			Status:  string(condition.Status),
+			Reason:  condition.Reason,
+			Message: condition.Message,
+		})
+		if condition.Type == corev1.PodReady {
+			status.Ready = condition.Status == corev1.ConditionTrue
+		}
+	}
+	for _, container := range pod.Status.InitContainerStatuses {
+		status.Containers = append(status.Containers, containerStatus(container, true))
+	}
+	for _, container := range pod.Status.ContainerStatuses {
+		status.Containers = append(status.Containers, containerStatus(container, false))
+	}
+	status.Health, status.Reasons = podHealth(pod, now)
+	return status
+}
+
+func containerStatus(container corev1.ContainerStatus, init bool) ContainerStatus {
+	status := ContainerStatus{
+		Name:     container.Name,
+		Init:     init,
+		Ready:    container.Ready,
+		Restarts: container.RestartCount,
+	}
+	switch state := container.State; {
+	case state.Waiting != nil:
+		status.State, status.Reason = "waiting", state.Waiting.Reason
+	case state.Running != nil:
+		status.State = "running"
+	case state.Terminated != nil:
+		exitCode := state.Terminated.ExitCode
+		status.State, status.Reason, status.ExitCode = "terminated", state.Terminated.Reason, &exitCode
+	}
+	if last := container.LastTerminationState.Terminated; last != nil {
+		status.LastTermination = &Termination{
+			Reason:     last.Reason,
+			ExitCode:   last.ExitCode,
+			FinishedAt: last.FinishedAt.Time,
+		}
+	}
+	return status
+}
+
+// podOwner returns the controller of pod. ReplicaSets created by a
+// Deployment are named after it with the pod-template-hash label appended,
+// so their pods are attributed to the Deployment.
+func podOwner(pod *corev1.Pod) *Owner {
+	controller := metav1.GetControllerOf(pod)
+	if controller == nil {
+		return nil
+	}
+	owner := &Owner{Kind: controller.Kind, Name: controller.Name}
+	if hash := pod.Labels["pod-template-hash"]; controller.Kind == "ReplicaSet" && hash != "" {
+		if name, ok := strings.CutSuffix(controller.Name, "-"+hash); ok {
+			owner = &Owner{Kind: "Deployment", Name: name}
+		}
+	}
+	return owner
+}
+
+// podHealth derives the health of pod and the reasons it isn't healthy.
+func podHealth(pod *corev1.Pod, now time.Time) (Health, []string) {
+	var failing, degraded []string
+	switch pod.Status.Phase {
+	case corev1.PodSucceeded:
+		return Healthy, nil
+	case corev1.PodFailed:
+		reason := "pod failed"
+		if pod.Status.Reason != "" {
+			reason += ": " + pod.Status.Reason
+		}
+		failing = append(failing, reason)
+	case corev1.PodUnknown:
+		failing = append(failing, "pod state is unknown, its node may be unreachable")
+	case corev1.PodPending:
+		degraded = append(degraded, "pod is pending")
+	}
+
+	for _, condition := range pod.Status.Conditions {
+		switch {
+		case condition.Type == corev1.PodScheduled && condition.Status == corev1.ConditionFalse && condition.Reason == corev1.PodReasonUnschedulable:
+			failing = append(failing, "pod can't be scheduled: "+condition.Message)
+		case condition.Type == corev1.PodReady && condition.Status != corev1.ConditionTrue && pod.Status.Phase == corev1.PodRunning:
+			degraded = append(degraded, "pod is not ready")
+		}
+	}
+
+	containers := append(append([]corev1.ContainerStatus(nil), pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, container := range containers {
+		if waiting := container.State.Waiting; waiting != nil && failingWaitingReasons[waiting.Reason] {
+			failing = append(failing, fmt.Sprintf("container %s is waiting: %s", container.Name, waiting.Reason))
+		}
+		last := container.LastTerminationState.Terminated
+		if container.RestartCount > 0 && last != nil && now.Sub(last.FinishedAt.Time) < recentRestart {
+			degraded = append(degraded, fmt.Sprintf("container %s restarted %s ago: %s, exit code %d",
+				container.Name, duration.HumanDuration(now.Sub(last.FinishedAt.Time)), last.Reason, last.ExitCode))
+		}
+	}
+
+	switch {
+	case len(failing) > 0:
+		return Failing, append(failing, degraded...)
+	case len(degraded) > 0:
+		return Degraded, degraded
+	default:
+		return Healthy, nil
+	}
+}
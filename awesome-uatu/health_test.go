@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var testNow = time.Date(2024, 9, 26, 12, 0, 0, 0, time.UTC)
+
+func readyCondition(status corev1.ConditionStatus) corev1.PodCondition {
+	return corev1.PodCondition{Type: corev1.PodReady, Status: status}
+}
+
+func runningContainer(name string, ready bool) corev1.ContainerStatus {
+	return corev1.ContainerStatus{Name: name, Ready: ready, State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}}
+}
+
+func restartedContainer(name string, restarts int32, finished time.Time) corev1.ContainerStatus {
+	container := runningContainer(name, true)
+	container.RestartCount = restarts
+	container.LastTerminationState.Terminated = &corev1.ContainerStateTerminated{Reason: "OOMKilled", ExitCode: 137, FinishedAt: metav1.NewTime(finished)}
+	return container
+}
+
+func waitingContainer(name, reason string) corev1.ContainerStatus {
+	return corev1.ContainerStatus{Name: name, State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: reason}}}
+}
+
+func TestPodHealth(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		status  corev1.PodStatus
+		health  Health
+		reasons []string
+	}{
+		{"running and ready", corev1.PodStatus{
+			Phase:             corev1.PodRunning,
+			Conditions:        []corev1.PodCondition{readyCondition(corev1.ConditionTrue)},
+			ContainerStatuses: []corev1.ContainerStatus{runningContainer("app", true)},
+		}, Healthy, nil},
+		{"completed", corev1.PodStatus{Phase: corev1.PodSucceeded}, Healthy, nil},
+		{"restarted long ago", corev1.PodStatus{
+			Phase:             corev1.PodRunning,
+			Conditions:        []corev1.PodCondition{readyCondition(corev1.ConditionTrue)},
+			ContainerStatuses: []corev1.ContainerStatus{restartedContainer("app", 4, testNow.Add(-time.Hour))},
+		}, Healthy, nil},
+		{"restarted recently", corev1.PodStatus{
+			Phase:             corev1.PodRunning,
+			Conditions:        []corev1.PodCondition{readyCondition(corev1.ConditionTrue)},
+			ContainerStatuses: []corev1.ContainerStatus{restartedContainer("app", 4, testNow.Add(-2*time.Minute))},
+		}, Degraded, []string{"container app restarted 2m ago: OOMKilled, exit code 137"}},
+		{"not ready", corev1.PodStatus{
+			Phase:             corev1.PodRunning,
+			Conditions:        []corev1.PodCondition{readyCondition(corev1.ConditionFalse)},
+			ContainerStatuses: []corev1.ContainerStatus{runningContainer("app", false)},
+		}, Degraded, []string{"pod is not ready"}},
+		{"pending", corev1.PodStatus{Phase: corev1.PodPending}, Degraded, []string{"pod is pending"}},
+		{"crash looping", corev1.PodStatus{
+			Phase:             corev1.PodRunning,
+			Conditions:        []corev1.PodCondition{readyCondition(corev1.ConditionFalse)},
+			ContainerStatuses: []corev1.ContainerStatus{waitingContainer("app", "CrashLoopBackOff")},
+		}, Failing, []string{"container app is waiting: CrashLoopBackOff", "pod is not ready"}},
+		{"init container can't pull its image", corev1.PodStatus{
+			Phase:                 corev1.PodPending,
+			InitContainerStatuses: []corev1.ContainerStatus{waitingContainer("migrate", "ImagePullBackOff")},
+			ContainerStatuses:     []corev1.ContainerStatus{waitingContainer("app", "PodInitializing")},
+		}, Failing, []string{"container migrate is waiting: ImagePullBackOff", "pod is pending"}},
+		{"unschedulable", corev1.PodStatus{
+			Phase: corev1.PodPending,
+			Conditions: []corev1.PodCondition{{
+				Type: corev1.PodScheduled, Status: corev1.ConditionFalse, Reason: corev1.PodReasonUnschedulable,
+				Message: "0/3 nodes are available: 3 Insufficient memory.",
+			}},
+		}, Failing, []string{"pod can't be scheduled: 0/3 nodes are available: 3 Insufficient memory.", "pod is pending"}},
+		{"failed", corev1.PodStatus{Phase: corev1.PodFailed, Reason: "Evicted"}, Failing, []string{"pod failed: Evicted"}},
+		{"unknown", corev1.PodStatus{Phase: corev1.PodUnknown}, Failing, []string{"pod state is unknown, its node may be unreachable"}},
+	} {
+		health, reasons := podHealth(&corev1.Pod{Status: tt.status}, testNow)
+		if health != tt.health || !reflect.DeepEqual(reasons, tt.reasons) {
+			t.Errorf("%s: podHealth = %s %q, want %s %q", tt.name, health, reasons, tt.health, tt.reasons)
+		}
+	}
+}
+
+func TestPodOwner(t *testing.T) {
+	controller := func(kind, name string) []metav1.OwnerReference {
+		isController := true
+		return []metav1.OwnerReference{{Kind: kind, Name: name, Controller: &isController}}
+	}
+	for _, tt := range []struct {
+		name   string
+		meta   metav1.ObjectMeta
+		expect *Owner
+	}{
+		{"bare pod", metav1.ObjectMeta{}, nil},
+		{"deployment", metav1.ObjectMeta{OwnerReferences: controller("ReplicaSet", "web-7d4b9c"), Labels: map[string]string{"pod-template-hash": "7d4b9c"}}, &Owner{"Deployment", "web"}},
+		{"bare replica set", metav1.ObjectMeta{OwnerReferences: controller("ReplicaSet", "web")}, &Owner{"ReplicaSet", "web"}},
+		{"stateful set", metav1.ObjectMeta{OwnerReferences: controller("StatefulSet", "postgres")}, &Owner{"StatefulSet", "postgres"}},
+		{"not a controller", metav1.ObjectMeta{OwnerReferences: []metav1.OwnerReference{{Kind: "Job", Name: "backup"}}}, nil},
+	} {
+		if owner := podOwner(&corev1.Pod{ObjectMeta: tt.meta}); !reflect.DeepEqual(owner, tt.expect) {
+			t.Errorf("%s: podOwner = %+v, want %+v", tt.name, owner, tt.expect)
+		}
+	}
+}
+
+func TestStatusReportsPodDetails(t *testing.T) {
+	pod := testPod("web", "frontend-7d4b9c-x2x7q", corev1.PodRunning, map[string]string{"pod-template-hash": "7d4b9c"})
+	isController := true
+	pod.OwnerReferences = []metav1.OwnerReference{{Kind: "ReplicaSet", Name: "frontend-7d4b9c", Controller: &isController}}
+	pod.CreationTimestamp = metav1.NewTime(testNow.Add(-90 * time.Minute))
+	pod.Spec.NodeName = "node-1"
+	pod.Status.PodIP = "10.0.0.7"
+	pod.Status.Conditions = []corev1.PodCondition{readyCondition(corev1.ConditionFalse)}
+	pod.Status.ContainerStatuses = []corev1.ContainerStatus{waitingContainer("app", "CrashLoopBackOff")}
+	pod.Status.ContainerStatuses[0].RestartCount = 5
+	pod.Status.ContainerStatuses[0].LastTerminationState.Terminated = &corev1.ContainerStateTerminated{
+		Reason: "Error", ExitCode: 1, FinishedAt: metav1.NewTime(testNow.Add(-time.Hour)),
+	}
+	srv := startTestServer(t, fake.NewSimpleClientset(pod))
+	srv.now = func() time.Time { return testNow }
+
+	recorder := get(t, srv.routes(), "/status")
+
+	var statuses []map[string]any
+	if err := json.Unmarshal(recorder.Body.Bytes(), &statuses); err != nil || len(statuses) != 1 {
+		t.Fatalf("GET /status = %s, %v", recorder.Body, err)
+	}
+	want := map[string]any{
+		"cluster":    "test",
+		"namespace":  "web",
+		"name":       "frontend-7d4b9c-x2x7q",
+		"status":     "Running",
+		"node":       "node-1",
+		"podIP":      "10.0.0.7",
+		"ready":      false,
+		"conditions": []any{map[string]any{"type": "Ready", "status": "False"}},
+		"containers": []any{map[string]any{
+			"name":     "app",
+			"ready":    false,
+			"state":    "waiting",
+			"reason":   "CrashLoopBackOff",
+			"restarts": float64(5),
+			"lastTermination": map[string]any{
+				"reason":     "Error",
+				"exitCode":   float64(1),
+				"finishedAt": "2024-09-26T11:00:00Z",
+			},
+		}},
+		"owner":     map[string]any{"kind": "Deployment", "name": "frontend"},
+		"createdAt": "2024-09-26T10:30:00Z",
+		"age":       "90m",
+		"health":    "failing",
+		"reasons":   []any{"container app is waiting: CrashLoopBackOff", "pod is not ready"},
+	}
+	if !reflect.DeepEqual(statuses[0], want) {
+		got, _ := json.MarshalIndent(statuses[0], "", "  ")
+		t.Errorf("GET /status = %s", got)
+	}
+}
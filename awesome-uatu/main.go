@@ -1,82 +1,225 @@
-package awesome_uatu
+package main
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
-	"path/filepath"
-
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/clientcmd"
-	"k8s.io/client-go/util/homedir"
+	"os"
+	"os/signal"
+	"slices"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
 )
 
+// shutdownTimeout is how long requests may take to finish once the server
+// is asked to stop.
+const shutdownTimeout = 10 * time.Second
+
 func main() {
-	http.HandleFunc("/status", handleStatus)
-	log.Fatal(http.ListenAndServe(":8081", nil))
-}
+	addr := flag.String("listen", ":8081", "Address to serve the HTTP API on")
+	resync := flag.Duration("resync", 10*time.Minute, "How often the caches are resynced, 0 disables resyncs")
+	kubeconfig := flag.String("kubeconfig", "", "Kubeconfig file, the one kubectl uses by default")
+	contexts := flag.String("context", "", "Comma separated kubeconfig contexts to watch, the current context by default")
+	allContexts := flag.Bool("all-contexts", false, "Watch every context of the kubeconfig")
+	clustersFile := flag.String("clusters", "", "YAML file listing the clusters to watch, instead of kubeconfig contexts")
+	maxLogBytes := flag.Int64("max-log-bytes", defaultMaxLogBytes, "Most bytes of a container log returned by a request")
+	tlsCert := flag.String("tls-cert", "", "Certificate file to serve HTTPS with")
+	tlsKey := flag.String("tls-key", "", "Private key file of -tls-cert")
+	clientCA := flag.String("client-ca", "", "CA file to authenticate client certificates with, requires -tls-cert")
+	tokenFile := flag.String("token-file", "", "CSV file of bearer tokens to authenticate clients with, in the API server's token file format")
+	tokenReview := flag.String("token-review", "", "Cluster whose API server authenticates bearer tokens, such as service account tokens")
+	rulesFile := flag.String("authorization-rules", "", "YAML file of the namespaces each user or group may see, every namespace when not set")
+	flag.Parse()
 
-func getClientset() (*kubernetes.Clientset, error) {
-	var config *rest.Config
-	var err error
-	if home := homedir.HomeDir(); home != "" {
-		kubeconfig := filepath.Join(home, ".kube", "config")
-		config, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if (*tlsCert == "") != (*tlsKey == "") {
+		log.Fatal("-tls-cert and -tls-key must be set together")
+	}
+	if *clientCA != "" && *tlsCert == "" {
+		log.Fatal("-client-ca requires -tls-cert")
+	}
+
+	configs, err := getClusters(*clustersFile, *kubeconfig, *contexts, *allContexts)
+	if err != nil {
+		log.Fatalf("Failed to get clusters: %v", err)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	srv := newServer(*resync)
+	srv.maxLogBytes = *maxLogBytes
+	for _, config := range configs {
+		clientset, err := config.clientset()
 		if err != nil {
-			return nil, err
+			log.Fatalf("Failed to get Kubernetes clientset: %v", err)
 		}
-	} else {
-		config, err = rest.InClusterConfig()
+		srv.addCluster(config.Name, clientset)
+	}
+	srv.authenticators, err = getAuthenticators(srv, *clientCA, *tokenFile, *tokenReview)
+	if err != nil {
+		log.Fatalf("Failed to set up authentication: %v", err)
+	}
+	if *rulesFile != "" {
+		if len(srv.authenticators) == 0 {
+			log.Fatal("-authorization-rules requires -client-ca, -token-file or -token-review")
+		}
+		srv.authorization, err = loadAuthorizationRules(*rulesFile)
+		if err != nil {
+			log.Fatalf("Failed to load authorization rules: %v", err)
+		}
+	}
+	srv.start(ctx)
+
+	httpServer := &http.Server{Addr: *addr, Handler: srv.routes()}
+	listen := httpServer.ListenAndServe
+	if *tlsCert != "" {
+		if *clientCA != "" {
+			pem, err := os.ReadFile(*clientCA)
+			if err != nil {
+				log.Fatalf("Failed to read client CA: %v", err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				log.Fatalf("Client CA file %s has no certificates", *clientCA)
+			}
+			// Clients without certificates may still send bearer tokens
+			httpServer.TLSConfig = &tls.Config{ClientCAs: pool, ClientAuth: tls.VerifyClientCertIfGiven}
+		}
+		listen = func() error { return httpServer.ListenAndServeTLS(*tlsCert, *tlsKey) }
+	}
+	if err := serve(ctx, httpServer, listen); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// serve runs httpServer with listen until ctx is done, then shuts it down,
+// giving the requests in progress shutdownTimeout to finish. Streams end
+// right away, as their request contexts are done with ctx.
+func serve(ctx context.Context, httpServer *http.Server, listen func() error) error {
+	httpServer.BaseContext = func(net.Listener) context.Context { return ctx }
+	errs := make(chan error, 1)
+	go func() { errs <- listen() }()
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+	log.Print("Shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("failed to shut down: %w", err)
+	}
+	if err := <-errs; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// getAuthenticators returns the authenticators selected by the flags,
+// client certificates first as they are checked by the TLS handshake
+// already, then static tokens, which don't need a call to an API server.
+func getAuthenticators(srv *server, clientCA, tokenFile, tokenReview string) ([]authenticator, error) {
+	var authenticators []authenticator
+	if clientCA != "" {
+		authenticators = append(authenticators, certAuthenticator{})
+	}
+	if tokenFile != "" {
+		tokens, err := loadTokenFile(tokenFile)
 		if err != nil {
 			return nil, err
 		}
+		authenticators = append(authenticators, tokens)
 	}
-	clientset, err := kubernetes.NewForConfig(config)
-	if err != nil {
-		return nil, err
+	if tokenReview != "" {
+		i := slices.IndexFunc(srv.clusters, func(c *cluster) bool { return c.name == tokenReview })
+		if i < 0 {
+			return nil, fmt.Errorf("unknown -token-review cluster %q, use one of %s", tokenReview, strings.Join(srv.clusterNames(), ", "))
+		}
+		authenticators = append(authenticators, newTokenReviewAuthenticator(srv.clusters[i]))
 	}
-	return clientset, nil
+	return authenticators, nil
 }
 
-func getPods(clientset *kubernetes.Clientset) ([]PodStatus, error) {
-	pods, err := clientset.CoreV1().Pods("").List(context.TODO(), metav1.ListOptions{})
-	if err != nil {
-		return nil, err
+// getClusters returns the clusters listed in clustersFile or else the
+// kubeconfig contexts selected by the flags.
+func getClusters(clustersFile, kubeconfig, contexts string, allContexts bool) ([]clusterConfig, error) {
+	if clustersFile != "" {
+		if kubeconfig != "" || contexts != "" || allContexts {
+			return nil, errors.New("-clusters can't be combined with -kubeconfig, -context or -all-contexts")
+		}
+		return loadClusters(clustersFile)
+	}
+	var names []string
+	if contexts != "" {
+		names = strings.Split(contexts, ",")
 	}
-	var statuses []PodStatus
-	for _, pod := range pods.Items {
-		statuses = append(statuses, PodStatus{
-			Name:   pod.Name,
-			Status: string(pod.Status.Phase),
-		})
+	return kubeconfigClusters(kubeconfig, names, allContexts)
+}
+
+// getPods returns the status as of now of the pods in c selected by
+// filter, sorted by namespace and name.
+func getPods(c *cluster, filter podFilter, now time.Time) ([]PodStatus, error) {
+	statuses := []PodStatus{}
+	for _, namespace := range filter.namespaces() {
+		pods, err := c.pods.Pods(namespace).List(filter.LabelSelector)
+		if err != nil {
+			return nil, err
+		}
+		for _, pod := range pods {
+			if !filter.matches(pod) {
+				continue
+			}
+			status := podStatus(pod, now)
+			status.Cluster = c.name
+			statuses = append(statuses, status)
+		}
 	}
+	sort.Slice(statuses, func(i, j int) bool {
+		if statuses[i].Namespace != statuses[j].Namespace {
+			return statuses[i].Namespace < statuses[j].Namespace
+		}
+		return statuses[i].Name < statuses[j].Name
+	})
 	return statuses, nil
 }
 
-func handleStatus(w http.ResponseWriter, r *http.Request) {
-	clientset, err := getClientset()
+func (s *server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	filter, err := parsePodFilter(r.URL.Query())
 	if err != nil {
-		http.Error(w, "Failed to get Kubernetes clientset: "+err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	statuses, err := getPods(clientset)
+	clusters, err := s.parseClusters(r.URL.Query())
 	if err != nil {
-		http.Error(w, "Failed to get pods: "+err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	resp, err := json.Marshal(statuses)
-	if err != nil {
-		http.Error(w, "Failed to marshal pod statuses: "+err.Error(), http.StatusInternalServerError)
+	var ok bool
+	if filter.Access, ok = authorizeNamespaces(w, r, filter.Namespaces...); !ok {
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(resp)
-}
-
-type PodStatus struct {
-	Name   string `json:"name"`
-	Status string `json:"status"`
+	clusters = availableClusters(w, clusters, func(c *cluster) bool { return c.podsSynced() })
+	if len(clusters) == 0 {
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "Pod cache is not synced yet", http.StatusServiceUnavailable)
+		return
+	}
+	statuses := []PodStatus{}
+	for _, c := range clusters {
+		pods, err := getPods(c, filter, s.now())
+		if err != nil {
+			http.Error(w, "Failed to get pods: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		statuses = append(statuses, pods...)
+	}
+	writeJSON(w, statuses)
 }
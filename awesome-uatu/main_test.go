@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+)
+
+func testPod(namespace, name string, phase corev1.PodPhase, labels map[string]string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, Labels: labels},
+		Status:     corev1.PodStatus{Phase: phase},
+	}
+}
+
+// newTestServer returns a server caching the objects of clientset as the
+// cluster called test.
+func newTestServer(clientset *fake.Clientset) *server {
+	srv := newServer(0)
+	srv.addCluster("test", clientset)
+	return srv
+}
+
+// startTestServer returns newTestServer(clientset) started by startServer.
+func startTestServer(t *testing.T, clientset *fake.Clientset) *server {
+	t.Helper()
+	return startServer(t, newTestServer(clientset))
+}
+
+// startServer starts srv, waits until all its clusters are synced and stops
+// it when the test ends.
+func startServer(t *testing.T, srv *server) *server {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	srv.start(ctx)
+	for _, c := range srv.clusters {
+		if !cache.WaitForCacheSync(ctx.Done(), c.hasSynced) {
+			t.Fatalf("caches of cluster %s did not sync", c.name)
+		}
+	}
+	return srv
+}
+
+func get(t *testing.T, handler http.Handler, target string) *httptest.ResponseRecorder {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, target, nil))
+	return recorder
+}
+
+func getStatusNames(t *testing.T, handler http.Handler, query string) []string {
+	t.Helper()
+	recorder := get(t, handler, "/status?"+query)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("GET /status?%s = %d: %s", query, recorder.Code, recorder.Body)
+	}
+	var statuses []PodStatus
+	if err := json.Unmarshal(recorder.Body.Bytes(), &statuses); err != nil {
+		t.Fatalf("GET /status?%s returned invalid json: %v", query, err)
+	}
+	names := []string{}
+	for _, status := range statuses {
+		names = append(names, status.Name)
+	}
+	return names
+}
+
+func TestStatusFilters(t *testing.T) {
+	routes := startTestServer(t, fake.NewSimpleClientset(
+		testPod("web", "frontend", corev1.PodRunning, map[string]string{"app": "frontend"}),
+		testPod("web", "migrate", corev1.PodSucceeded, map[string]string{"app": "migrate"}),
+		testPod("db", "postgres", corev1.PodPending, map[string]string{"app": "postgres"}),
+		testPod("kube-system", "coredns", corev1.PodFailed, nil),
+	)).routes()
+
+	for _, tt := range []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"postgres", "coredns", "frontend", "migrate"}},
+		{"namespace=web", []string{"frontend", "migrate"}},
+		{"namespace=web&namespace=db", []string{"postgres", "frontend", "migrate"}},
+		{"labelSelector=app+in+(frontend,postgres)", []string{"postgres", "frontend"}},
+		{"fieldSelector=metadata.namespace!%3Dkube-system,status.phase!%3DRunning", []string{"postgres", "migrate"}},
+		{"phase=Pending&phase=Failed", []string{"postgres", "coredns"}},
+		{"namespace=staging", []string{}},
+	} {
+		if names := getStatusNames(t, routes, tt.query); !reflect.DeepEqual(names, tt.want) {
+			t.Errorf("GET /status?%s = %q, want %q", tt.query, names, tt.want)
+		}
+	}
+}
+
+func TestStatusIsServedFromCache(t *testing.T) {
+	clientset := fake.NewSimpleClientset(testPod("web", "frontend", corev1.PodRunning, nil))
+	lists := 0
+	clientset.PrependReactor("list", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		lists++
+		return false, nil, nil
+	})
+	srv := startTestServer(t, clientset)
+	routes := srv.routes()
+
+	for i := 0; i < 5; i++ {
+		getStatusNames(t, routes, "namespace=web")
+	}
+	if lists != 1 {
+		t.Errorf("pods were listed %d times, want once by the informer", lists)
+	}
+
+	pod := testPod("web", "backend", corev1.PodPending, nil)
+	if _, err := clientset.CoreV1().Pods("web").Create(context.Background(), pod, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for names := getStatusNames(t, routes, ""); !reflect.DeepEqual(names, []string{"backend", "frontend"}); names = getStatusNames(t, routes, "") {
+		if time.Now().After(deadline) {
+			t.Fatalf("GET /status = %q after the pod was created, want the watch to add it", names)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestNotReadyUntilCacheSynced(t *testing.T) {
+	srv := newTestServer(fake.NewSimpleClientset())
+	routes := srv.routes()
+
+	for _, target := range []string{"/status", "/workloads", "/readyz"} {
+		if code := get(t, routes, target).Code; code != http.StatusServiceUnavailable {
+			t.Errorf("GET %s before sync = %d, want %d", target, code, http.StatusServiceUnavailable)
+		}
+	}
+	if code := get(t, routes, "/healthz").Code; code != http.StatusOK {
+		t.Errorf("GET /healthz before sync = %d, want %d", code, http.StatusOK)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	srv.start(ctx)
+	cache.WaitForCacheSync(ctx.Done(), srv.clusters[0].hasSynced)
+	for _, target := range []string{"/status", "/workloads", "/readyz"} {
+		if code := get(t, routes, target).Code; code != http.StatusOK {
+			t.Errorf("GET %s after sync = %d, want %d", target, code, http.StatusOK)
+		}
+	}
+}
+
+func TestStatusRejectsMalformedQueries(t *testing.T) {
+	routes := newTestServer(fake.NewSimpleClientset()).routes()
+	for _, query := range []string{
+		"namespace=-web",
+		"labelSelector=app%3D%3D%3Dweb",
+		"fieldSelector=spec.nodeName",
+		"fieldSelector=spec.priority%3D1",
+		"phase=Crashing",
+	} {
+		recorder := get(t, routes, "/status?"+query)
+		if recorder.Code != http.StatusBadRequest {
+			t.Errorf("GET /status?%s = %d, want %d", query, recorder.Code, http.StatusBadRequest)
+		}
+		if !strings.HasPrefix(recorder.Body.String(), "invalid ") {
+			t.Errorf("GET /status?%s body = %q, want the validation error", query, recorder.Body.String())
+		}
+	}
+}
+
+func TestServeShutsDownWhenContextIsDone(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	httpServer := &http.Server{Handler: startTestServer(t, fake.NewSimpleClientset()).routes()}
+	served := make(chan error, 1)
+	go func() {
+		served <- serve(ctx, httpServer, func() error { return httpServer.Serve(listener) })
+	}()
+
+	// An open stream must not hold up the shutdown
+	client := connectSSE(t, "http://"+listener.Addr().String()+"/status/stream", "")
+	client.next()
+	cancel()
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("serve = %v, want a clean shutdown", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("serve didn't return after the context was done")
+	}
+	if _, err := http.Get("http://" + listener.Addr().String() + "/healthz"); err == nil {
+		t.Error("server still answers after the shutdown")
+	}
+}
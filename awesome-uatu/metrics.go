@@ -0,0 +1,163 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// metricsNamespace prefixes the names of the metrics awesome-uatu exports.
+const metricsNamespace = "uatu"
+
+// Metrics describing the cached cluster state, computed from the caches on
+// every scrape.
+var (
+	clusterSyncedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "", "cluster_synced"),
+		"Whether the objects of the cluster are cached.",
+		[]string{"cluster"}, nil)
+	podsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "", "pods"),
+		"Number of pods by namespace, phase and health.",
+		[]string{"cluster", "namespace", "phase", "health"}, nil)
+	containerRestartsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "", "container_restarts_total"),
+		"Number of times a container of a pod restarted.",
+		[]string{"cluster", "namespace", "pod", "container"}, nil)
+	workloadReplicasDesiredDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "", "workload_replicas_desired"),
+		"Number of pods a Deployment, StatefulSet or DaemonSet wants.",
+		[]string{"cluster", "kind", "namespace", "name"}, nil)
+	workloadReplicasReadyDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "", "workload_replicas_ready"),
+		"Number of ready pods of a Deployment, StatefulSet or DaemonSet.",
+		[]string{"cluster", "kind", "namespace", "name"}, nil)
+	workloadHealthDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "", "workload_health"),
+		"Health of a workload, 1 for its current health and 0 for the others.",
+		[]string{"cluster", "kind", "namespace", "name", "health"}, nil)
+)
+
+var healths = []Health{Healthy, Degraded, Failing}
+
+// metrics holds the metrics awesome-uatu exports about itself, and the
+// registry serving them along with the cluster state.
+type metrics struct {
+	registry        *prometheus.Registry
+	requestDuration *prometheus.HistogramVec
+	apiErrors       *prometheus.CounterVec
+}
+
+func newMetrics() *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Latency of the HTTP requests served, by route.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"handler", "method", "code"}),
+		apiErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "kubernetes_api_errors_total",
+			Help:      "Number of failed list and watch calls to the Kubernetes API, by resource.",
+		}, []string{"cluster", "resource"}),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requestDuration,
+		m.apiErrors,
+	)
+	return m
+}
+
+// instrument records the latency of the requests h serves under the route
+// pattern.
+func (m *metrics) instrument(pattern string, h http.HandlerFunc) http.Handler {
+	return promhttp.InstrumentHandlerDuration(m.requestDuration.MustCurryWith(prometheus.Labels{"handler": pattern}), h)
+}
+
+// clusterCollector reports the state of the clusters of a server.
+type clusterCollector struct {
+	s *server
+}
+
+func (c clusterCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{
+		clusterSyncedDesc,
+		podsDesc,
+		containerRestartsDesc,
+		workloadReplicasDesiredDesc,
+		workloadReplicasReadyDesc,
+		workloadHealthDesc,
+	} {
+		ch <- desc
+	}
+}
+
+// Collect reports the state of each cluster from its caches. Clusters that
+// aren't synced only report so, rather than partial counts.
+func (c clusterCollector) Collect(ch chan<- prometheus.Metric) {
+	now := c.s.now()
+	for _, cl := range c.s.clusters {
+		synced := cl.hasSynced()
+		ch <- prometheus.MustNewConstMetric(clusterSyncedDesc, prometheus.GaugeValue, boolValue(synced), cl.name)
+		if !synced {
+			continue
+		}
+
+		pods, err := cl.pods.List(labels.Everything())
+		if err != nil {
+			ch <- prometheus.NewInvalidMetric(podsDesc, err)
+			continue
+		}
+		type podKey struct {
+			namespace, phase string
+			health           Health
+		}
+		counts := map[podKey]int{}
+		for _, pod := range pods {
+			health, _ := podHealth(pod, now)
+			counts[podKey{pod.Namespace, string(pod.Status.Phase), health}]++
+			containers := append(append([]corev1.ContainerStatus(nil), pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+			for _, container := range containers {
+				ch <- prometheus.MustNewConstMetric(containerRestartsDesc, prometheus.CounterValue,
+					float64(container.RestartCount), cl.name, pod.Namespace, pod.Name, container.Name)
+			}
+		}
+		for key, count := range counts {
+			ch <- prometheus.MustNewConstMetric(podsDesc, prometheus.GaugeValue, float64(count), cl.name, key.namespace, key.phase, string(key.health))
+		}
+
+		for _, kind := range workloadKinds {
+			statuses, err := cl.listWorkloads(kind, metav1.NamespaceAll, labels.Everything())
+			if err != nil {
+				ch <- prometheus.NewInvalidMetric(workloadHealthDesc, err)
+				continue
+			}
+			for _, status := range statuses {
+				labelValues := []string{cl.name, status.Kind, status.Namespace, status.Name}
+				if status.Replicas != nil {
+					ch <- prometheus.MustNewConstMetric(workloadReplicasDesiredDesc, prometheus.GaugeValue, float64(status.Replicas.Desired), labelValues...)
+					ch <- prometheus.MustNewConstMetric(workloadReplicasReadyDesc, prometheus.GaugeValue, float64(status.Replicas.Ready), labelValues...)
+				}
+				for _, health := range healths {
+					ch <- prometheus.MustNewConstMetric(workloadHealthDesc, prometheus.GaugeValue, boolValue(status.Health == health), append(labelValues, string(health))...)
+				}
+			}
+		}
+	}
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// scrape returns the lines of the /metrics response of srv.
+func scrape(t *testing.T, srv *server) map[string]bool {
+	t.Helper()
+	lines := map[string]bool{}
+	for _, line := range strings.Split(get(t, srv.routes(), "/metrics").Body.String(), "\n") {
+		lines[line] = true
+	}
+	return lines
+}
+
+func TestMetrics(t *testing.T) {
+	crasher := testPod("web", "crasher", corev1.PodRunning, nil)
+	crasher.Status.Conditions = []corev1.PodCondition{readyCondition(corev1.ConditionFalse)}
+	crasher.Status.ContainerStatuses = []corev1.ContainerStatus{waitingContainer("app", "CrashLoopBackOff")}
+	crasher.Status.ContainerStatuses[0].RestartCount = 3
+	frontend := testPod("web", "frontend", corev1.PodRunning, nil)
+	frontend.Status.Conditions = []corev1.PodCondition{readyCondition(corev1.ConditionTrue)}
+	frontend.Status.ContainerStatuses = []corev1.ContainerStatus{runningContainer("app", true)}
+	srv := startTestServer(t, fake.NewSimpleClientset(
+		crasher,
+		frontend,
+		testPod("db", "postgres", corev1.PodPending, nil),
+		testDeployment("frontend", 2, appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 2, UpdatedReplicas: 2, ReadyReplicas: 1, AvailableReplicas: 1}),
+	))
+	srv.now = func() time.Time { return testNow }
+	get(t, srv.routes(), "/status")
+
+	lines := scrape(t, srv)
+	for _, want := range []string{
+		`uatu_cluster_synced{cluster="test"} 1`,
+		`uatu_pods{cluster="test",health="healthy",namespace="web",phase="Running"} 1`,
+		`uatu_pods{cluster="test",health="failing",namespace="web",phase="Running"} 1`,
+		`uatu_pods{cluster="test",health="degraded",namespace="db",phase="Pending"} 1`,
+		`uatu_container_restarts_total{cluster="test",container="app",namespace="web",pod="crasher"} 3`,
+		`uatu_workload_replicas_desired{cluster="test",kind="Deployment",name="frontend",namespace="web"} 2`,
+		`uatu_workload_replicas_ready{cluster="test",kind="Deployment",name="frontend",namespace="web"} 1`,
+		`uatu_workload_health{cluster="test",health="degraded",kind="Deployment",name="frontend",namespace="web"} 1`,
+		`uatu_workload_health{cluster="test",health="healthy",kind="Deployment",name="frontend",namespace="web"} 0`,
+		`uatu_http_request_duration_seconds_count{code="200",handler="/status",method="get"} 1`,
+	} {
+		if !lines[want] {
+			t.Errorf("/metrics lacks %s", want)
+		}
+	}
+}
+
+func TestMetricsCountAPIErrors(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("list", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("connection refused")
+	})
+	srv := newTestServer(clientset)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	srv.start(ctx)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !scrape(t, srv)[`uatu_kubernetes_api_errors_total{cluster="test",resource="pods"} 1`] {
+		if time.Now().After(deadline) {
+			t.Fatal("/metrics did not count the failed pod list")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if lines := scrape(t, srv); !lines[`uatu_cluster_synced{cluster="test"} 0`] {
+		t.Error("/metrics reports the failing cluster synced")
+	}
+}
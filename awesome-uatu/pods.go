@@ -0,0 +1,331 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+)
+
+// defaultMaxLogBytes is how much of a container's log a single request
+// returns at most, when the server isn't given a limit.
+const defaultMaxLogBytes = 10 << 20
+
+// defaultContainerAnnotation names the container kubectl reads logs from
+// when none is given.
+const defaultContainerAnnotation = "kubectl.kubernetes.io/default-container"
+
+// Event is a Kubernetes event about a pod, as kubectl describe shows it.
+type Event struct {
+	// Type is Normal or Warning.
+	Type    string `json:"type"`
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+	// Container is set for events about one of the pod's containers.
+	Container string `json:"container,omitempty"`
+	// Count is how many times the event occurred between FirstSeen and
+	// LastSeen.
+	Count     int32     `json:"count"`
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+	// Source is the component that reported the event, and its host.
+	Source string `json:"source,omitempty"`
+}
+
+// findPod returns the cached pod named by the request path along with its
+// cluster. Without the cluster query parameter the pod is looked up in
+// every cluster, and must only exist in one. It writes the error response
+// and returns false if the pod can't be found.
+func (s *server) findPod(w http.ResponseWriter, r *http.Request) (*cluster, *corev1.Pod, bool) {
+	clusters, err := s.parseClusters(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, nil, false
+	}
+	if _, ok := authorizeNamespaces(w, r, r.PathValue("namespace")); !ok {
+		return nil, nil, false
+	}
+	clusters = availableClusters(w, clusters, func(c *cluster) bool { return c.podsSynced() })
+	if len(clusters) == 0 {
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "Pod cache is not synced yet", http.StatusServiceUnavailable)
+		return nil, nil, false
+	}
+	namespace, name := r.PathValue("namespace"), r.PathValue("name")
+	var found []*cluster
+	var pod *corev1.Pod
+	for _, c := range clusters {
+		cached, err := c.pods.Pods(namespace).Get(name)
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			http.Error(w, "Failed to get pod: "+err.Error(), http.StatusInternalServerError)
+			return nil, nil, false
+		}
+		found, pod = append(found, c), cached
+	}
+	switch len(found) {
+	case 0:
+		http.Error(w, fmt.Sprintf("Pod %s/%s not found", namespace, name), http.StatusNotFound)
+		return nil, nil, false
+	case 1:
+		return found[0], pod, true
+	default:
+		var names []string
+		for _, c := range found {
+			names = append(names, c.name)
+		}
+		http.Error(w, fmt.Sprintf("Pod %s/%s exists in clusters %s, use cluster to pick one",
+			namespace, name, strings.Join(names, ", ")), http.StatusConflict)
+		return nil, nil, false
+	}
+}
+
+// handlePodEvents reports the events about a pod, oldest first. Events are
+// read from the API server, as the caches don't hold them.
+func (s *server) handlePodEvents(w http.ResponseWriter, r *http.Request) {
+	c, pod, ok := s.findPod(w, r)
+	if !ok {
+		return
+	}
+	events, err := c.podEvents(r.Context(), pod)
+	if err != nil {
+		http.Error(w, "Failed to get events: "+err.Error(), apiErrorCode(err))
+		return
+	}
+	writeJSON(w, events)
+}
+
+// podEvents lists the events about pod, skipping those about earlier pods of
+// the same name.
+func (c *cluster) podEvents(ctx context.Context, pod *corev1.Pod) ([]Event, error) {
+	selector := fields.Set{
+		"involvedObject.kind": "Pod",
+		"involvedObject.name": pod.Name,
+	}.AsSelector()
+	list, err := c.clientset.CoreV1().Events(pod.Namespace).List(ctx, metav1.ListOptions{FieldSelector: selector.String()})
+	if err != nil {
+		c.apiErrors.WithLabelValues("events").Inc()
+		return nil, err
+	}
+	events := []Event{}
+	for _, event := range list.Items {
+		involved := event.InvolvedObject
+		if involved.Kind != "Pod" || involved.Name != pod.Name || (involved.UID != "" && involved.UID != pod.UID) {
+			continue
+		}
+		events = append(events, describeEvent(event))
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].LastSeen.Before(events[j].LastSeen)
+	})
+	return events, nil
+}
+
+// describeEvent describes event. Events recorded through the events.k8s.io
+// API only set an event time, older ones only first and last timestamps.
+func describeEvent(event corev1.Event) Event {
+	first, last := event.FirstTimestamp.Time, event.LastTimestamp.Time
+	if first.IsZero() {
+		first = event.EventTime.Time
+	}
+	if series := event.Series; series != nil && !series.LastObservedTime.IsZero() {
+		last = series.LastObservedTime.Time
+	}
+	if last.IsZero() {
+		last = first
+	}
+	if first.IsZero() {
+		first, last = event.CreationTimestamp.Time, event.CreationTimestamp.Time
+	}
+	count := event.Count
+	if series := event.Series; series != nil && series.Count > count {
+		count = series.Count
+	}
+	if count == 0 {
+		count = 1
+	}
+	source := event.Source.Component
+	if source == "" {
+		source = event.ReportingController
+	}
+	if host := event.Source.Host; host != "" {
+		source += ", " + host
+	}
+	return Event{
+		Type:      event.Type,
+		Reason:    event.Reason,
+		Message:   event.Message,
+		Container: fieldPathContainer(event.InvolvedObject.FieldPath),
+		Count:     count,
+		FirstSeen: first,
+		LastSeen:  last,
+		Source:    source,
+	}
+}
+
+// fieldPathContainer returns the container an event field path such as
+// spec.containers{app} refers to.
+func fieldPathContainer(fieldPath string) string {
+	for _, prefix := range []string{"spec.containers{", "spec.initContainers{", "spec.ephemeralContainers{"} {
+		if name, ok := strings.CutPrefix(fieldPath, prefix); ok {
+			return strings.TrimSuffix(name, "}")
+		}
+	}
+	return ""
+}
+
+// parseLogOptions reads the log options of a request for the logs of pod
+// from the container, tailLines, sinceSeconds, previous, follow and
+// limitBytes query parameters. Reads are limited to maxBytes.
+func parseLogOptions(query url.Values, pod *corev1.Pod, maxBytes int64) (*corev1.PodLogOptions, error) {
+	options := &corev1.PodLogOptions{Container: query.Get("container"), LimitBytes: &maxBytes}
+	if options.Container == "" {
+		options.Container = defaultContainer(pod)
+	} else if !hasContainer(pod, options.Container) {
+		return nil, fmt.Errorf("invalid container %q, pod %s has no such container", options.Container, pod.Name)
+	}
+	if query.Has("tailLines") {
+		tailLines, err := strconv.ParseInt(query.Get("tailLines"), 10, 64)
+		if err != nil || tailLines < 0 {
+			return nil, fmt.Errorf("invalid tailLines %q, use a number of lines", query.Get("tailLines"))
+		}
+		options.TailLines = &tailLines
+	}
+	if query.Has("sinceSeconds") {
+		sinceSeconds, err := strconv.ParseInt(query.Get("sinceSeconds"), 10, 64)
+		if err != nil || sinceSeconds <= 0 {
+			return nil, fmt.Errorf("invalid sinceSeconds %q, use a positive number of seconds", query.Get("sinceSeconds"))
+		}
+		options.SinceSeconds = &sinceSeconds
+	}
+	if query.Has("limitBytes") {
+		limitBytes, err := strconv.ParseInt(query.Get("limitBytes"), 10, 64)
+		if err != nil || limitBytes <= 0 {
+			return nil, fmt.Errorf("invalid limitBytes %q, use a positive number of bytes", query.Get("limitBytes"))
+		}
+		if limitBytes < maxBytes {
+			options.LimitBytes = &limitBytes
+		}
+	}
+	for _, flag := range []struct {
+		name  string
+		value *bool
+	}{{"previous", &options.Previous}, {"follow", &options.Follow}} {
+		if query.Has(flag.name) {
+			parsed, err := strconv.ParseBool(query.Get(flag.name))
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s %q, use true or false", flag.name, query.Get(flag.name))
+			}
+			*flag.value = parsed
+		}
+	}
+	return options, nil
+}
+
+// defaultContainer returns the container kubectl logs reads from when none
+// is given.
+func defaultContainer(pod *corev1.Pod) string {
+	if name := pod.Annotations[defaultContainerAnnotation]; name != "" && hasContainer(pod, name) {
+		return name
+	}
+	if len(pod.Spec.Containers) > 0 {
+		return pod.Spec.Containers[0].Name
+	}
+	return ""
+}
+
+func hasContainer(pod *corev1.Pod, name string) bool {
+	for _, container := range pod.Spec.InitContainers {
+		if container.Name == name {
+			return true
+		}
+	}
+	for _, container := range pod.Spec.Containers {
+		if container.Name == name {
+			return true
+		}
+	}
+	for _, container := range pod.Spec.EphemeralContainers {
+		if container.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// handlePodLogs streams the log of a pod's container as plain text. The
+// response never exceeds the server's byte limit, even when following the
+// log, so a chatty container can't tie up the server.
+func (s *server) handlePodLogs(w http.ResponseWriter, r *http.Request) {
+	c, pod, ok := s.findPod(w, r)
+	if !ok {
+		return
+	}
+	maxBytes := s.maxLogBytes
+	if maxBytes == 0 {
+		maxBytes = defaultMaxLogBytes
+	}
+	options, err := parseLogOptions(r.URL.Query(), pod, maxBytes)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	stream, err := c.clientset.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, options).Stream(r.Context())
+	if err != nil {
+		c.apiErrors.WithLabelValues("pods/log").Inc()
+		http.Error(w, "Failed to get logs: "+err.Error(), apiErrorCode(err))
+		return
+	}
+	defer stream.Close()
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	// The API server enforces LimitBytes too, but only where it supports it
+	logs := io.LimitReader(stream, *options.LimitBytes)
+	flusher, ok := w.(http.Flusher)
+	if !options.Follow || !ok {
+		io.Copy(w, logs)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	buf := make([]byte, 32<<10)
+	for {
+		n, err := logs.Read(buf)
+		if n > 0 {
+			if _, err := w.Write(buf[:n]); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// apiErrorCode returns the status to answer with when a call to the
+// Kubernetes API failed with err.
+func apiErrorCode(err error) int {
+	switch {
+	case apierrors.IsNotFound(err):
+		return http.StatusNotFound
+	case apierrors.IsBadRequest(err):
+		// E.g. no previous container or the container isn't started yet
+		return http.StatusBadRequest
+	default:
+		return http.StatusBadGateway
+	}
+}
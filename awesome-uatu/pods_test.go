@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func testEvent(name string, involved corev1.ObjectReference, eventType, reason string, last time.Time) *corev1.Event {
+	return &corev1.Event{
+		ObjectMeta:     metav1.ObjectMeta{Namespace: "web", Name: name},
+		InvolvedObject: involved,
+		Type:           eventType,
+		Reason:         reason,
+		Count:          1,
+		FirstTimestamp: metav1.NewTime(last),
+		LastTimestamp:  metav1.NewTime(last),
+		Source:         corev1.EventSource{Component: "kubelet", Host: "node-1"},
+	}
+}
+
+func TestPodEvents(t *testing.T) {
+	pod := testPod("web", "frontend", corev1.PodRunning, nil)
+	pod.UID = "uid-2"
+	involved := corev1.ObjectReference{Kind: "Pod", Namespace: "web", Name: "frontend", UID: "uid-2"}
+	backOff := testEvent("frontend.backoff", involved, corev1.EventTypeWarning, "BackOff", testNow.Add(-time.Minute))
+	backOff.InvolvedObject.FieldPath = "spec.containers{app}"
+	backOff.Message = "Back-off restarting failed container app"
+	backOff.Count = 5
+	backOff.FirstTimestamp = metav1.NewTime(testNow.Add(-10 * time.Minute))
+	scheduled := &corev1.Event{
+		ObjectMeta:          metav1.ObjectMeta{Namespace: "web", Name: "frontend.scheduled"},
+		InvolvedObject:      involved,
+		Type:                corev1.EventTypeNormal,
+		Reason:              "Scheduled",
+		Message:             "Successfully assigned web/frontend to node-1",
+		EventTime:           metav1.NewMicroTime(testNow.Add(-time.Hour)),
+		ReportingController: "default-scheduler",
+	}
+	previousPod := involved
+	previousPod.UID = "uid-1"
+	otherPod := involved
+	otherPod.Name, otherPod.UID = "backend", "uid-3"
+	routes := startTestServer(t, fake.NewSimpleClientset(
+		pod,
+		backOff,
+		scheduled,
+		testEvent("frontend.killing", previousPod, corev1.EventTypeNormal, "Killing", testNow.Add(-2*time.Hour)),
+		testEvent("backend.pulled", otherPod, corev1.EventTypeNormal, "Pulled", testNow),
+	)).routes()
+
+	recorder := get(t, routes, "/pods/web/frontend/events")
+	var events []Event
+	if err := json.Unmarshal(recorder.Body.Bytes(), &events); err != nil {
+		t.Fatalf("GET /pods/web/frontend/events = %d %s", recorder.Code, recorder.Body)
+	}
+	want := []Event{
+		{
+			Type: "Normal", Reason: "Scheduled", Message: "Successfully assigned web/frontend to node-1", Count: 1,
+			FirstSeen: testNow.Add(-time.Hour), LastSeen: testNow.Add(-time.Hour), Source: "default-scheduler",
+		},
+		{
+			Type: "Warning", Reason: "BackOff", Message: "Back-off restarting failed container app", Container: "app", Count: 5,
+			FirstSeen: testNow.Add(-10 * time.Minute), LastSeen: testNow.Add(-time.Minute), Source: "kubelet, node-1",
+		},
+	}
+	for i := range events {
+		events[i].FirstSeen, events[i].LastSeen = events[i].FirstSeen.UTC(), events[i].LastSeen.UTC()
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("GET /pods/web/frontend/events = %+v, want %+v", events, want)
+	}
+
+	if code := get(t, routes, "/pods/web/backend/events").Code; code != http.StatusNotFound {
+		t.Errorf("GET /pods/web/backend/events = %d, want %d for a pod that isn't cached", code, http.StatusNotFound)
+	}
+}
+
+// logOptions returns the options of the last log request made to clientset.
+func logOptions(t *testing.T, clientset *fake.Clientset) *corev1.PodLogOptions {
+	t.Helper()
+	actions := clientset.Actions()
+	for i := len(actions) - 1; i >= 0; i-- {
+		if action, ok := actions[i].(k8stesting.GenericActionImpl); ok && action.GetSubresource() == "log" {
+			return action.Value.(*corev1.PodLogOptions)
+		}
+	}
+	t.Fatal("logs were not requested")
+	return nil
+}
+
+func TestPodLogs(t *testing.T) {
+	pod := testPod("web", "frontend", corev1.PodRunning, nil)
+	pod.Annotations = map[string]string{defaultContainerAnnotation: "app"}
+	pod.Spec.InitContainers = []corev1.Container{{Name: "migrate"}}
+	pod.Spec.Containers = []corev1.Container{{Name: "proxy"}, {Name: "app"}}
+	clientset := fake.NewSimpleClientset(pod)
+	srv := startTestServer(t, clientset)
+	srv.maxLogBytes = 6
+	routes := srv.routes()
+
+	int64p := func(n int64) *int64 { return &n }
+	for _, tt := range []struct {
+		query   string
+		body    string
+		options corev1.PodLogOptions
+	}{
+		{"", "fake l", corev1.PodLogOptions{Container: "app", LimitBytes: int64p(6)}},
+		{"container=migrate&tailLines=100&sinceSeconds=60&previous=true&limitBytes=4", "fake",
+			corev1.PodLogOptions{Container: "migrate", TailLines: int64p(100), SinceSeconds: int64p(60), Previous: true, LimitBytes: int64p(4)}},
+		{"container=proxy&follow=1&limitBytes=100", "fake l", corev1.PodLogOptions{Container: "proxy", Follow: true, LimitBytes: int64p(6)}},
+	} {
+		recorder := get(t, routes, "/pods/web/frontend/logs?"+tt.query)
+		if recorder.Code != http.StatusOK || recorder.Body.String() != tt.body || recorder.Header().Get("Content-Type") != "text/plain; charset=utf-8" {
+			t.Errorf("GET /pods/web/frontend/logs?%s = %d %q, want %q", tt.query, recorder.Code, recorder.Body, tt.body)
+		}
+		if options := logOptions(t, clientset); !reflect.DeepEqual(*options, tt.options) {
+			t.Errorf("GET /pods/web/frontend/logs?%s requested %+v, want %+v", tt.query, *options, tt.options)
+		}
+	}
+
+	for _, tt := range []struct {
+		target string
+		code   int
+	}{
+		{"/pods/web/frontend/logs?container=sidecar", http.StatusBadRequest},
+		{"/pods/web/frontend/logs?tailLines=-1", http.StatusBadRequest},
+		{"/pods/web/frontend/logs?sinceSeconds=0", http.StatusBadRequest},
+		{"/pods/web/frontend/logs?limitBytes=lots", http.StatusBadRequest},
+		{"/pods/web/frontend/logs?follow=maybe", http.StatusBadRequest},
+		{"/pods/web/frontend/logs?cluster=north", http.StatusBadRequest},
+		{"/pods/web/backend/logs", http.StatusNotFound},
+	} {
+		if code := get(t, routes, tt.target).Code; code != tt.code {
+			t.Errorf("GET %s = %d, want %d", tt.target, code, tt.code)
+		}
+	}
+}
+
+func TestDefaultContainer(t *testing.T) {
+	pod := &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "proxy"}, {Name: "app"}}}}
+	if name := defaultContainer(pod); name != "proxy" {
+		t.Errorf("defaultContainer = %q, want the first container", name)
+	}
+	pod.Annotations = map[string]string{defaultContainerAnnotation: "missing"}
+	if name := defaultContainer(pod); name != "proxy" {
+		t.Errorf("defaultContainer with an unknown annotated container = %q, want the first container", name)
+	}
+}
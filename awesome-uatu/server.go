@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"k8s.io/client-go/kubernetes"
+)
+
+// server answers HTTP requests from shared informer caches, one per
+// cluster, so requests never reach the API servers and take the same time
+// however often dashboards poll.
+type server struct {
+	clusters []*cluster
+	events   *podBroadcaster
+	metrics  *metrics
+	resync   time.Duration
+
+	// heartbeat is how often idle event streams send a comment,
+	// defaultHeartbeat when zero.
+	heartbeat time.Duration
+	// now returns the time pod ages and restarts are measured against.
+	now func() time.Time
+	// maxLogBytes is the most of a log a request returns,
+	// defaultMaxLogBytes when zero.
+	maxLogBytes int64
+
+	// authenticators are tried in order to identify clients. Anyone may
+	// use the API when there are none.
+	authenticators []authenticator
+	// authorization limits the namespaces clients see, every namespace
+	// when nil.
+	authorization *authorizationRules
+}
+
+// newServer returns a server without clusters, whose caches are resynced
+// every resync.
+func newServer(resync time.Duration) *server {
+	s := &server{events: newPodBroadcaster(), metrics: newMetrics(), resync: resync, now: time.Now}
+	s.metrics.registry.MustRegister(clusterCollector{s})
+	return s
+}
+
+// addCluster caches the pods and workloads of clientset as the cluster
+// called name. Nothing is cached until start is called.
+func (s *server) addCluster(name string, clientset kubernetes.Interface) {
+	apiErrors := s.metrics.apiErrors.MustCurryWith(prometheus.Labels{"cluster": name})
+	s.clusters = append(s.clusters, newCluster(name, clientset, s.resync, s.events, apiErrors))
+}
+
+// start fills the caches and keeps them up to date until ctx is done. The
+// server reports it is not ready until one of the clusters is cached.
+func (s *server) start(ctx context.Context) {
+	for _, c := range s.clusters {
+		c.informers.Start(ctx.Done())
+		go c.logSynced(ctx.Done())
+	}
+}
+
+func (s *server) routes() http.Handler {
+	mux := http.NewServeMux()
+	handle := func(pattern string, handler http.HandlerFunc) {
+		mux.Handle(pattern, s.metrics.instrument(pattern, handler))
+	}
+	handle("/status", s.authenticated(s.handleStatus))
+	// Streams last as long as the client stays, their latency means nothing
+	mux.HandleFunc("/status/stream", s.authenticated(s.handleStream))
+	handle("/workloads", s.authenticated(s.handleWorkloads))
+	handle("/workloads/{kind}/{namespace}/{name}", s.authenticated(s.handleWorkload))
+	handle("/pods/{namespace}/{name}/events", s.authenticated(s.handlePodEvents))
+	// Followed logs stream like /status/stream
+	mux.HandleFunc("/pods/{namespace}/{name}/logs", s.authenticated(s.handlePodLogs))
+	handle("/clusters", s.authenticated(s.handleClusters))
+	// Probes and the dashboard's assets reveal nothing about the clusters
+	handle("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok\n"))
+	})
+	handle("/readyz", s.handleReady)
+	// Metrics cover every namespace
+	handle("/metrics", s.authenticated(requireAllNamespaces(promhttp.HandlerFor(s.metrics.registry, promhttp.HandlerOpts{}).ServeHTTP)))
+	handle("/dashboard/", dashboardHandler().ServeHTTP)
+	// Signing in checks the token itself
+	handle("POST /login", s.handleLogin)
+	mux.Handle("/{$}", http.RedirectHandler("/dashboard/", http.StatusFound))
+	return mux
+}
+
+// handleReady fails until the caches of a cluster have synced, so the
+// server only gets traffic once it can answer it. A cluster that can't be
+// reached doesn't keep the others from being served.
+func (s *server) handleReady(w http.ResponseWriter, r *http.Request) {
+	if !slices.ContainsFunc(s.clusters, (*cluster).hasSynced) {
+		http.Error(w, "Caches are not synced yet", http.StatusServiceUnavailable)
+		return
+	}
+	w.Write([]byte("ok\n"))
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+// eventHistorySize is how many pod events are kept for clients resuming a
+// stream with Last-Event-ID. Clients that fall further behind get a new
+// snapshot instead.
+const eventHistorySize = 1000
+
+// subscriberBuffer is how many events a stream client may lag behind before
+// it is disconnected, so a slow client can't hold up the others.
+const subscriberBuffer = 256
+
+// defaultHeartbeat is how often an idle event stream sends a comment, so
+// proxies don't close it.
+const defaultHeartbeat = 15 * time.Second
+
+// podEvent is a change to a pod seen by the informer of a cluster. Old is
+// the pod before a modification or the deleted pod, New the added or
+// modified pod. ID is the cluster and resource version of the change, so
+// it is unique across clusters and server restarts. Deletions carry the
+// version of the last known pod, which the change before them already has,
+// so their IDs end in /deleted.
+type podEvent struct {
+	ID      string
+	Cluster string
+	Old     *corev1.Pod
+	New     *corev1.Pod
+}
+
+func newPodEvent(cluster string, old, new *corev1.Pod) podEvent {
+	id := cluster + "/"
+	if new != nil {
+		id += new.ResourceVersion
+	} else {
+		id += old.ResourceVersion + "/deleted"
+	}
+	return podEvent{ID: id, Cluster: cluster, Old: old, New: new}
+}
+
+// streamMessage is what the event stream sends: a snapshot of the pods
+// selected by the client, or a change to one of them. ID is the message's
+// event id that a reconnecting client resumes from, ResourceVersion the
+// version of the changed pod.
+type streamMessage struct {
+	Type            string      `json:"type"`
+	ID              string      `json:"id,omitempty"`
+	ResourceVersion string      `json:"resourceVersion,omitempty"`
+	Pod             *PodStatus  `json:"pod,omitempty"`
+	Pods            []PodStatus `json:"pods,omitempty"`
+}
+
+// Types of streamMessage besides the watch.EventType of changes.
+const snapshotMessage = "SNAPSHOT"
+
+// message returns the message a client watching clusters with filter is
+// sent for e, if any, describing the pod as of now.
+// Pods changing into or out of the filter are reported as added or deleted,
+// with their new state.
+func (e podEvent) message(clusters []*cluster, filter podFilter, now time.Time) (streamMessage, bool) {
+	if !slices.ContainsFunc(clusters, func(c *cluster) bool { return c.name == e.Cluster }) {
+		return streamMessage{}, false
+	}
+	oldMatches := e.Old != nil && filter.matches(e.Old)
+	newMatches := e.New != nil && filter.matches(e.New)
+	var eventType watch.EventType
+	switch {
+	case newMatches && oldMatches:
+		eventType = watch.Modified
+	case newMatches:
+		eventType = watch.Added
+	case oldMatches:
+		eventType = watch.Deleted
+	default:
+		return streamMessage{}, false
+	}
+	pod := e.New
+	if pod == nil {
+		pod = e.Old
+	}
+	status := podStatus(pod, now)
+	status.Cluster = e.Cluster
+	return streamMessage{Type: string(eventType), ID: e.ID, ResourceVersion: pod.ResourceVersion, Pod: &status}, true
+}
+
+// podBroadcaster fans the pod events of every cluster's informer out to
+// stream clients.
+type podBroadcaster struct {
+	mu          sync.Mutex
+	history     []podEvent
+	subscribers map[chan podEvent]struct{}
+}
+
+func newPodBroadcaster() *podBroadcaster {
+	return &podBroadcaster{subscribers: make(map[chan podEvent]struct{})}
+}
+
+// eventHandler returns the event handler publishing the changes seen by
+// the informer of cluster to b.
+func (b *podBroadcaster) eventHandler(cluster string) cache.ResourceEventHandler {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if pod, ok := obj.(*corev1.Pod); ok {
+				b.publish(newPodEvent(cluster, nil, pod))
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldPod, oldOK := oldObj.(*corev1.Pod)
+			newPod, newOK := newObj.(*corev1.Pod)
+			// Resyncs redeliver pods that did not change
+			if oldOK && newOK && oldPod.ResourceVersion != newPod.ResourceVersion {
+				b.publish(newPodEvent(cluster, oldPod, newPod))
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if pod, ok := obj.(*corev1.Pod); ok {
+				b.publish(newPodEvent(cluster, pod, nil))
+			}
+		},
+	}
+}
+
+func (b *podBroadcaster) publish(event podEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.history = append(b.history, event)
+	if len(b.history) > eventHistorySize {
+		b.history = b.history[len(b.history)-eventHistorySize:]
+	}
+	for events := range b.subscribers {
+		select {
+		case events <- event:
+		default:
+			// Too far behind, the client reconnects with Last-Event-ID
+			delete(b.subscribers, events)
+			close(events)
+		}
+	}
+}
+
+// subscribe returns a channel receiving every event published from now on,
+// closed when the subscriber falls too far behind. If lastEventID is one of
+// the recent events, the events after it are returned to be replayed and
+// resumed is true. Otherwise the subscriber needs a snapshot; latestID is
+// the id it continues from.
+func (b *podBroadcaster) subscribe(lastEventID string) (events chan podEvent, replay []podEvent, resumed bool, latestID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	events = make(chan podEvent, subscriberBuffer)
+	b.subscribers[events] = struct{}{}
+	if len(b.history) > 0 {
+		latestID = b.history[len(b.history)-1].ID
+	}
+	if lastEventID == "" {
+		return events, nil, false, latestID
+	}
+	for i := len(b.history) - 1; i >= 0; i-- {
+		if b.history[i].ID == lastEventID {
+			return events, append([]podEvent(nil), b.history[i+1:]...), true, latestID
+		}
+	}
+	return events, nil, false, latestID
+}
+
+func (b *podBroadcaster) unsubscribe(events chan podEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subscribers[events]; ok {
+		delete(b.subscribers, events)
+		close(events)
+	}
+}
+
+// handleStream streams changes to the pods selected by the /status query
+// parameters, as Server-Sent Events or, when the client asks to upgrade the
+// connection, WebSocket messages. Clients start with a snapshot unless they
+// resume from the id of the last event they saw, sent as the Last-Event-ID
+// header or the lastEventId query parameter.
+func (s *server) handleStream(w http.ResponseWriter, r *http.Request) {
+	filter, err := parsePodFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	clusters, err := s.parseClusters(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var ok bool
+	if filter.Access, ok = authorizeNamespaces(w, r, filter.Namespaces...); !ok {
+		return
+	}
+	// Clusters that sync later stream their pods as they are added
+	if len(availableClusters(w, clusters, func(c *cluster) bool { return c.podsSynced() })) == 0 {
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "Pod cache is not synced yet", http.StatusServiceUnavailable)
+		return
+	}
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("lastEventId")
+	}
+
+	if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		websocket.Server{
+			// Browsers send the user's cookies and client certificate along
+			// with any page's WebSocket requests, so only the server's own
+			// pages may connect. Other clients may send no Origin.
+			Handshake: func(config *websocket.Config, r *http.Request) error {
+				origin, err := websocket.Origin(config, r)
+				if err != nil {
+					return err
+				}
+				if origin != nil && origin.Host != r.Host {
+					return fmt.Errorf("cross-origin WebSocket from %s", origin)
+				}
+				return nil
+			},
+			Handler: func(conn *websocket.Conn) {
+				// Nothing is read from clients but closing the connection
+				ctx, cancel := context.WithCancel(r.Context())
+				defer cancel()
+				go func() {
+					io.Copy(io.Discard, conn)
+					cancel()
+				}()
+				s.stream(ctx, clusters, filter, lastEventID, func(message streamMessage) error {
+					return websocket.JSON.Send(conn, message)
+				}, nil)
+			},
+		}.ServeHTTP(w, r)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	s.stream(r.Context(), clusters, filter, lastEventID, func(message streamMessage) error {
+		data, err := json.Marshal(message)
+		if err != nil {
+			return err
+		}
+		if message.ID != "" {
+			fmt.Fprintf(w, "id: %s\n", message.ID)
+		}
+		if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", message.Type, data); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	}, func() error {
+		if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	})
+}
+
+// stream sends the snapshot or the missed events of clusters, then every
+// change until the client goes away or falls behind. heartbeat, if not nil,
+// is called when nothing was sent for a while.
+func (s *server) stream(ctx context.Context, clusters []*cluster, filter podFilter, lastEventID string, send func(streamMessage) error, heartbeat func() error) {
+	events, replay, resumed, latestID := s.events.subscribe(lastEventID)
+	defer s.events.unsubscribe(events)
+
+	if !resumed {
+		pods := []PodStatus{}
+		for _, c := range clusters {
+			found, err := getPods(c, filter, s.now())
+			if err != nil {
+				return
+			}
+			pods = append(pods, found...)
+		}
+		if err := send(streamMessage{Type: snapshotMessage, ID: latestID, Pods: pods}); err != nil {
+			return
+		}
+	}
+	for _, event := range replay {
+		if message, ok := event.message(clusters, filter, s.now()); ok {
+			if err := send(message); err != nil {
+				return
+			}
+		}
+	}
+
+	interval := s.heartbeat
+	if interval == 0 {
+		interval = defaultHeartbeat
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if message, ok := event.message(clusters, filter, s.now()); ok {
+				if err := send(message); err != nil {
+					return
+				}
+				ticker.Reset(interval)
+			}
+		case <-ticker.C:
+			if heartbeat != nil {
+				if err := heartbeat(); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
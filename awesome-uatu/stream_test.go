@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// sseFrame is one event or comment read from a Server-Sent Events stream.
+type sseFrame struct {
+	id, event, comment string
+	message            streamMessage
+}
+
+type sseClient struct {
+	t        *testing.T
+	response *http.Response
+	lines    chan string
+}
+
+func connectSSE(t *testing.T, url, lastEventID string) *sseClient {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	request, _ := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if lastEventID != "" {
+		request.Header.Set("Last-Event-ID", lastEventID)
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.StatusCode != http.StatusOK || response.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("GET %s = %d %s", url, response.StatusCode, response.Header.Get("Content-Type"))
+	}
+	client := &sseClient{t: t, response: response, lines: make(chan string)}
+	go func() {
+		defer close(client.lines)
+		scanner := bufio.NewScanner(response.Body)
+		for scanner.Scan() {
+			select {
+			case client.lines <- scanner.Text():
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return client
+}
+
+// next returns the next frame, failing the test if none arrives in time.
+func (c *sseClient) next() sseFrame {
+	c.t.Helper()
+	var frame sseFrame
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case line, ok := <-c.lines:
+			if !ok {
+				c.t.Fatal("stream closed")
+			}
+			field, value, _ := strings.Cut(line, ": ")
+			switch field {
+			case "":
+				if value != "" {
+					frame.comment = value
+				}
+				if line == "" {
+					return frame
+				}
+			case "id":
+				frame.id = value
+			case "event":
+				frame.event = value
+			case "data":
+				if err := json.Unmarshal([]byte(value), &frame.message); err != nil {
+					c.t.Fatalf("invalid data %q: %v", value, err)
+				}
+			}
+		case <-timeout:
+			c.t.Fatal("no event received")
+		}
+	}
+}
+
+func (c *sseClient) close() {
+	c.response.Body.Close()
+}
+
+func withResourceVersion(pod *corev1.Pod, resourceVersion string) *corev1.Pod {
+	pod = pod.DeepCopy()
+	pod.ResourceVersion = resourceVersion
+	return pod
+}
+
+func TestStreamSnapshotAndChanges(t *testing.T) {
+	clientset := fake.NewSimpleClientset(
+		withResourceVersion(testPod("web", "frontend", corev1.PodRunning, nil), "1"),
+		withResourceVersion(testPod("db", "postgres", corev1.PodRunning, nil), "2"),
+	)
+	httpServer := httptest.NewServer(startTestServer(t, clientset).routes())
+	t.Cleanup(httpServer.Close) // After the clients disconnected
+	pods := clientset.CoreV1().Pods("web")
+	ctx := context.Background()
+
+	client := connectSSE(t, httpServer.URL+"/status/stream?namespace=web&phase=Pending&phase=Running", "")
+	snapshot := client.next()
+	if snapshot.event != "SNAPSHOT" || len(snapshot.message.Pods) != 1 || snapshot.message.Pods[0].Name != "frontend" {
+		t.Fatalf("first event = %+v, want a snapshot of frontend", snapshot)
+	}
+
+	for _, tt := range []struct {
+		change                  func()
+		id, event, name, status string
+	}{
+		{func() {
+			clientset.CoreV1().Pods("db").Create(ctx, withResourceVersion(testPod("db", "redis", corev1.PodPending, nil), "3"), metav1.CreateOptions{})
+			pods.Create(ctx, withResourceVersion(testPod("web", "backend", corev1.PodPending, nil), "4"), metav1.CreateOptions{})
+		}, "test/4", "ADDED", "backend", "Pending"},
+		{func() {
+			pods.Update(ctx, withResourceVersion(testPod("web", "backend", corev1.PodRunning, nil), "5"), metav1.UpdateOptions{})
+		}, "test/5", "MODIFIED", "backend", "Running"},
+		{func() {
+			pods.Update(ctx, withResourceVersion(testPod("web", "frontend", corev1.PodFailed, nil), "6"), metav1.UpdateOptions{})
+		}, "test/6", "DELETED", "frontend", "Failed"}, // No longer selected by phase
+		{func() {
+			pods.Delete(ctx, "backend", metav1.DeleteOptions{})
+		}, "test/5/deleted", "DELETED", "backend", "Running"},
+	} {
+		tt.change()
+		frame := client.next()
+		if frame.id != tt.id || frame.event != tt.event || frame.message.Type != tt.event ||
+			frame.message.Pod == nil || frame.message.Pod.Name != tt.name || frame.message.Pod.Status != tt.status {
+			t.Errorf("event = %+v %+v, want %s %s %s %s", frame, frame.message.Pod, tt.id, tt.event, tt.name, tt.status)
+		}
+	}
+}
+
+func TestStreamResumesFromLastEventID(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	httpServer := httptest.NewServer(startTestServer(t, clientset).routes())
+	t.Cleanup(httpServer.Close) // After the clients disconnected
+	pods := clientset.CoreV1().Pods("web")
+	ctx := context.Background()
+
+	client := connectSSE(t, httpServer.URL+"/status/stream", "")
+	client.next()
+	pods.Create(ctx, withResourceVersion(testPod("web", "a", corev1.PodRunning, nil), "10"), metav1.CreateOptions{})
+	if frame := client.next(); frame.id != "test/10" {
+		t.Fatalf("event = %+v, want id test/10", frame)
+	}
+	client.close()
+
+	pods.Create(ctx, withResourceVersion(testPod("web", "b", corev1.PodRunning, nil), "11"), metav1.CreateOptions{})
+	pods.Create(ctx, withResourceVersion(testPod("web", "c", corev1.PodRunning, nil), "12"), metav1.CreateOptions{})
+	deadline := time.Now().Add(5 * time.Second)
+	for len(getStatusNames(t, httpServer.Config.Handler, "")) != 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	resumed := connectSSE(t, httpServer.URL+"/status/stream", "test/10")
+	replayed := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		frame := resumed.next()
+		if frame.event != "ADDED" {
+			t.Fatalf("replayed event = %+v, want a pod added", frame)
+		}
+		replayed[frame.message.Pod.Name] = true
+	}
+	if !replayed["b"] || !replayed["c"] {
+		t.Errorf("replayed %v, want b and c", replayed)
+	}
+
+	expired := connectSSE(t, httpServer.URL+"/status/stream", "test/9")
+	if frame := expired.next(); frame.event != "SNAPSHOT" || frame.id != "test/12" || len(frame.message.Pods) != 3 {
+		t.Errorf("event for an unknown id = %+v, want a snapshot with id test/12", frame)
+	}
+}
+
+func TestStreamResumesAcrossDeletion(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	httpServer := httptest.NewServer(startTestServer(t, clientset).routes())
+	t.Cleanup(httpServer.Close) // After the clients disconnected
+	pods := clientset.CoreV1().Pods("web")
+	ctx := context.Background()
+
+	client := connectSSE(t, httpServer.URL+"/status/stream", "")
+	client.next()
+	pods.Create(ctx, withResourceVersion(testPod("web", "a", corev1.PodPending, nil), "20"), metav1.CreateOptions{})
+	client.next()
+	pods.Update(ctx, withResourceVersion(testPod("web", "a", corev1.PodRunning, nil), "21"), metav1.UpdateOptions{})
+	if frame := client.next(); frame.id != "test/21" || frame.event != "MODIFIED" {
+		t.Fatalf("event = %+v, want a modification with id test/21", frame)
+	}
+	client.close()
+
+	// The deletion carries resource version 21 too
+	pods.Delete(ctx, "a", metav1.DeleteOptions{})
+	deadline := time.Now().Add(5 * time.Second)
+	for len(getStatusNames(t, httpServer.Config.Handler, "")) != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	resumed := connectSSE(t, httpServer.URL+"/status/stream", "test/21")
+	if frame := resumed.next(); frame.id != "test/21/deleted" || frame.event != "DELETED" || frame.message.Pod.Name != "a" {
+		t.Errorf("replayed event = %+v, want a with id test/21/deleted", frame)
+	}
+}
+
+func TestStreamHeartbeat(t *testing.T) {
+	srv := startTestServer(t, fake.NewSimpleClientset())
+	srv.heartbeat = 10 * time.Millisecond
+	httpServer := httptest.NewServer(srv.routes())
+	t.Cleanup(httpServer.Close) // After the clients disconnected
+
+	client := connectSSE(t, httpServer.URL+"/status/stream", "")
+	client.next()
+	if frame := client.next(); frame.comment != "heartbeat" {
+		t.Errorf("idle stream sent %+v, want a heartbeat comment", frame)
+	}
+}
+
+func TestStreamRejectsMalformedQueries(t *testing.T) {
+	routes := startTestServer(t, fake.NewSimpleClientset()).routes()
+	if code := get(t, routes, "/status/stream?labelSelector=app%3D%3D%3Dweb").Code; code != http.StatusBadRequest {
+		t.Errorf("GET /status/stream with an invalid selector = %d, want %d", code, http.StatusBadRequest)
+	}
+}
+
+func TestStreamWebSocket(t *testing.T) {
+	clientset := fake.NewSimpleClientset(withResourceVersion(testPod("web", "frontend", corev1.PodRunning, nil), "1"))
+	httpServer := httptest.NewServer(startTestServer(t, clientset).routes())
+	t.Cleanup(httpServer.Close) // After the clients disconnected
+
+	conn, err := websocket.Dial("ws"+strings.TrimPrefix(httpServer.URL, "http")+"/status/stream?namespace=web", "", httpServer.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	var snapshot streamMessage
+	if err := websocket.JSON.Receive(conn, &snapshot); err != nil || snapshot.Type != "SNAPSHOT" || len(snapshot.Pods) != 1 {
+		t.Fatalf("first message = %+v, %v, want a snapshot", snapshot, err)
+	}
+	clientset.CoreV1().Pods("web").Create(context.Background(), withResourceVersion(testPod("web", "backend", corev1.PodPending, nil), "2"), metav1.CreateOptions{})
+	var added streamMessage
+	if err := websocket.JSON.Receive(conn, &added); err != nil || added.Type != "ADDED" || added.ID != "test/2" || added.ResourceVersion != "2" || added.Pod.Name != "backend" || added.Pod.Cluster != "test" {
+		t.Errorf("message = %+v, %v, want backend added", added, err)
+	}
+
+	if conn, err := websocket.Dial("ws"+strings.TrimPrefix(httpServer.URL, "http")+"/status/stream", "", "https://attacker.example"); err == nil {
+		conn.Close()
+		t.Error("WebSocket from another origin was accepted")
+	}
+}
+
+func TestSlowSubscribersAreDisconnected(t *testing.T) {
+	broadcaster := newPodBroadcaster()
+	events, _, _, _ := broadcaster.subscribe("")
+
+	for i := 0; i <= subscriberBuffer; i++ {
+		broadcaster.publish(podEvent{ID: "1"})
+	}
+
+	received := 0
+	for range events {
+		received++
+	}
+	if received != subscriberBuffer {
+		t.Errorf("received %d events before being disconnected, want %d", received, subscriberBuffer)
+	}
+	broadcaster.unsubscribe(events) // Already disconnected, must not panic
+}
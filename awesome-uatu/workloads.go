@@ -0,0 +1,548 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// workloadKinds are the kinds of workloads reported, in report order.
+var workloadKinds = []string{"Deployment", "StatefulSet", "DaemonSet", "Job", "CronJob"}
+
+// parseWorkloadKind matches value against workloadKinds ignoring case, as
+// the kind or its resource name, e.g. Deployment, deployment or deployments.
+func parseWorkloadKind(value string) (string, bool) {
+	for _, kind := range workloadKinds {
+		if strings.EqualFold(value, kind) || strings.EqualFold(value, kind+"s") {
+			return kind, true
+		}
+	}
+	return "", false
+}
+
+// WorkloadStatus is a workload as reported by /workloads.
+type WorkloadStatus struct {
+	// Cluster is the name of the cluster the workload runs in.
+	Cluster   string `json:"cluster,omitempty"`
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	// Replicas and Rollout are set for Deployments, StatefulSets and
+	// DaemonSets, Job for Jobs and CronJob for CronJobs.
+	Replicas *ReplicaCounts `json:"replicas,omitempty"`
+	Rollout  *Rollout       `json:"rollout,omitempty"`
+	Job      *JobStatus     `json:"job,omitempty"`
+	CronJob  *CronJobStatus `json:"cronJob,omitempty"`
+	Health   Health         `json:"health"`
+	// Reasons explain why the workload isn't healthy.
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+// ReplicaCounts compares the pods a workload wants with the pods it has.
+// For DaemonSets they count scheduled pods.
+type ReplicaCounts struct {
+	Desired   int32 `json:"desired"`
+	Ready     int32 `json:"ready"`
+	Updated   int32 `json:"updated"`
+	Available int32 `json:"available"`
+}
+
+// Rollout is the progress of a workload's rollout.
+type Rollout struct {
+	Complete bool `json:"complete"`
+	// Progress describes the state of the rollout as kubectl rollout status
+	// does.
+	Progress string `json:"progress"`
+	// Stuck is set when a Deployment exceeded its progress deadline.
+	Stuck bool `json:"stuck"`
+}
+
+// JobStatus counts the pods of a Job and tells whether it completed.
+type JobStatus struct {
+	// Completions is how many pods must succeed, unset for work queues.
+	Completions    *int32     `json:"completions,omitempty"`
+	Active         int32      `json:"active"`
+	Succeeded      int32      `json:"succeeded"`
+	Failed         int32      `json:"failed"`
+	Complete       bool       `json:"complete"`
+	StartTime      *time.Time `json:"startTime,omitempty"`
+	CompletionTime *time.Time `json:"completionTime,omitempty"`
+}
+
+// CronJobStatus is the schedule and recent runs of a CronJob.
+type CronJobStatus struct {
+	Schedule           string     `json:"schedule"`
+	Suspended          bool       `json:"suspended"`
+	Active             int        `json:"active"`
+	LastScheduleTime   *time.Time `json:"lastScheduleTime,omitempty"`
+	LastSuccessfulTime *time.Time `json:"lastSuccessfulTime,omitempty"`
+	// LastJob is the most recent Job the CronJob created that still exists.
+	LastJob *WorkloadStatus `json:"lastJob,omitempty"`
+}
+
+// workloadFilter selects the workloads reported by /workloads.
+type workloadFilter struct {
+	// Namespaces to list workloads in, all namespaces when empty.
+	Namespaces    []string
+	LabelSelector labels.Selector
+	// Kinds to report, all of workloadKinds when empty.
+	Kinds []string
+	// Access is what the client may see, everything when nil.
+	Access *access
+}
+
+// parseWorkloadFilter reads a workloadFilter from the namespace,
+// labelSelector and kind query parameters. namespace and kind may be
+// repeated.
+func parseWorkloadFilter(query url.Values) (workloadFilter, error) {
+	namespaces, err := parseNamespaces(query)
+	if err != nil {
+		return workloadFilter{}, err
+	}
+	labelSelector, err := parseLabelSelector(query)
+	if err != nil {
+		return workloadFilter{}, err
+	}
+	filter := workloadFilter{Namespaces: namespaces, LabelSelector: labelSelector}
+	for _, value := range query["kind"] {
+		kind, ok := parseWorkloadKind(value)
+		if !ok {
+			return workloadFilter{}, fmt.Errorf("invalid kind %q, use one of %s", value, strings.Join(workloadKinds, ", "))
+		}
+		if !slices.Contains(filter.Kinds, kind) {
+			filter.Kinds = append(filter.Kinds, kind)
+		}
+	}
+	return filter, nil
+}
+
+func (s *server) handleWorkloads(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseWorkloadFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	clusters, err := s.parseClusters(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var ok bool
+	if filter.Access, ok = authorizeNamespaces(w, r, filter.Namespaces...); !ok {
+		return
+	}
+	clusters = availableClusters(w, clusters, func(c *cluster) bool { return c.workloadsSynced() })
+	if len(clusters) == 0 {
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "Workload cache is not synced yet", http.StatusServiceUnavailable)
+		return
+	}
+	namespaces := filter.Namespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+	statuses := []WorkloadStatus{}
+	for _, c := range clusters {
+		for _, kind := range workloadKinds {
+			if len(filter.Kinds) > 0 && !slices.Contains(filter.Kinds, kind) {
+				continue
+			}
+			for _, namespace := range namespaces {
+				found, err := c.listWorkloads(kind, namespace, filter.LabelSelector)
+				if err != nil {
+					http.Error(w, "Failed to get workloads: "+err.Error(), http.StatusInternalServerError)
+					return
+				}
+				for _, status := range found {
+					if filter.Access.allows(status.Namespace) {
+						statuses = append(statuses, status)
+					}
+				}
+			}
+		}
+	}
+	writeJSON(w, statuses)
+}
+
+// handleWorkload reports a single workload. Without the cluster query
+// parameter it is looked up in every cluster, and must only exist in one.
+func (s *server) handleWorkload(w http.ResponseWriter, r *http.Request) {
+	kind, ok := parseWorkloadKind(r.PathValue("kind"))
+	if !ok {
+		http.Error(w, fmt.Sprintf("Unknown workload kind %q, use one of %s", r.PathValue("kind"), strings.Join(workloadKinds, ", ")), http.StatusNotFound)
+		return
+	}
+	clusters, err := s.parseClusters(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, ok := authorizeNamespaces(w, r, r.PathValue("namespace")); !ok {
+		return
+	}
+	clusters = availableClusters(w, clusters, func(c *cluster) bool { return c.workloadsSynced() })
+	if len(clusters) == 0 {
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "Workload cache is not synced yet", http.StatusServiceUnavailable)
+		return
+	}
+	var found []WorkloadStatus
+	for _, c := range clusters {
+		status, err := c.getWorkload(kind, r.PathValue("namespace"), r.PathValue("name"))
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			http.Error(w, "Failed to get workload: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		status.Cluster = c.name
+		found = append(found, status)
+	}
+	switch len(found) {
+	case 0:
+		http.Error(w, fmt.Sprintf("%s %s/%s not found", kind, r.PathValue("namespace"), r.PathValue("name")), http.StatusNotFound)
+	case 1:
+		writeJSON(w, found[0])
+	default:
+		var names []string
+		for _, status := range found {
+			names = append(names, status.Cluster)
+		}
+		http.Error(w, fmt.Sprintf("%s %s/%s exists in clusters %s, use cluster to pick one",
+			kind, r.PathValue("namespace"), r.PathValue("name"), strings.Join(names, ", ")), http.StatusConflict)
+	}
+}
+
+// writeJSON writes v as the JSON response.
+func writeJSON(w http.ResponseWriter, v any) {
+	resp, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, "Failed to marshal response: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resp)
+}
+
+// listWorkloads returns the status of the workloads of kind in namespace
+// of c selected by selector, sorted by namespace and name.
+func (c *cluster) listWorkloads(kind, namespace string, selector labels.Selector) ([]WorkloadStatus, error) {
+	var statuses []WorkloadStatus
+	switch kind {
+	case "Deployment":
+		items, err := c.deployments.Deployments(namespace).List(selector)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			statuses = append(statuses, deploymentStatus(item))
+		}
+	case "StatefulSet":
+		items, err := c.statefulSets.StatefulSets(namespace).List(selector)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			statuses = append(statuses, statefulSetStatus(item))
+		}
+	case "DaemonSet":
+		items, err := c.daemonSets.DaemonSets(namespace).List(selector)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			statuses = append(statuses, daemonSetStatus(item))
+		}
+	case "Job":
+		items, err := c.jobs.Jobs(namespace).List(selector)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			statuses = append(statuses, jobStatus(item))
+		}
+	case "CronJob":
+		items, err := c.cronJobs.CronJobs(namespace).List(selector)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			status, err := c.cronJobStatus(item)
+			if err != nil {
+				return nil, err
+			}
+			statuses = append(statuses, status)
+		}
+	}
+	for i := range statuses {
+		statuses[i].Cluster = c.name
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		if statuses[i].Namespace != statuses[j].Namespace {
+			return statuses[i].Namespace < statuses[j].Namespace
+		}
+		return statuses[i].Name < statuses[j].Name
+	})
+	return statuses, nil
+}
+
+// getWorkload returns the status of the workload of kind called name in
+// namespace of c, or a NotFound error.
+func (c *cluster) getWorkload(kind, namespace, name string) (WorkloadStatus, error) {
+	switch kind {
+	case "Deployment":
+		item, err := c.deployments.Deployments(namespace).Get(name)
+		if err != nil {
+			return WorkloadStatus{}, err
+		}
+		return deploymentStatus(item), nil
+	case "StatefulSet":
+		item, err := c.statefulSets.StatefulSets(namespace).Get(name)
+		if err != nil {
+			return WorkloadStatus{}, err
+		}
+		return statefulSetStatus(item), nil
+	case "DaemonSet":
+		item, err := c.daemonSets.DaemonSets(namespace).Get(name)
+		if err != nil {
+			return WorkloadStatus{}, err
+		}
+		return daemonSetStatus(item), nil
+	case "Job":
+		item, err := c.jobs.Jobs(namespace).Get(name)
+		if err != nil {
+			return WorkloadStatus{}, err
+		}
+		return jobStatus(item), nil
+	default:
+		item, err := c.cronJobs.CronJobs(namespace).Get(name)
+		if err != nil {
+			return WorkloadStatus{}, err
+		}
+		return c.cronJobStatus(item)
+	}
+}
+
+// replicaHealth derives the health of a workload running replicas. A
+// workload without any ready replica is failing, a stuck rollout as well.
+func replicaHealth(replicas ReplicaCounts, rollout Rollout) (Health, []string) {
+	switch {
+	case rollout.Stuck:
+		return Failing, []string{rollout.Progress}
+	case replicas.Desired > 0 && replicas.Ready == 0:
+		return Failing, []string{fmt.Sprintf("none of %d replicas are ready", replicas.Desired)}
+	case replicas.Ready < replicas.Desired:
+		reasons := []string{fmt.Sprintf("%d of %d replicas are ready", replicas.Ready, replicas.Desired)}
+		if !rollout.Complete {
+			reasons = append(reasons, rollout.Progress)
+		}
+		return Degraded, reasons
+	case !rollout.Complete:
+		return Degraded, []string{rollout.Progress}
+	default:
+		return Healthy, nil
+	}
+}
+
+func workloadStatus(kind string, meta metav1.ObjectMeta, replicas ReplicaCounts, rollout Rollout) WorkloadStatus {
+	status := WorkloadStatus{
+		Kind:      kind,
+		Namespace: meta.Namespace,
+		Name:      meta.Name,
+		Replicas:  &replicas,
+		Rollout:   &rollout,
+	}
+	status.Health, status.Reasons = replicaHealth(replicas, rollout)
+	return status
+}
+
+// deploymentStatus reports deployment's rollout the way kubectl rollout
+// status does.
+func deploymentStatus(deployment *appsv1.Deployment) WorkloadStatus {
+	desired := int32(1)
+	if deployment.Spec.Replicas != nil {
+		desired = *deployment.Spec.Replicas
+	}
+	status := deployment.Status
+	replicas := ReplicaCounts{Desired: desired, Ready: status.ReadyReplicas, Updated: status.UpdatedReplicas, Available: status.AvailableReplicas}
+	var rollout Rollout
+	progressing := deploymentCondition(status, appsv1.DeploymentProgressing)
+	switch {
+	case deployment.Generation > status.ObservedGeneration:
+		rollout.Progress = "waiting for the deployment spec update to be observed"
+	case progressing != nil && progressing.Reason == "ProgressDeadlineExceeded":
+		rollout.Stuck = true
+		rollout.Progress = fmt.Sprintf("rollout exceeded its progress deadline: %s", progressing.Message)
+	case status.UpdatedReplicas < desired:
+		rollout.Progress = fmt.Sprintf("%d of %d new replicas have been updated", status.UpdatedReplicas, desired)
+	case status.Replicas > status.UpdatedReplicas:
+		rollout.Progress = fmt.Sprintf("%d old replicas are pending termination", status.Replicas-status.UpdatedReplicas)
+	case status.AvailableReplicas < status.UpdatedReplicas:
+		rollout.Progress = fmt.Sprintf("%d of %d updated replicas are available", status.AvailableReplicas, status.UpdatedReplicas)
+	default:
+		rollout.Complete = true
+		rollout.Progress = "successfully rolled out"
+	}
+	return workloadStatus("Deployment", deployment.ObjectMeta, replicas, rollout)
+}
+
+func deploymentCondition(status appsv1.DeploymentStatus, conditionType appsv1.DeploymentConditionType) *appsv1.DeploymentCondition {
+	for i := range status.Conditions {
+		if status.Conditions[i].Type == conditionType {
+			return &status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+func statefulSetStatus(statefulSet *appsv1.StatefulSet) WorkloadStatus {
+	desired := int32(1)
+	if statefulSet.Spec.Replicas != nil {
+		desired = *statefulSet.Spec.Replicas
+	}
+	status := statefulSet.Status
+	replicas := ReplicaCounts{Desired: desired, Ready: status.ReadyReplicas, Updated: status.UpdatedReplicas, Available: status.AvailableReplicas}
+	var partition int32
+	if update := statefulSet.Spec.UpdateStrategy.RollingUpdate; update != nil && update.Partition != nil {
+		partition = *update.Partition
+	}
+	var rollout Rollout
+	switch {
+	case statefulSet.Spec.UpdateStrategy.Type == appsv1.OnDeleteStatefulSetStrategyType:
+		// Pods are only updated when someone deletes them
+		rollout.Complete = true
+		rollout.Progress = "pods are updated when they are deleted"
+	case statefulSet.Generation > status.ObservedGeneration:
+		rollout.Progress = "waiting for the statefulset spec update to be observed"
+	case status.ReadyReplicas < desired:
+		rollout.Progress = fmt.Sprintf("%d of %d pods are ready", status.ReadyReplicas, desired)
+	case partition > 0 && status.UpdatedReplicas < desired-partition:
+		rollout.Progress = fmt.Sprintf("%d of %d pods above the partition have been updated", status.UpdatedReplicas, desired-partition)
+	case partition == 0 && status.UpdateRevision != status.CurrentRevision:
+		rollout.Progress = fmt.Sprintf("%d of %d pods are at revision %s", status.UpdatedReplicas, desired, status.UpdateRevision)
+	default:
+		rollout.Complete = true
+		rollout.Progress = "successfully rolled out"
+	}
+	return workloadStatus("StatefulSet", statefulSet.ObjectMeta, replicas, rollout)
+}
+
+func daemonSetStatus(daemonSet *appsv1.DaemonSet) WorkloadStatus {
+	status := daemonSet.Status
+	replicas := ReplicaCounts{
+		Desired:   status.DesiredNumberScheduled,
+		Ready:     status.NumberReady,
+		Updated:   status.UpdatedNumberScheduled,
+		Available: status.NumberAvailable,
+	}
+	var rollout Rollout
+	switch {
+	case daemonSet.Spec.UpdateStrategy.Type == appsv1.OnDeleteDaemonSetStrategyType:
+		rollout.Complete = true
+		rollout.Progress = "pods are updated when they are deleted"
+	case daemonSet.Generation > status.ObservedGeneration:
+		rollout.Progress = "waiting for the daemonset spec update to be observed"
+	case status.UpdatedNumberScheduled < status.DesiredNumberScheduled:
+		rollout.Progress = fmt.Sprintf("%d of %d new pods have been updated", status.UpdatedNumberScheduled, status.DesiredNumberScheduled)
+	case status.NumberAvailable < status.DesiredNumberScheduled:
+		rollout.Progress = fmt.Sprintf("%d of %d updated pods are available", status.NumberAvailable, status.DesiredNumberScheduled)
+	default:
+		rollout.Complete = true
+		rollout.Progress = "successfully rolled out"
+	}
+	return workloadStatus("DaemonSet", daemonSet.ObjectMeta, replicas, rollout)
+}
+
+func jobStatus(job *batchv1.Job) WorkloadStatus {
+	status := WorkloadStatus{
+		Kind:      "Job",
+		Namespace: job.Namespace,
+		Name:      job.Name,
+		Job: &JobStatus{
+			Completions:    job.Spec.Completions,
+			Active:         job.Status.Active,
+			Succeeded:      job.Status.Succeeded,
+			Failed:         job.Status.Failed,
+			StartTime:      timeOf(job.Status.StartTime),
+			CompletionTime: timeOf(job.Status.CompletionTime),
+		},
+		Health: Healthy,
+	}
+	for _, condition := range job.Status.Conditions {
+		if condition.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch condition.Type {
+		case batchv1.JobComplete:
+			status.Job.Complete = true
+		case batchv1.JobFailed:
+			status.Health = Failing
+			status.Reasons = append(status.Reasons, fmt.Sprintf("job failed: %s: %s", condition.Reason, condition.Message))
+		}
+	}
+	if status.Health == Healthy && !status.Job.Complete && job.Status.Failed > 0 {
+		status.Health = Degraded
+		status.Reasons = append(status.Reasons, fmt.Sprintf("%d pods failed", job.Status.Failed))
+	}
+	return status
+}
+
+// cronJobStatus reports cronJob and the last Job it created, the health of
+// which the CronJob inherits.
+func (c *cluster) cronJobStatus(cronJob *batchv1.CronJob) (WorkloadStatus, error) {
+	status := WorkloadStatus{
+		Kind:      "CronJob",
+		Namespace: cronJob.Namespace,
+		Name:      cronJob.Name,
+		CronJob: &CronJobStatus{
+			Schedule:           cronJob.Spec.Schedule,
+			Suspended:          cronJob.Spec.Suspend != nil && *cronJob.Spec.Suspend,
+			Active:             len(cronJob.Status.Active),
+			LastScheduleTime:   timeOf(cronJob.Status.LastScheduleTime),
+			LastSuccessfulTime: timeOf(cronJob.Status.LastSuccessfulTime),
+		},
+		Health: Healthy,
+	}
+	jobs, err := c.jobs.Jobs(cronJob.Namespace).List(labels.Everything())
+	if err != nil {
+		return WorkloadStatus{}, err
+	}
+	var last *batchv1.Job
+	for _, job := range jobs {
+		if owner := metav1.GetControllerOf(job); owner == nil || owner.UID != cronJob.UID {
+			continue
+		}
+		if last == nil || last.CreationTimestamp.Before(&job.CreationTimestamp) {
+			last = job
+		}
+	}
+	if last != nil {
+		lastJob := jobStatus(last)
+		status.CronJob.LastJob = &lastJob
+		if lastJob.Health != Healthy {
+			status.Health = Degraded
+			status.Reasons = append(status.Reasons, fmt.Sprintf("last job %s is %s", last.Name, lastJob.Health))
+		}
+	}
+	return status, nil
+}
+
+func timeOf(t *metav1.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	return &t.Time
+}
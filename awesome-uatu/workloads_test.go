@@ -0,0 +1,225 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func replicas(n int32) *int32 { return &n }
+
+func testDeployment(name string, desired int32, status appsv1.DeploymentStatus) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "web", Name: name, Generation: 2, Labels: map[string]string{"app": name}},
+		Spec:       appsv1.DeploymentSpec{Replicas: replicas(desired)},
+		Status:     status,
+	}
+}
+
+func TestDeploymentStatus(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		deployment *appsv1.Deployment
+		complete   bool
+		stuck      bool
+		progress   string
+		health     Health
+	}{
+		{"rolled out", testDeployment("web", 3, appsv1.DeploymentStatus{
+			ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 3, ReadyReplicas: 3, AvailableReplicas: 3,
+		}), true, false, "successfully rolled out", Healthy},
+		{"spec update not observed", testDeployment("web", 3, appsv1.DeploymentStatus{
+			ObservedGeneration: 1, Replicas: 3, UpdatedReplicas: 3, ReadyReplicas: 3, AvailableReplicas: 3,
+		}), false, false, "waiting for the deployment spec update to be observed", Degraded},
+		{"updating", testDeployment("web", 3, appsv1.DeploymentStatus{
+			ObservedGeneration: 2, Replicas: 4, UpdatedReplicas: 1, ReadyReplicas: 3, AvailableReplicas: 3,
+		}), false, false, "1 of 3 new replicas have been updated", Degraded},
+		{"old replicas terminating", testDeployment("web", 3, appsv1.DeploymentStatus{
+			ObservedGeneration: 2, Replicas: 4, UpdatedReplicas: 3, ReadyReplicas: 3, AvailableReplicas: 3,
+		}), false, false, "1 old replicas are pending termination", Degraded},
+		{"waiting for availability", testDeployment("web", 3, appsv1.DeploymentStatus{
+			ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 3, ReadyReplicas: 3, AvailableReplicas: 2,
+		}), false, false, "2 of 3 updated replicas are available", Degraded},
+		{"stuck", testDeployment("web", 3, appsv1.DeploymentStatus{
+			ObservedGeneration: 2, Replicas: 4, UpdatedReplicas: 1, ReadyReplicas: 3, AvailableReplicas: 3,
+			Conditions: []appsv1.DeploymentCondition{{
+				Type: appsv1.DeploymentProgressing, Status: corev1.ConditionFalse, Reason: "ProgressDeadlineExceeded",
+				Message: `ReplicaSet "web-6d8f" has timed out progressing.`,
+			}},
+		}), false, true, `rollout exceeded its progress deadline: ReplicaSet "web-6d8f" has timed out progressing.`, Failing},
+		{"nothing ready", testDeployment("web", 2, appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 2, UpdatedReplicas: 2}),
+			false, false, "0 of 2 updated replicas are available", Failing},
+		{"scaled to zero", testDeployment("web", 0, appsv1.DeploymentStatus{ObservedGeneration: 2}), true, false, "successfully rolled out", Healthy},
+	} {
+		status := deploymentStatus(tt.deployment)
+		if status.Rollout.Complete != tt.complete || status.Rollout.Stuck != tt.stuck || status.Rollout.Progress != tt.progress || status.Health != tt.health {
+			t.Errorf("%s: deploymentStatus = %+v %s, want complete %v, stuck %v, %q, %s", tt.name, *status.Rollout, status.Health, tt.complete, tt.stuck, tt.progress, tt.health)
+		}
+	}
+}
+
+func TestStatefulSetAndDaemonSetStatus(t *testing.T) {
+	statefulSet := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "db", Name: "postgres"},
+		Spec:       appsv1.StatefulSetSpec{Replicas: replicas(3)},
+		Status: appsv1.StatefulSetStatus{
+			Replicas: 3, ReadyReplicas: 3, UpdatedReplicas: 1, AvailableReplicas: 3,
+			CurrentRevision: "postgres-1", UpdateRevision: "postgres-2",
+		},
+	}
+	status := statefulSetStatus(statefulSet)
+	if status.Rollout.Progress != "1 of 3 pods are at revision postgres-2" || status.Health != Degraded {
+		t.Errorf("statefulSetStatus during an update = %+v %s", *status.Rollout, status.Health)
+	}
+	statefulSet.Spec.UpdateStrategy.RollingUpdate = &appsv1.RollingUpdateStatefulSetStrategy{Partition: replicas(2)}
+	if status := statefulSetStatus(statefulSet); !status.Rollout.Complete || status.Health != Healthy {
+		t.Errorf("statefulSetStatus with the pods above the partition updated = %+v %s", *status.Rollout, status.Health)
+	}
+
+	daemonSet := &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "node-exporter"},
+		Status:     appsv1.DaemonSetStatus{DesiredNumberScheduled: 5, NumberReady: 4, UpdatedNumberScheduled: 5, NumberAvailable: 4},
+	}
+	status = daemonSetStatus(daemonSet)
+	if want := (ReplicaCounts{Desired: 5, Ready: 4, Updated: 5, Available: 4}); *status.Replicas != want {
+		t.Errorf("daemonSetStatus replicas = %+v, want %+v", *status.Replicas, want)
+	}
+	if want := []string{"4 of 5 replicas are ready", "4 of 5 updated pods are available"}; status.Health != Degraded || !reflect.DeepEqual(status.Reasons, want) {
+		t.Errorf("daemonSetStatus = %s %q, want degraded %q", status.Health, status.Reasons, want)
+	}
+}
+
+func TestJobStatus(t *testing.T) {
+	failed := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "web", Name: "migrate"},
+		Spec:       batchv1.JobSpec{Completions: replicas(1)},
+		Status: batchv1.JobStatus{
+			Failed: 6,
+			Conditions: []batchv1.JobCondition{{
+				Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Reason: "BackoffLimitExceeded", Message: "Job has reached the specified backoff limit",
+			}},
+		},
+	}
+	status := jobStatus(failed)
+	if want := []string{"job failed: BackoffLimitExceeded: Job has reached the specified backoff limit"}; status.Health != Failing || !reflect.DeepEqual(status.Reasons, want) {
+		t.Errorf("jobStatus of a failed job = %s %q", status.Health, status.Reasons)
+	}
+
+	retrying := &batchv1.Job{Status: batchv1.JobStatus{Active: 1, Failed: 2}}
+	if status := jobStatus(retrying); status.Health != Degraded || status.Job.Complete {
+		t.Errorf("jobStatus of a retrying job = %s %+v", status.Health, *status.Job)
+	}
+
+	completed := &batchv1.Job{Status: batchv1.JobStatus{
+		Succeeded:  1,
+		Failed:     1,
+		Conditions: []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}},
+	}}
+	if status := jobStatus(completed); status.Health != Healthy || !status.Job.Complete {
+		t.Errorf("jobStatus of a completed job = %s %+v", status.Health, *status.Job)
+	}
+}
+
+func cronJobFixtures() (*batchv1.CronJob, *batchv1.Job, *batchv1.Job) {
+	lastSchedule := metav1.NewTime(time.Date(2024, 9, 26, 3, 0, 0, 0, time.UTC))
+	lastSuccess := metav1.NewTime(time.Date(2024, 9, 25, 3, 4, 0, 0, time.UTC))
+	cronJob := &batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "db", Name: "backup", UID: types.UID("backup-uid")},
+		Spec:       batchv1.CronJobSpec{Schedule: "0 3 * * *"},
+		Status:     batchv1.CronJobStatus{LastScheduleTime: &lastSchedule, LastSuccessfulTime: &lastSuccess},
+	}
+	isController := true
+	ownedBy := []metav1.OwnerReference{{Kind: "CronJob", Name: "backup", UID: "backup-uid", Controller: &isController}}
+	previous := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "db", Name: "backup-28786980", OwnerReferences: ownedBy, CreationTimestamp: lastSuccess},
+		Status:     batchv1.JobStatus{Succeeded: 1, Conditions: []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}},
+	}
+	latest := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "db", Name: "backup-28788420", OwnerReferences: ownedBy, CreationTimestamp: lastSchedule},
+		Status:     batchv1.JobStatus{Failed: 1, Conditions: []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Reason: "DeadlineExceeded"}}},
+	}
+	return cronJob, previous, latest
+}
+
+func TestWorkloadEndpoints(t *testing.T) {
+	cronJob, previous, latest := cronJobFixtures()
+	routes := startTestServer(t, fake.NewSimpleClientset(
+		testDeployment("frontend", 2, appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 2, UpdatedReplicas: 2, ReadyReplicas: 2, AvailableReplicas: 2}),
+		testDeployment("api", 2, appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 2, UpdatedReplicas: 2, ReadyReplicas: 1, AvailableReplicas: 1}),
+		&appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Namespace: "db", Name: "postgres"}, Spec: appsv1.StatefulSetSpec{Replicas: replicas(1)},
+			Status: appsv1.StatefulSetStatus{Replicas: 1, ReadyReplicas: 1, UpdatedReplicas: 1, AvailableReplicas: 1}},
+		&appsv1.DaemonSet{ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "node-exporter"}},
+		cronJob, previous, latest,
+	)).routes()
+
+	for _, tt := range []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"Deployment web/api", "Deployment web/frontend", "StatefulSet db/postgres", "DaemonSet kube-system/node-exporter",
+			"Job db/backup-28786980", "Job db/backup-28788420", "CronJob db/backup"}},
+		{"namespace=db&kind=cronjobs&kind=StatefulSet", []string{"StatefulSet db/postgres", "CronJob db/backup"}},
+		{"labelSelector=app%3Dfrontend", []string{"Deployment web/frontend"}},
+	} {
+		recorder := get(t, routes, "/workloads?"+tt.query)
+		var statuses []WorkloadStatus
+		if err := json.Unmarshal(recorder.Body.Bytes(), &statuses); err != nil {
+			t.Fatalf("GET /workloads?%s = %d %s", tt.query, recorder.Code, recorder.Body)
+		}
+		got := []string{}
+		for _, status := range statuses {
+			got = append(got, status.Kind+" "+status.Namespace+"/"+status.Name)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("GET /workloads?%s = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+
+	recorder := get(t, routes, "/workloads/cronjobs/db/backup")
+	var backup WorkloadStatus
+	if err := json.Unmarshal(recorder.Body.Bytes(), &backup); err != nil {
+		t.Fatalf("GET /workloads/cronjobs/db/backup = %d %s", recorder.Code, recorder.Body)
+	}
+	if backup.CronJob.Schedule != "0 3 * * *" || !backup.CronJob.LastScheduleTime.Equal(latest.CreationTimestamp.Time) ||
+		backup.CronJob.LastJob == nil || backup.CronJob.LastJob.Name != "backup-28788420" {
+		t.Errorf("GET /workloads/cronjobs/db/backup = %+v", *backup.CronJob)
+	}
+	if want := []string{"last job backup-28788420 is failing"}; backup.Health != Degraded || !reflect.DeepEqual(backup.Reasons, want) {
+		t.Errorf("GET /workloads/cronjobs/db/backup health = %s %q, want degraded %q", backup.Health, backup.Reasons, want)
+	}
+
+	recorder = get(t, routes, "/workloads/Deployment/web/api")
+	var api WorkloadStatus
+	if err := json.Unmarshal(recorder.Body.Bytes(), &api); err != nil {
+		t.Fatalf("GET /workloads/Deployment/web/api = %d %s", recorder.Code, recorder.Body)
+	}
+	if want := (ReplicaCounts{Desired: 2, Ready: 1, Updated: 2, Available: 1}); *api.Replicas != want || api.Health != Degraded {
+		t.Errorf("GET /workloads/Deployment/web/api = %+v %s", *api.Replicas, api.Health)
+	}
+}
+
+func TestWorkloadEndpointErrors(t *testing.T) {
+	routes := startTestServer(t, fake.NewSimpleClientset()).routes()
+	for _, tt := range []struct {
+		target string
+		code   int
+	}{
+		{"/workloads?kind=pods", http.StatusBadRequest},
+		{"/workloads?namespace=Web", http.StatusBadRequest},
+		{"/workloads/replicasets/web/frontend", http.StatusNotFound},
+		{"/workloads/deployments/web/missing", http.StatusNotFound},
+	} {
+		if code := get(t, routes, tt.target).Code; code != tt.code {
+			t.Errorf("GET %s = %d, want %d", tt.target, code, tt.code)
+		}
+	}
+}